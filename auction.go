@@ -3,6 +3,7 @@ package auction
 import (
 	"errors"
 	"os"
+	"time"
 
 	"github.com/op/go-logging"
 )
@@ -11,17 +12,26 @@ const maxOrders = 20000000
 const maxDeals = 10000000
 
 var orderNo int
+
+// time priority sequence of orders entered orderBook
+var seqNo int
 var dealNo int
+var tradeNo int
 var simOrders [maxOrders]*simOrderType
 var simDeals [maxDeals]*simDealType
 var simState int = StatePreAuction
 
+// simClock is time source of engine, could be replaced by SetClock
+var simClock = time.Now
+
 const (
 	StateIdle = iota
 	StatePreAuction
 	StateCallAuction
 	StateTrading
 	StateStop
+	// symbol halted by HaltSymbol, never global state
+	StateHalted
 )
 
 var (
@@ -32,6 +42,8 @@ var (
 	errOrderNoSeq  = errors.New("Order same price No disorder")
 	errOrderFilled = errors.New("wrong order Filled volume")
 	errState       = errors.New("wrong trading state")
+	errReduceOrder = errors.New("can't reduce order quantity")
+	errOrderFull   = errors.New("order capacity full")
 )
 var log = logging.MustGetLogger("go-auction")
 
@@ -40,6 +52,7 @@ var simOrderBook = map[string]*orderBook{}
 
 func cleanupOrderBook(sym string) {
 	if orBook, ok := simOrderBook[sym]; ok {
+		orBook.clear()
 		orBook.cleanup()
 		delete(simOrderBook, sym)
 	}
@@ -65,31 +78,113 @@ func DealCount() int {
 	return dealNo
 }
 
+func nextTradeNo() int {
+	tradeNo++
+	return tradeNo
+}
+
+func fillTradeNo(tNo int) int {
+	if tNo != 0 {
+		return tNo
+	}
+	return nextTradeNo()
+}
+
 func MarketStart(cleanOrder bool) {
-	simState = StateTrading
+	setState(StateTrading)
+	resetHalts()
 	dealNo = 0
+	tradeNo = 0
 	if cleanOrder {
 		orderNo = 0
+		seqNo = 0
+		clOrdIDs = map[clOrdKey]int{}
+		resetOpenOrders()
+		gtdWheel.reset()
+		pegOrders = map[string][]int{}
+		darkBooks = map[string]*darkBook{}
+		resetQuotes()
 	}
 }
 
 func MarketStop() {
-	simState = StateStop
+	ExpireDayOrders()
+	cancelOpenRfqs()
+	setState(StateStop)
+}
+
+type StateHandler func(state int)
+
+var stateHandlers []StateHandler
+
+// StateSubscribe register handler for trading state change
+func StateSubscribe(fn StateHandler) {
+	stateHandlers = append(stateHandlers, fn)
+}
+
+func StateUnsubscribeAll() {
+	stateHandlers = nil
+}
+
+// MarketState return current trading state
+func MarketState() int {
+	return simState
+}
+
+func setState(state int) {
+	if state == simState {
+		return
+	}
+	simState = state
+	for _, fn := range stateHandlers {
+		fn(state)
+	}
+}
+
+// SetClock replace engine time source, nil for time.Now
+func SetClock(now func() time.Time) {
+	if now == nil {
+		now = time.Now
+	}
+	simClock = now
+}
+
+// bookChanged pull quotes of tripped makers, reprice pegged orders, check
+// dark book and implied match of spreads after orderBook of sym changed
+func bookChanged(sym string) {
+	mmpPull()
+	repegOrders(sym)
+	darkMatch(sym, false)
+	if legs := impliedMatch(sym); len(legs) > 0 {
+		// implied fills changed other legs, check again
+		for _, leg := range legs {
+			bookChanged(leg)
+		}
+		bookChanged(sym)
+		return
+	}
+	impliedPublish(sym)
 }
 
 func simInsertOrder(or *simOrderType) {
 	orBook, ok := simOrderBook[or.Symbol]
 	if !ok {
-		orBook = NewOrderBook()
+		orBook = NewOrderBook(or.Symbol)
 		simOrderBook[or.Symbol] = orBook
 	}
 	orBook.insert(or)
 }
 
-func simRemoveOrder(or *simOrderType) {
+// simRemoveOrder return removed order in orderBook or dark book, nil if
+// not found
+func simRemoveOrder(or *simOrderType) *simOrderType {
+	if or.Dark {
+		return darkRemove(or)
+	}
 	if orBook, ok := simOrderBook[or.Symbol]; ok {
-		orBook.delete(or)
+		return orBook.delete(or)
 	}
+	return nil
 }
 
 func verifySimOrderBook(sym string) error {
@@ -100,7 +195,7 @@ func verifySimOrderBook(sym string) error {
 	}
 	// validate bids
 	last := 0
-	oid := 0
+	seq := 0
 	for v := orB.getBestBid(); v != nil; v = orB.nextBid() {
 		if v.Filled < 0 || v.Filled > v.Qty {
 			log.Errorf("Wrong Filled oid: %d Volume %d/%d", v.oid, v.Filled, v.Qty)
@@ -108,7 +203,7 @@ func verifySimOrderBook(sym string) error {
 		}
 		if last == 0 {
 			last = v.price
-			oid = v.oid
+			seq = v.seq
 			continue
 		}
 		if last < v.price {
@@ -116,23 +211,23 @@ func verifySimOrderBook(sym string) error {
 			return errOrderSeq
 		}
 		if last == v.price {
-			if oid > v.oid {
-				log.Error("Bid order book oid disorder for", sym)
+			if seq > v.seq {
+				log.Error("Bid order book seq disorder for", sym)
 				return errOrderNoSeq
 			}
-			oid = v.oid
+			seq = v.seq
 			continue
 		}
 		last = v.price
-		oid = v.oid
+		seq = v.seq
 	}
 	// validate asks
 	last = 0
-	oid = 0
+	seq = 0
 	for v := orB.getBestAsk(); v != nil; v = orB.nextAsk() {
 		if last == 0 {
 			last = v.price
-			oid = v.oid
+			seq = v.seq
 			continue
 		}
 		if last > v.price {
@@ -140,15 +235,15 @@ func verifySimOrderBook(sym string) error {
 			return errOrderSeq
 		}
 		if last == v.price {
-			if oid > v.oid {
-				log.Error("Bid order book oid disorder for", sym)
+			if seq > v.seq {
+				log.Error("Bid order book seq disorder for", sym)
 				return errOrderNoSeq
 			}
-			oid = v.oid
+			seq = v.seq
 			continue
 		}
 		last = v.price
-		oid = v.oid
+		seq = v.seq
 	}
 	return nil
 }
@@ -192,7 +287,29 @@ func OrderBookLen(sym string) (bidLen, askLen int) {
 var simLogMatchs int
 
 func MatchOrder(sym string, isBuy bool, last, volume int) {
-	setFill := func(or *simOrderType, last int, vol int) (volFilled int) {
+	matchOrder(sym, isBuy, last, volume, 0)
+}
+
+// Uncross fill call auction of sym at MatchCross price after self-trade
+// prevention of crossed orders, one auction trade published for whole uncross
+func Uncross(sym string, pclose int) (last int, maxVol, volRemain int) {
+	uncrossSelfTrades(sym)
+	last, maxVol, volRemain = MatchCross(sym, pclose)
+	if maxVol == 0 {
+		return
+	}
+	tNo := nextTradeNo()
+	matchOrder(sym, true, last, maxVol, tNo)
+	matchOrder(sym, false, last, maxVol, tNo)
+	mdAuctionTrade(sym, last, maxVol, tNo)
+	bookChanged(sym)
+	return
+}
+
+// matchOrder fill orders of one side up to volume at last price,
+// tNo zero for new trade number per fill
+func matchOrder(sym string, isBuy bool, last, volume, tNo int) {
+	setFill := func(or *simOrderType, last int, vol int, tNo int) (volFilled int) {
 		if vol >= or.Qty-or.Filled {
 			volFilled = or.Qty - or.Filled
 		} else {
@@ -200,6 +317,7 @@ func MatchOrder(sym string, isBuy bool, last, volume int) {
 		}
 		or.Filled += volFilled
 		or.PriceFilled = last
+		execFill(or, last, volFilled, tNo, LiqAuction)
 		simLogMatchs++
 		if simLogMatchs <= 10 {
 			log.Infof("Filled No:%d %s %d %s %d(filled %d)", or.oid, or.Symbol,
@@ -209,11 +327,36 @@ func MatchOrder(sym string, isBuy bool, last, volume int) {
 	}
 
 	if orB, ok := simOrderBook[sym]; ok {
+		ma := auctionAlgos[sym]
 		for v := orB.First(isBuy); v != nil; v = orB.Get(isBuy) {
+			if ma != nil && v.price == last {
+				// marginal level allocated, no order at worse price match
+				level := levelOrders(orB, isBuy, last)
+				leaves := make([]int, len(level))
+				for i := range level {
+					leaves[i] = level[i].Qty - level[i].Filled
+				}
+				for i, q := range ma.allocate(leaves, volume) {
+					if q == 0 {
+						continue
+					}
+					rv := orB.find(&level[i])
+					fillNo := fillTradeNo(tNo)
+					vol := setFill(rv, last, q, fillNo)
+					orB.fill(rv, last, vol, fillNo)
+					if rv.Filled >= rv.Qty {
+						orB.remove(rv)
+					}
+				}
+				break
+			}
 			if isBuy {
 				if v.price >= last {
 					// match
-					volume -= setFill(v, last, volume)
+					fillNo := fillTradeNo(tNo)
+					vol := setFill(v, last, volume, fillNo)
+					orB.fill(v, last, vol, fillNo)
+					volume -= vol
 					if v.Filled >= v.Qty {
 						orB.RemoveFirst(isBuy)
 					} else {
@@ -234,7 +377,10 @@ func MatchOrder(sym string, isBuy bool, last, volume int) {
 			} else {
 				if v.price <= last {
 					// match
-					volume -= setFill(v, last, volume)
+					fillNo := fillTradeNo(tNo)
+					vol := setFill(v, last, volume, fillNo)
+					orB.fill(v, last, vol, fillNo)
+					volume -= vol
 					if v.Filled >= v.Qty {
 						orB.RemoveFirst(isBuy)
 					} else {
@@ -259,8 +405,9 @@ func MatchOrder(sym string, isBuy bool, last, volume int) {
 
 // last price is not Mid of bid/ask and c_last
 // To simplify, last price set to take price, optimized for liquidaty provider
+// filled also true if order canceled by self-trade prevention
 func tryMatchOrderBook(order *simOrderType) (filled bool) {
-	setFill := func(or *simOrderType, last int, vol int) (volFilled int) {
+	setFill := func(or *simOrderType, last int, vol int, tNo int) (volFilled int) {
 		if vol >= or.Qty-or.Filled {
 			volFilled = or.Qty - or.Filled
 		} else {
@@ -269,6 +416,12 @@ func tryMatchOrderBook(order *simOrderType) (filled bool) {
 		or.Filled += volFilled
 		or.PriceFilled = last
 		pushDeal(or.oid, last, volFilled)
+		// incoming order is aggressor of trade
+		liq := LiqMaker
+		if or == order {
+			liq = LiqTaker
+		}
+		execFill(or, last, volFilled, tNo, liq)
 		if simState == StateTrading {
 			simLogMatchs++
 			if simLogMatchs <= 10 {
@@ -282,17 +435,68 @@ func tryMatchOrderBook(order *simOrderType) (filled bool) {
 	sym := order.Symbol
 	if orB, ok := simOrderBook[sym]; ok {
 		isBuy := !order.bBuy
+		if order.PostOnly != 0 && postOnly(orB, order) {
+			return true
+		}
 		for v := orB.First(isBuy); v != nil; v = orB.Get(isBuy) {
 			volume := order.Qty - order.Filled
 			last := order.price
+			if ((isBuy && v.price >= last) || (!isBuy && v.price <= last)) &&
+				selfTrade(order, v) {
+				if preventSelfTrade(orB, order, v) {
+					filled = true
+					break
+				}
+				continue
+			}
+			if ma := matchAlgos[sym]; ma != nil &&
+				((isBuy && v.price >= last) || (!isBuy && v.price <= last)) {
+				// allocate whole level, fills in time priority
+				if levelSelfTrade(orB, order, isBuy, v.price) {
+					filled = true
+					break
+				}
+				// incoming may be decremented by self trade prevention
+				volume = order.Qty - order.Filled
+				level := levelOrders(orB, isBuy, v.price)
+				leaves := make([]int, len(level))
+				for i := range level {
+					leaves[i] = level[i].Qty - level[i].Filled
+				}
+				for i, q := range ma.allocate(leaves, volume) {
+					if q == 0 {
+						continue
+					}
+					rv := orB.find(&level[i])
+					tNo := nextTradeNo()
+					vol := setFill(rv, last, q, tNo)
+					mdTrade(sym, order.bBuy, last, vol, tNo)
+					orB.fill(rv, last, vol, tNo)
+					if rv.Filled >= rv.Qty {
+						orB.remove(rv)
+					}
+					setFill(order, last, vol, tNo)
+					volume -= vol
+				}
+				if volume == 0 {
+					filled = true
+					break
+				}
+				// orders removed out of order, restart iterator
+				orB.First(isBuy)
+				continue
+			}
 			if isBuy {
 				if v.price >= last {
 					// match
-					vol := setFill(v, last, volume)
+					tNo := nextTradeNo()
+					vol := setFill(v, last, volume, tNo)
+					mdTrade(sym, order.bBuy, last, vol, tNo)
+					orB.fill(v, last, vol, tNo)
 					if v.Filled >= v.Qty {
 						orB.RemoveFirst(isBuy)
 					}
-					setFill(order, last, vol)
+					setFill(order, last, vol, tNo)
 					volume -= vol
 					if volume == 0 {
 						filled = true
@@ -307,11 +511,14 @@ func tryMatchOrderBook(order *simOrderType) (filled bool) {
 			} else {
 				if v.price <= last {
 					// match
-					vol := setFill(v, last, volume)
+					tNo := nextTradeNo()
+					vol := setFill(v, last, volume, tNo)
+					mdTrade(sym, order.bBuy, last, vol, tNo)
+					orB.fill(v, last, vol, tNo)
 					if v.Filled >= v.Qty {
 						orB.RemoveFirst(isBuy)
 					}
-					setFill(order, last, vol)
+					setFill(order, last, vol, tNo)
 					volume -= vol
 					if volume == 0 {
 						filled = true
@@ -645,8 +852,9 @@ func MatchCross(sym string, pclose int) (last int, maxVol, volRemain int) {
 			maxVol += bidVol
 			volRemain = 0
 			if bP == aP {
-				// should be other bids/asks
+				// other bids/asks at worse price, end of cross
 				last = bP
+				aP = 0
 				break
 			}
 			oaP := aP
@@ -709,6 +917,14 @@ func MatchCrossFill(sym string, pclose int) (last int, maxVol, volRemain int) {
 	}
 	bestBid, bestAsk = bP, aP
 	log.Infof("MatchCrossFill BBS: %d/%d", bP, aP)
+	// execute vol of best bid and ask, levels and MBO published
+	fill := func(price, vol int) {
+		tNo := nextTradeNo()
+		for _, v := range []*simOrderType{bidOr, askOr} {
+			v.Filled += vol
+			orB.fill(v, price, vol, tNo)
+		}
+	}
 
 	for aP != 0 && bP >= aP {
 		switch {
@@ -717,26 +933,23 @@ func MatchCrossFill(sym string, pclose int) (last int, maxVol, volRemain int) {
 			bidVol -= askVol
 			volRemain = bidVol
 			last = aP
-			bidOr.Filled += askVol
-			askOr.Filled += askVol
+			fill(aP, askVol)
 			//ordersFilled = append(ordersFilled, askOr)
 			orB.RemoveFirst(false)
 			aP, askVol, askOr = getPriceVol(orB.Get(false))
 		case bidVol < askVol:
 			maxVol += bidVol
+			fill(bP, bidVol)
 			askVol -= bidVol
 			volRemain = askVol
 			last = bP
-			bidOr.Filled += askVol
-			askOr.Filled += askVol
 			//ordersFilled = append(ordersFilled, bidOr)
 			orB.RemoveFirst(true)
 			bP, bidVol, bidOr = getPriceVol(orB.Get(true))
 		case bidVol == askVol:
 			maxVol += bidVol
 			volRemain = 0
-			bidOr.Filled += askVol
-			askOr.Filled += askVol
+			fill(aP, askVol)
 			//ordersFilled = append(ordersFilled, bidOr)
 			orB.RemoveFirst(true)
 			//ordersFilled = append(ordersFilled, askOr)
@@ -821,27 +1034,75 @@ func MatchCrossFill(sym string, pclose int) (last int, maxVol, volRemain int) {
 	return
 }
 
+// SendOrder return zero if rejected by trading state or risk checks
 func SendOrder(sym string, bBuy bool, qty int, prc int) int {
+	ro := RiskOrder{Symbol: sym, IsBuy: bBuy, Qty: qty, Price: prc}
+	if err := checkRisk(&ro); err != nil {
+		log.Warning("SendOrder", err)
+		return 0
+	}
+	return sendOrder(sym, bBuy, qty, prc, 0, nil, nil)
+}
+
+// sendOrder origOid non zero for order replace origOid, ow nil for
+// anonymous order, opts nil for GTC order
+func sendOrder(sym string, bBuy bool, qty int, prc int, origOid int, ow *Owner, opts *OrderOpts) int {
+	if gtdWheel.n > 0 {
+		// expired GTD orders not matched between host ticks
+		ExpireOrders()
+	}
 	if orderNo >= maxOrders {
 		return 0
 	}
-	if simState == StateCallAuction || simState == StateStop {
+	if symbolAccept(sym) != nil {
 		// wrong trading state
 		return 0
 	}
-	var or = simOrderType{Symbol: sym, oid: orderNo + 1, price: prc, Qty: qty, bBuy: bBuy}
+	seqNo++
+	var or = simOrderType{Symbol: sym, oid: orderNo + 1, price: prc, Qty: qty, bBuy: bBuy,
+		seq: seqNo}
+	if ow != nil {
+		or.Owner = *ow
+	}
+	if opts != nil {
+		or.OrderOpts = *opts
+	}
 	simOrders[orderNo] = &or
 	orderNo++
-	if simState == StateTrading {
+	if origOid != 0 {
+		execPublish(ExecReplaced, &or, origOid)
+	} else {
+		execPublish(ExecNew, &or, 0)
+	}
+	if or.Dark {
+		if or.Tif == TifGTD {
+			gtdWheel.add(&or)
+		}
+		darkInsert(&or)
+		return or.oid
+	}
+	if SymbolState(sym) == StateTrading {
 		// check match first
-		if tryMatchOrderBook(&or) {
+		match := tryMatchOrderBook
+		if _, ok := spreads[sym]; ok {
+			match = matchSpread
+		}
+		if match(&or) {
 			// total filled
-			return orderNo
+			bookChanged(sym)
+			return or.oid
 		}
 	}
 	// put to orderBook
 	simInsertOrder(&or)
-	return orderNo
+	if or.Tif == TifGTD {
+		gtdWheel.add(&or)
+	}
+	if or.Peg != 0 {
+		pegOrders[sym] = append(pegOrders[sym], or.oid)
+	}
+	bookChanged(sym)
+	return or.oid
 }
 
 func CancelOrder(oid int) error {
@@ -852,10 +1113,93 @@ func CancelOrder(oid int) error {
 		return errNoOrder
 	}
 	or := simOrders[oid-1]
-	simRemoveOrder(or)
+	v := simRemoveOrder(or)
+	if v == nil {
+		return errCancelOrder
+	}
+	execPublish(ExecCanceled, v, 0)
+	bookChanged(or.Symbol)
+	return nil
+}
+
+// ReduceOrder lower open order quantity to qty, time priority kept
+func ReduceOrder(oid, qty int) error {
+	if simState == StateCallAuction {
+		return errState
+	}
+	if oid <= 0 || oid > orderNo {
+		return errNoOrder
+	}
+	or := simOrders[oid-1]
+	orB, ok := simOrderBook[or.Symbol]
+	if !ok {
+		return errReduceOrder
+	}
+	v := orB.reduce(or, qty)
+	if v == nil {
+		return errReduceOrder
+	}
+	or.Qty = qty
+	execPublish(ExecReplaced, v, oid)
+	bookChanged(or.Symbol)
 	return nil
 }
 
+// ReplaceOrder change order quantity and price, qty include filled volume
+// lower quantity with same price keep priority and oid, otherwise order
+// canceled and new order sent for left volume, return new oid
+func ReplaceOrder(oid, qty, price int) (int, error) {
+	return replaceOrder(oid, qty, price, "")
+}
+
+// replaceOrder clOrdID non empty identify order after replace
+func replaceOrder(oid, qty, price int, clOrdID string) (int, error) {
+	if simState == StateCallAuction || simState == StateStop {
+		return 0, errState
+	}
+	if oid <= 0 || oid > orderNo {
+		return 0, errNoOrder
+	}
+	or := simOrders[oid-1]
+	orB, ok := simOrderBook[or.Symbol]
+	if !ok {
+		return 0, errCancelOrder
+	}
+	v := orB.find(or)
+	if v == nil {
+		return 0, errCancelOrder
+	}
+	if qty <= v.Filled {
+		return 0, errReduceOrder
+	}
+	ow := or.Owner
+	if clOrdID != "" {
+		ow.ClOrdID = clOrdID
+	}
+	if price == v.price && qty <= v.Qty {
+		or.ClOrdID, v.ClOrdID = ow.ClOrdID, ow.ClOrdID
+		if qty == v.Qty {
+			return oid, nil
+		}
+		return oid, ReduceOrder(oid, qty)
+	}
+	left := qty - v.Filled
+	if err := symbolAccept(or.Symbol); err != nil {
+		return 0, err
+	}
+	ro := RiskOrder{Owner: ow, Symbol: or.Symbol, IsBuy: or.bBuy, Qty: left,
+		Price: price, ReplaceOid: oid}
+	if err := checkRisk(&ro); err != nil {
+		return 0, err
+	}
+	// original order must stay if replacement can't be entered
+	if orderNo >= maxOrders {
+		return 0, errOrderFull
+	}
+	orB.delete(v)
+	return sendOrder(or.Symbol, or.bBuy, left, price, oid, &ow, &or.OrderOpts), nil
+}
+
 //  `%{color}%{time:15:04:05.000} %{shortfunc} ▶ %{level:.4s} %{id:03x}%{color:reset} %{message}`
 func init() {
 	var format = logging.MustStringFormatter(
@@ -2,6 +2,7 @@ package auction
 
 import (
 	"math/rand"
+	"reflect"
 	"testing"
 	"time"
 
@@ -303,6 +304,25 @@ func TestMatchCross(t *testing.T) {
 	}
 }
 
+// equal volume crossed at single price with worse levels behind both sides
+// must end the cross at that price
+func TestMatchCrossEqualLevel(t *testing.T) {
+	instr := "cu1915"
+	cleanupOrderBook(instr)
+	simState = StatePreAuction
+	buildOrBook([]orderArgs{
+		{instr, true, 10, 43000},
+		{instr, true, 5, 42900},
+		{instr, false, 10, 43000},
+		{instr, false, 5, 43100},
+	})
+	last, maxVol, volRemain := MatchCross(instr, 40000)
+	if last != 43000 || maxVol != 10 || volRemain != 0 {
+		t.Errorf("MatchCross %d %d/%d, want 43000 10/0", last, maxVol, volRemain)
+	}
+	cleanupOrderBook(instr)
+}
+
 func TestMatchCrossFill(t *testing.T) {
 	type args struct {
 		sym    string
@@ -349,6 +369,46 @@ func TestMatchCrossFill(t *testing.T) {
 	}
 }
 
+// crossed volume leave level and MBO feeds
+func TestMatchCrossFillFeeds(t *testing.T) {
+	instr := "cu1918"
+	defer MdUnsubscribeAll()
+	defer MboUnsubscribeAll()
+	cleanupOrderBook(instr)
+	simState = StatePreAuction
+	book := NewMdBook(instr)
+	book.Recover()
+	MdSubscribe(func(md *MdUpdate) {
+		if md.Symbol == instr {
+			book.Apply(md)
+		}
+	})
+	mbo := mboBook{seq: mboSeqs[instr]}
+	MboSubscribe(func(u *MboUpdate) {
+		if u.Symbol == instr {
+			mbo.apply(t, u)
+		}
+	})
+	buildOrBook([]orderArgs{
+		{instr, true, 10, 43100},
+		{instr, true, 5, 43000},
+		{instr, false, 12, 42900},
+		{instr, false, 5, 43200},
+	})
+	MatchCrossFill(instr, 40000)
+	_, bids, asks := MdSnapshot(instr)
+	if !reflect.DeepEqual(bids, []PriceLevel{{43000, 3}}) ||
+		!reflect.DeepEqual(asks, []PriceLevel{{43200, 5}}) {
+		t.Errorf("levels after cross %v/%v", bids, asks)
+	}
+	checkMdBook(t, book)
+	mBids, mAsks := engineMboOrders(instr)
+	if !reflect.DeepEqual(mbo.bids, mBids) || !reflect.DeepEqual(mbo.asks, mAsks) {
+		t.Errorf("mbo book %v/%v, want %v/%v", mbo.bids, mbo.asks, mBids, mAsks)
+	}
+	cleanupOrderBook(instr)
+}
+
 func TestTraingContinue(t *testing.T) {
 	tests := []struct {
 		name string
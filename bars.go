@@ -0,0 +1,113 @@
+package auction
+
+import (
+	"time"
+)
+
+// Bar is OHLCV of trades, time bar or volume bar
+type Bar struct {
+	Symbol   string
+	Start    time.Time
+	Open     int
+	High     int
+	Low      int
+	Close    int
+	Volume   int
+	Turnover int
+	Vwap     float64
+	Count    int
+}
+
+type BarHandler func(bar *Bar)
+
+// BarBuilder aggregate MdTrade of one symbol into bars, block trades
+// excluded
+// time bars when period non zero, otherwise volume bars of barVol
+type BarBuilder struct {
+	sym     string
+	period  time.Duration
+	barVol  int
+	bar     Bar
+	handler BarHandler
+	mdSub   int
+}
+
+// NewTimeBars emit bars of sym every period, aligned to period
+// bar closed on first trade of next period or Flush
+func NewTimeBars(sym string, period time.Duration, fn BarHandler) *BarBuilder {
+	bb := &BarBuilder{sym: sym, period: period, handler: fn}
+	bb.mdSub = MdSubscribe(bb.onMd)
+	return bb
+}
+
+// NewVolumeBars emit bars of sym with volume barVol each, a trade
+// cross bar boundary split into following bars
+func NewVolumeBars(sym string, barVol int, fn BarHandler) *BarBuilder {
+	bb := &BarBuilder{sym: sym, barVol: barVol, handler: fn}
+	bb.mdSub = MdSubscribe(bb.onMd)
+	return bb
+}
+
+// Stop detach BarBuilder, partial bar is not emitted
+func (bb *BarBuilder) Stop() {
+	MdUnsubscribe(bb.mdSub)
+}
+
+// Flush emit partial bar, used at session end
+func (bb *BarBuilder) Flush() {
+	if bb.bar.Count == 0 {
+		return
+	}
+	bar := bb.bar
+	bb.bar = Bar{}
+	if bar.Volume > 0 {
+		bar.Vwap = float64(bar.Turnover) / float64(bar.Volume)
+	}
+	if bb.handler != nil {
+		bb.handler(&bar)
+	}
+}
+
+func (bb *BarBuilder) onMd(md *MdUpdate) {
+	if !md.lastPrice() || md.Symbol != bb.sym {
+		return
+	}
+	now := simClock()
+	if bb.period != 0 {
+		start := now.Truncate(bb.period)
+		if bb.bar.Count != 0 && !start.Equal(bb.bar.Start) {
+			bb.Flush()
+		}
+		bb.add(start, md.Price, md.Volume)
+		return
+	}
+	for vol := md.Volume; vol > 0; {
+		v := vol
+		if bb.barVol > 0 && bb.bar.Volume+v > bb.barVol {
+			v = bb.barVol - bb.bar.Volume
+		}
+		bb.add(now, md.Price, v)
+		vol -= v
+		if bb.barVol > 0 && bb.bar.Volume >= bb.barVol {
+			bb.Flush()
+		}
+	}
+}
+
+func (bb *BarBuilder) add(start time.Time, price, vol int) {
+	bar := &bb.bar
+	if bar.Count == 0 {
+		*bar = Bar{Symbol: bb.sym, Start: start, Open: price, High: price,
+			Low: price}
+	}
+	if price > bar.High {
+		bar.High = price
+	}
+	if price < bar.Low {
+		bar.Low = price
+	}
+	bar.Close = price
+	bar.Volume += vol
+	bar.Turnover += price * vol
+	bar.Count++
+}
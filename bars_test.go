@@ -0,0 +1,83 @@
+package auction
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBars(t *testing.T) {
+	instr := "cu1912"
+	defer MdUnsubscribeAll()
+	defer SetClock(nil)
+	now := time.Date(2019, 6, 3, 9, 0, 0, 0, time.Local)
+	SetClock(func() time.Time { return now })
+	cleanupOrderBook(instr)
+	// call auction, uncross at 43900
+	simState = StatePreAuction
+	buildOrBook(func() (res []orderArgs) {
+		for _, or := range orders1 {
+			or.sym = instr
+			res = append(res, or)
+		}
+		return
+	}())
+	var tBars, vBars []Bar
+	subs := len(mdHandlers)
+	tb := NewTimeBars(instr, time.Minute, func(bar *Bar) {
+		tBars = append(tBars, *bar)
+	})
+	vb := NewVolumeBars(instr, 50, func(bar *Bar) {
+		vBars = append(vBars, *bar)
+	})
+	now = now.Add(time.Second)
+	if last, vol, _ := Uncross(instr, 40000); last != 43900 || vol != 75 {
+		t.Errorf("Uncross %d/%d, want 43900/75", last, vol)
+	}
+	MarketStart(false)
+	now = now.Add(10 * time.Second)
+	// bids 43800x15, 43000x20 left, trade at take price
+	SendOrder(instr, false, 10, 43800)
+	now = now.Add(time.Minute)
+	SendOrder(instr, false, 20, 43000)
+	tb.Flush()
+	vb.Flush()
+	tb.Stop()
+	vb.Stop()
+	if len(mdHandlers) != subs {
+		t.Errorf("md handlers %d after Stop, want %d", len(mdHandlers), subs)
+	}
+	want := []Bar{
+		{Symbol: instr, Start: now.Add(-time.Minute).Truncate(time.Minute),
+			Open: 43900, High: 43900, Low: 43800, Close: 43800, Volume: 85,
+			Turnover: 43900*75 + 43800*10, Count: 2},
+		{Symbol: instr, Start: now.Truncate(time.Minute), Open: 43000,
+			High: 43000, Low: 43000, Close: 43000, Volume: 20,
+			Turnover: 43000 * 20, Count: 2},
+	}
+	for i := range want {
+		want[i].Vwap = float64(want[i].Turnover) / float64(want[i].Volume)
+	}
+	if len(tBars) != len(want) {
+		t.Fatalf("time bars %v, want %v", tBars, want)
+	}
+	for i := range want {
+		if tBars[i] != want[i] {
+			t.Errorf("time bar %d %+v, want %+v", i, tBars[i], want[i])
+		}
+	}
+	// 75 split 50/25, then 25+10+5+10, then 5
+	wantVol := []int{50, 50, 5}
+	if len(vBars) != len(wantVol) {
+		t.Fatalf("volume bars %v, want volumes %v", vBars, wantVol)
+	}
+	for i, v := range wantVol {
+		if vBars[i].Volume != v {
+			t.Errorf("volume bar %d volume %d, want %d", i, vBars[i].Volume, v)
+		}
+	}
+	if vBars[1].Count != 4 || vBars[1].Open != 43900 || vBars[1].Close != 43000 {
+		t.Errorf("volume bar 1 %+v", vBars[1])
+	}
+	cleanupOrderBook(instr)
+	MarketStop()
+}
@@ -0,0 +1,101 @@
+package auction
+
+import (
+	"sort"
+)
+
+// sides of CancelFilter
+const (
+	SideBuy = iota + 1
+	SideSell
+)
+
+// CancelFilter select open orders of MassCancel, empty or zero field
+// match all
+type CancelFilter struct {
+	Symbol  string
+	Account string
+	Trader  string
+	Side    int
+}
+
+func (f *CancelFilter) match(or *simOrderType) bool {
+	switch {
+	case f.Account != "" && or.Account != f.Account:
+		return false
+	case f.Trader != "" && or.Trader != f.Trader:
+		return false
+	case f.Side == SideBuy && !or.bBuy:
+		return false
+	case f.Side == SideSell && or.bBuy:
+		return false
+	}
+	return true
+}
+
+// killed accounts, new orders rejected until revived
+var killedAccounts = map[string]bool{}
+
+// MassCancel cancel open orders selected by f, each order canceled as
+// CancelOrder, return number of orders canceled
+func MassCancel(f CancelFilter) (int, error) {
+	if simState == StateCallAuction {
+		return 0, errState
+	}
+	var syms []string
+	for sym := range simOrderBook {
+		if f.Symbol == "" || sym == f.Symbol {
+			syms = append(syms, sym)
+		}
+	}
+	sort.Strings(syms)
+	var oids []int
+	for _, sym := range syms {
+		orB := simOrderBook[sym]
+		for _, isBuy := range []bool{true, false} {
+			orB.walk(isBuy, func(v *simOrderType) bool {
+				if f.match(v) {
+					oids = append(oids, v.oid)
+				}
+				return true
+			})
+		}
+	}
+	for _, sym := range sortedDarkSymbols() {
+		if f.Symbol != "" && sym != f.Symbol {
+			continue
+		}
+		for _, v := range darkOrders(sym) {
+			if f.match(v) {
+				oids = append(oids, v.oid)
+			}
+		}
+	}
+	n := 0
+	for _, oid := range oids {
+		if CancelOrder(oid) == nil {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// KillAccount cancel all open orders of account and reject its new orders
+// until ReviveAccount
+func KillAccount(account string) (int, error) {
+	if account == "" {
+		return 0, errClOrdID
+	}
+	killedAccounts[account] = true
+	return MassCancel(CancelFilter{Account: account})
+}
+
+// ReviveAccount accept new orders of killed account
+func ReviveAccount(account string) {
+	delete(killedAccounts, account)
+}
+
+// AccountKilled return true if kill switch of account active
+func AccountKilled(account string) bool {
+	return killedAccounts[account]
+}
@@ -0,0 +1,54 @@
+package auction
+
+import (
+	"testing"
+)
+
+func TestMassCancel(t *testing.T) {
+	defer ExecUnsubscribeAll()
+	for sym := range simOrderBook {
+		cleanupOrderBook(sym)
+	}
+	MarketStart(false)
+	canceled := map[int]bool{}
+	ExecSubscribe(func(er *ExecReport) {
+		if er.ExecType == ExecCanceled {
+			canceled[er.Oid] = true
+		}
+	})
+	ow := func(acc, trader, id string) Owner {
+		return Owner{Account: acc, Trader: trader, ClOrdID: id}
+	}
+	a1 := sendOwner(t, ow("MC1", "T1", "m1"), "cu1911", true, 1, 41000)
+	a2 := sendOwner(t, ow("MC1", "T2", "m2"), "cu1911", false, 1, 43000)
+	a3 := sendOwner(t, ow("MC1", "T1", "m3"), "cu1912", true, 1, 41000)
+	b1 := sendOwner(t, ow("MC2", "T3", "m4"), "cu1912", false, 1, 43000)
+	b2 := SendOrder("cu1912", true, 1, 40000)
+
+	if n, err := MassCancel(CancelFilter{Trader: "T1", Side: SideBuy,
+		Symbol: "cu1911"}); err != nil || n != 1 || !canceled[a1] {
+		t.Errorf("mass cancel by trader %d %v", n, err)
+	}
+	if n, _ := MassCancel(CancelFilter{Side: SideSell}); n != 2 || !canceled[a2] ||
+		!canceled[b1] {
+		t.Errorf("mass cancel sell side %d", n)
+	}
+	if n, _ := KillAccount("MC1"); n != 1 || !canceled[a3] || !AccountKilled("MC1") {
+		t.Errorf("KillAccount %d", n)
+	}
+	_, err := SendOrderOwner(ow("MC1", "T1", "m5"), "cu1912", true, 1, 41000)
+	expectRisk(t, err, "kill switch")
+	ReviveAccount("MC1")
+	sendOwner(t, ow("MC1", "T1", "m6"), "cu1912", true, 1, 41000)
+	if n, _ := MassCancel(CancelFilter{}); n != 2 || !canceled[b2] {
+		t.Errorf("cancel all %d", n)
+	}
+	if bids, asks := OrderBookLen("cu1912"); bids+asks != 0 {
+		t.Errorf("orderBook %d/%d after cancel all", bids, asks)
+	}
+	simState = StateCallAuction
+	if _, err := MassCancel(CancelFilter{}); err != errState {
+		t.Error("MassCancel in call auction", err)
+	}
+	MarketStop()
+}
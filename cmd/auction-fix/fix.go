@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	fixBeginString = "FIX.4.4"
+	fixSOH         = '\x01'
+	fixTimeFormat  = "20060102-15:04:05.000"
+)
+
+// FIX tags used by gateway
+const (
+	tagAccount          = 1
+	tagAvgPx            = 6
+	tagBeginSeqNo       = 7
+	tagBeginString      = 8
+	tagBodyLength       = 9
+	tagCheckSum         = 10
+	tagClOrdID          = 11
+	tagCommission       = 12
+	tagCommType         = 13
+	tagCumQty           = 14
+	tagEndSeqNo         = 16
+	tagExecID           = 17
+	tagExecInst         = 18
+	tagLastPx           = 31
+	tagLastQty          = 32
+	tagMsgSeqNum        = 34
+	tagMsgType          = 35
+	tagNewSeqNo         = 36
+	tagOrderID          = 37
+	tagOrderQty         = 38
+	tagOrdStatus        = 39
+	tagOrdType          = 40
+	tagOrigClOrdID      = 41
+	tagPossDupFlag      = 43
+	tagPrice            = 44
+	tagRefSeqNum        = 45
+	tagSenderCompID     = 49
+	tagSendingTime      = 52
+	tagSide             = 54
+	tagSymbol           = 55
+	tagTargetCompID     = 56
+	tagText             = 58
+	tagTimeInForce      = 59
+	tagEncryptMethod    = 98
+	tagCxlRejReason     = 102
+	tagOrdRejReason     = 103
+	tagHeartBtInt       = 108
+	tagPegOffsetValue   = 211
+	tagTestReqID        = 112
+	tagOrigSendingTime  = 122
+	tagGapFillFlag      = 123
+	tagExpireTime       = 126
+	tagResetSeqNumFlag  = 141
+	tagExecType         = 150
+	tagLeavesQty        = 151
+	tagRefMsgType       = 372
+	tagSessionRejReason = 373
+	tagCxlRejResponseTo = 434
+	tagLastLiquidityInd = 851
+	tagTrdMatchID       = 880
+)
+
+// FIX message types
+const (
+	msgHeartbeat          = "0"
+	msgTestRequest        = "1"
+	msgResendRequest      = "2"
+	msgReject             = "3"
+	msgSequenceReset      = "4"
+	msgLogout             = "5"
+	msgExecutionReport    = "8"
+	msgOrderCancelReject  = "9"
+	msgLogon              = "A"
+	msgNewOrderSingle     = "D"
+	msgOrderCancelRequest = "F"
+	msgOrderCancelReplace = "G"
+)
+
+// read limits checked before Logon, larger messages rejected not buffered
+const (
+	maxFixBody = 64 << 10
+	// BeginString, BodyLength or CheckSum field with SOH
+	maxFixField = 32
+)
+
+var (
+	errFixFormat   = errors.New("malformed FIX message")
+	errFixCheckSum = errors.New("FIX checksum mismatch")
+)
+
+type fixField struct {
+	tag int
+	val string
+}
+
+// fixMsg is FIX message without BeginString, BodyLength and CheckSum
+type fixMsg struct {
+	fields []fixField
+}
+
+func newFixMsg(msgType string) *fixMsg {
+	m := &fixMsg{}
+	m.Set(tagMsgType, msgType)
+	return m
+}
+
+func (m *fixMsg) MsgType() string {
+	return m.Get(tagMsgType)
+}
+
+func (m *fixMsg) Get(tag int) string {
+	for _, f := range m.fields {
+		if f.tag == tag {
+			return f.val
+		}
+	}
+	return ""
+}
+
+func (m *fixMsg) Has(tag int) bool {
+	for _, f := range m.fields {
+		if f.tag == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *fixMsg) GetInt(tag int) int {
+	v, _ := strconv.Atoi(m.Get(tag))
+	return v
+}
+
+// GetPrice parse price, round to int price of engine
+func (m *fixMsg) GetPrice(tag int) (int, error) {
+	v, err := strconv.ParseFloat(m.Get(tag), 64)
+	if err != nil {
+		return 0, err
+	}
+	if v < 0 {
+		return int(v - 0.5), nil
+	}
+	return int(v + 0.5), nil
+}
+
+// Set replace value of tag or append
+func (m *fixMsg) Set(tag int, val string) *fixMsg {
+	for i := range m.fields {
+		if m.fields[i].tag == tag {
+			m.fields[i].val = val
+			return m
+		}
+	}
+	m.fields = append(m.fields, fixField{tag, val})
+	return m
+}
+
+func (m *fixMsg) SetInt(tag, val int) *fixMsg {
+	return m.Set(tag, strconv.Itoa(val))
+}
+
+func (m *fixMsg) clone() *fixMsg {
+	res := &fixMsg{fields: make([]fixField, len(m.fields))}
+	copy(res.fields, m.fields)
+	return res
+}
+
+// standard header fields follow MsgType
+var fixHeaderTags = []int{tagSenderCompID, tagTargetCompID, tagMsgSeqNum,
+	tagPossDupFlag, tagSendingTime, tagOrigSendingTime}
+
+func isFixHeaderTag(tag int) bool {
+	switch tag {
+	case tagBeginString, tagBodyLength, tagCheckSum, tagMsgType:
+		return true
+	}
+	for _, t := range fixHeaderTags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Bytes encode message, MsgType and header first then body fields in order
+func (m *fixMsg) Bytes() []byte {
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "%d=%s%c", tagMsgType, m.MsgType(), fixSOH)
+	for _, tag := range fixHeaderTags {
+		if m.Has(tag) {
+			fmt.Fprintf(&body, "%d=%s%c", tag, m.Get(tag), fixSOH)
+		}
+	}
+	for _, f := range m.fields {
+		if isFixHeaderTag(f.tag) {
+			continue
+		}
+		fmt.Fprintf(&body, "%d=%s%c", f.tag, f.val, fixSOH)
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%d=%s%c%d=%d%c", tagBeginString, fixBeginString, fixSOH,
+		tagBodyLength, body.Len(), fixSOH)
+	buf.Write(body.Bytes())
+	fmt.Fprintf(&buf, "%d=%03d%c", tagCheckSum, fixCheckSum(buf.Bytes()), fixSOH)
+	return buf.Bytes()
+}
+
+func (m *fixMsg) String() string {
+	return strings.ReplaceAll(string(m.Bytes()), string(fixSOH), "|")
+}
+
+func fixCheckSum(b []byte) int {
+	sum := 0
+	for _, c := range b {
+		sum += int(c)
+	}
+	return sum % 256
+}
+
+func parseFixField(b []byte) (tag int, val string, err error) {
+	i := bytes.IndexByte(b, '=')
+	if i <= 0 {
+		return 0, "", errFixFormat
+	}
+	if tag, err = strconv.Atoi(string(b[:i])); err != nil {
+		return 0, "", errFixFormat
+	}
+	return tag, string(b[i+1:]), nil
+}
+
+// readFixMsg read one message, verify BodyLength and CheckSum
+func readFixMsg(rd *bufio.Reader) (*fixMsg, error) {
+	var raw bytes.Buffer
+	readField := func() (int, string, error) {
+		b, err := rd.ReadSlice(fixSOH)
+		if err == bufio.ErrBufferFull || len(b) > maxFixField {
+			return 0, "", errFixFormat
+		} else if err != nil {
+			return 0, "", err
+		}
+		raw.Write(b)
+		return parseFixField(b[:len(b)-1])
+	}
+	tag, val, err := readField()
+	if err != nil {
+		return nil, err
+	}
+	if tag != tagBeginString || val != fixBeginString {
+		return nil, errFixFormat
+	}
+	if tag, val, err = readField(); err != nil {
+		return nil, err
+	} else if tag != tagBodyLength {
+		return nil, errFixFormat
+	}
+	bodyLen, err := strconv.Atoi(val)
+	if err != nil || bodyLen <= 0 || bodyLen > maxFixBody {
+		return nil, errFixFormat
+	}
+	body := make([]byte, bodyLen)
+	if _, err := io.ReadFull(rd, body); err != nil {
+		return nil, err
+	}
+	raw.Write(body)
+	sum := fixCheckSum(raw.Bytes())
+	if tag, val, err = readField(); err != nil {
+		return nil, err
+	} else if tag != tagCheckSum {
+		return nil, errFixFormat
+	}
+	if v, err := strconv.Atoi(val); err != nil || v != sum {
+		return nil, errFixCheckSum
+	}
+	m := &fixMsg{}
+	for _, b := range bytes.Split(body, []byte{fixSOH}) {
+		if len(b) == 0 {
+			continue
+		}
+		tag, val, err := parseFixField(b)
+		if err != nil {
+			return nil, err
+		}
+		m.fields = append(m.fields, fixField{tag, val})
+	}
+	if m.MsgType() == "" {
+		return nil, errFixFormat
+	}
+	return m, nil
+}
+
+func fixTime(t time.Time) string {
+	return t.UTC().Format(fixTimeFormat)
+}
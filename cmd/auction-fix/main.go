@@ -0,0 +1,488 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	auction "github.com/kjx98/go-auction"
+	"github.com/op/go-logging"
+)
+
+var (
+	listenAddr string
+	compID     string
+	verbose    bool
+	preAuction bool
+	riskFile   string
+	cod        bool
+)
+
+var log = logging.MustGetLogger("auction-fix")
+
+var (
+	errTimeInForce = errors.New("unsupported TimeInForce")
+	errNotReplaced = errors.New("order not replaced")
+	errExpireTime  = errors.New("invalid ExpireTime of GTD order")
+	errPegType     = errors.New("ExecInst R, M or P required by pegged order")
+)
+
+// LastLiquidityInd of engine liquidity, added, removed or auction
+var liquidityInd = map[int]int{
+	auction.LiqMaker:   1,
+	auction.LiqTaker:   2,
+	auction.LiqAuction: 4,
+}
+
+// fixOrder is order of a FIX session, qty and cumQty in FIX meaning
+// engine order of a replaced order only hold volume left, cumBase is
+// cumQty when engine order sent
+type fixOrder struct {
+	st       *fixSessionState
+	account  string
+	clOrdID  string
+	oid      int
+	symbol   string
+	side     string
+	qty      int
+	price    int
+	cumQty   int
+	cumBase  int
+	turnover int
+	canceled bool
+	expired  bool
+	// TimeInForce, Day if not set
+	tif string
+	// ClOrdID of pending cancel/replace request
+	pendingID  string
+	pendingQty int
+	replaced   bool
+}
+
+func (or *fixOrder) ordStatus() string {
+	switch {
+	case or.expired:
+		return "C"
+	case or.canceled:
+		return "4"
+	case or.cumQty >= or.qty:
+		return "2"
+	case or.cumQty > 0:
+		return "1"
+	}
+	return "0"
+}
+
+func (or *fixOrder) leaves() int {
+	if or.canceled || or.cumQty >= or.qty {
+		return 0
+	}
+	return or.qty - or.cumQty
+}
+
+func (or *fixOrder) avgPx() string {
+	if or.cumQty == 0 {
+		return "0"
+	}
+	return strconv.FormatFloat(float64(or.turnover)/float64(or.cumQty), 'f', -1, 64)
+}
+
+// fixServer serialize engine access and all sessions with mu
+type fixServer struct {
+	mu           sync.Mutex
+	compID       string
+	logonTimeout time.Duration
+	states       map[string]*fixSessionState
+	owners       map[int]*fixOrder
+	// order sent to engine, bound to oid on ExecNew
+	pending *fixOrder
+	execID  int
+	ln      net.Listener
+	// cancel open orders of session when disconnected
+	cancelOnDisconnect bool
+}
+
+func newFixServer(compID string) *fixServer {
+	srv := &fixServer{compID: compID, logonTimeout: 10 * time.Second}
+	srv.states = map[string]*fixSessionState{}
+	srv.owners = map[int]*fixOrder{}
+	auction.ExecSubscribe(srv.onExec)
+	return srv
+}
+
+func (srv *fixServer) listen(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	srv.ln = ln
+	log.Info("FIX gateway listen on", ln.Addr())
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go srv.serve(conn)
+		}
+	}()
+	return nil
+}
+
+func (srv *fixServer) close() {
+	if srv.ln != nil {
+		srv.ln.Close()
+	}
+	srv.mu.Lock()
+	for _, st := range srv.states {
+		if st.conn != nil {
+			st.conn.logout("server shutdown")
+		}
+	}
+	srv.mu.Unlock()
+}
+
+func (srv *fixServer) newExecReport(or *fixOrder, execType string) *fixMsg {
+	srv.execID++
+	m := newFixMsg(msgExecutionReport)
+	if or.oid != 0 {
+		m.SetInt(tagOrderID, or.oid)
+	} else {
+		m.Set(tagOrderID, "NONE")
+	}
+	m.Set(tagClOrdID, or.clOrdID)
+	m.Set(tagAccount, or.account)
+	m.SetInt(tagExecID, srv.execID)
+	m.Set(tagExecType, execType)
+	m.Set(tagOrdStatus, or.ordStatus())
+	m.Set(tagSymbol, or.symbol)
+	m.Set(tagSide, or.side)
+	m.SetInt(tagOrderQty, or.qty)
+	m.SetInt(tagPrice, or.price)
+	m.SetInt(tagLeavesQty, or.leaves())
+	m.SetInt(tagCumQty, or.cumQty)
+	m.Set(tagAvgPx, or.avgPx())
+	m.Set(tagTimeInForce, or.tif)
+	return m
+}
+
+// pegInst map ExecInst of pegged order, primary, midpoint and market peg
+var pegInst = map[rune]int{'R': auction.PegPrimary, 'M': auction.PegMidpoint,
+	'P': auction.PegMarket}
+
+// timeInForce map TimeInForce of FIX to engine, Day if not set
+var timeInForce = map[string]int{"0": auction.TifDay, "1": auction.TifGTC,
+	"6": auction.TifGTD}
+
+// orderOpts parse TimeInForce, ExpireTime, ExecInst and peg of new order
+func (or *fixOrder) orderOpts(m *fixMsg) (auction.OrderOpts, error) {
+	var opts auction.OrderOpts
+	or.tif = m.Get(tagTimeInForce)
+	if or.tif == "" {
+		or.tif = "0"
+	}
+	tif, ok := timeInForce[or.tif]
+	if !ok {
+		return opts, errTimeInForce
+	}
+	opts.Tif = tif
+	if tif == auction.TifGTD {
+		t, err := time.Parse(fixTimeFormat, m.Get(tagExpireTime))
+		if err != nil {
+			return opts, errExpireTime
+		}
+		opts.ExpireTime = t
+	}
+	// ExecInst participate don't initiate, rejected if would cross
+	if strings.Contains(m.Get(tagExecInst), "6") {
+		opts.PostOnly = auction.PostOnlyReject
+	}
+	if m.Get(tagOrdType) == "P" {
+		for _, c := range m.Get(tagExecInst) {
+			if peg, ok := pegInst[c]; ok {
+				opts.Peg = peg
+			}
+		}
+		if opts.Peg == 0 {
+			return opts, errPegType
+		}
+		opts.PegOffset = m.GetInt(tagPegOffsetValue)
+	}
+	return opts, nil
+}
+
+func (srv *fixServer) rejectOrder(st *fixSessionState, or *fixOrder, reason, text string) {
+	or.canceled = true
+	m := srv.newExecReport(or, "8")
+	m.Set(tagOrdStatus, "8")
+	m.Set(tagOrdRejReason, reason)
+	m.Set(tagText, text)
+	st.send(srv, m)
+}
+
+func (srv *fixServer) cancelReject(st *fixSessionState, m *fixMsg, or *fixOrder,
+	responseTo, reason, text string) {
+	rej := newFixMsg(msgOrderCancelReject)
+	status := "8"
+	if or != nil {
+		rej.SetInt(tagOrderID, or.oid)
+		status = or.ordStatus()
+	} else {
+		rej.Set(tagOrderID, "NONE")
+	}
+	rej.Set(tagClOrdID, m.Get(tagClOrdID))
+	rej.Set(tagOrigClOrdID, m.Get(tagOrigClOrdID))
+	rej.Set(tagOrdStatus, status)
+	rej.Set(tagCxlRejResponseTo, responseTo)
+	rej.Set(tagCxlRejReason, reason)
+	rej.Set(tagText, text)
+	st.send(srv, rej)
+}
+
+func (srv *fixServer) onNewOrder(st *fixSessionState, m *fixMsg) {
+	or := &fixOrder{st: st, account: m.Get(tagAccount), clOrdID: m.Get(tagClOrdID),
+		symbol: m.Get(tagSymbol), side: m.Get(tagSide), qty: m.GetInt(tagOrderQty)}
+	// SenderCompID is account if Account not set
+	if or.account == "" {
+		or.account = st.compID
+	}
+	price, err := m.GetPrice(tagPrice)
+	or.price = price
+	opts, optErr := or.orderOpts(m)
+	switch {
+	case or.clOrdID == "":
+		srv.rejectOrder(st, or, "99", "missing ClOrdID")
+		return
+	case st.clOrds[or.clOrdID] != nil:
+		srv.rejectOrder(st, or, "6", "duplicate ClOrdID")
+		return
+	case or.side != "1" && or.side != "2":
+		srv.rejectOrder(st, or, "99", "unsupported Side")
+		return
+	case m.Get(tagOrdType) != "2" && m.Get(tagOrdType) != "P":
+		srv.rejectOrder(st, or, "99", "only limit and pegged order supported")
+		return
+	case or.symbol == "":
+		srv.rejectOrder(st, or, "1", "unknown symbol")
+		return
+	case or.qty <= 0:
+		srv.rejectOrder(st, or, "13", "incorrect quantity")
+		return
+	case (m.Get(tagOrdType) == "2" || m.Has(tagPrice)) && (err != nil || price <= 0):
+		// Price of pegged order is optional limit cap
+		srv.rejectOrder(st, or, "99", "invalid price")
+		return
+	case optErr != nil:
+		srv.rejectOrder(st, or, "99", optErr.Error())
+		return
+	}
+	srv.pending = or
+	ow := auction.Owner{Account: or.account, Trader: st.compID, ClOrdID: or.clOrdID}
+	oid, err := auction.SendOrderOpts(&ow, or.symbol, or.side == "1", or.qty,
+		or.price, opts)
+	srv.pending = nil
+	if _, ok := err.(*auction.RiskError); ok {
+		// order exceeds limit
+		srv.rejectOrder(st, or, "3", err.Error())
+	} else if err != nil {
+		srv.rejectOrder(st, or, "6", err.Error())
+	} else if oid == 0 {
+		srv.rejectOrder(st, or, "99", "order rejected by engine")
+	}
+}
+
+func (srv *fixServer) onCancel(st *fixSessionState, m *fixMsg) {
+	or := st.clOrds[m.Get(tagOrigClOrdID)]
+	if or == nil || or.oid == 0 {
+		srv.cancelReject(st, m, nil, "1", "1", "unknown order")
+		return
+	}
+	or.pendingID = m.Get(tagClOrdID)
+	if err := auction.CancelOrderOwner(or.account, or.oid); err != nil {
+		srv.cancelReject(st, m, or, "1", "0", err.Error())
+	}
+	or.pendingID = ""
+}
+
+func (srv *fixServer) onReplace(st *fixSessionState, m *fixMsg) {
+	or := st.clOrds[m.Get(tagOrigClOrdID)]
+	if or == nil || or.oid == 0 {
+		srv.cancelReject(st, m, nil, "2", "1", "unknown order")
+		return
+	}
+	qty := m.GetInt(tagOrderQty)
+	price, err := m.GetPrice(tagPrice)
+	if err != nil || price <= 0 || qty <= 0 {
+		srv.cancelReject(st, m, or, "2", "99", "invalid price or quantity")
+		return
+	}
+	if m.Get(tagSide) != "" && m.Get(tagSide) != or.side {
+		srv.cancelReject(st, m, or, "2", "99", "Side can't be changed")
+		return
+	}
+	or.pendingID = m.Get(tagClOrdID)
+	or.pendingQty = qty
+	or.replaced = false
+	oid, err := auction.ReplaceOrderOwner(or.account, or.oid, or.pendingID,
+		qty-or.cumBase, price)
+	if err == nil && oid == 0 {
+		err = errNotReplaced
+	}
+	if err != nil {
+		srv.cancelReject(st, m, or, "2", "0", err.Error())
+	} else if !or.replaced {
+		// nothing changed in engine
+		srv.replaced(or, or.oid, price)
+	}
+	or.pendingID = ""
+}
+
+// replaced report replace done, update order with new ClOrdID
+func (srv *fixServer) replaced(or *fixOrder, oid, price int) {
+	origID := or.clOrdID
+	or.replaced = true
+	if oid != or.oid {
+		delete(srv.owners, or.oid)
+		srv.owners[oid] = or
+		or.oid = oid
+		or.cumBase = or.cumQty
+	}
+	or.qty = or.pendingQty
+	or.price = price
+	or.clOrdID = or.pendingID
+	or.st.clOrds[or.clOrdID] = or
+	m := srv.newExecReport(or, "5")
+	m.Set(tagOrigClOrdID, origID)
+	or.st.send(srv, m)
+}
+
+// onExec route engine execution reports to owner session, hold mu
+func (srv *fixServer) onExec(er *auction.ExecReport) {
+	if er.ExecType == auction.ExecNew {
+		or := srv.pending
+		if or == nil {
+			return
+		}
+		srv.pending = nil
+		or.oid = er.Oid
+		// price of pegged order set by engine
+		or.price = er.Price
+		srv.owners[er.Oid] = or
+		or.st.clOrds[or.clOrdID] = or
+		or.st.send(srv, srv.newExecReport(or, "0"))
+		return
+	}
+	if er.ExecType == auction.ExecReplaced {
+		or, ok := srv.owners[er.OrigOid]
+		if ok && or.pendingID != "" {
+			srv.replaced(or, er.Oid, er.Price)
+		} else if ok && er.Oid == er.OrigOid && er.Price != or.price {
+			// pegged order repriced
+			or.price = er.Price
+			or.st.send(srv, srv.newExecReport(or, "D"))
+		}
+		return
+	}
+	or, ok := srv.owners[er.Oid]
+	if !ok {
+		return
+	}
+	switch er.ExecType {
+	case auction.ExecFill:
+		or.cumQty += er.LastQty
+		or.turnover += er.LastQty * er.LastPrice
+		m := srv.newExecReport(or, "F")
+		m.SetInt(tagLastQty, er.LastQty)
+		m.SetInt(tagLastPx, er.LastPrice)
+		m.SetInt(tagTrdMatchID, er.TradeNo)
+		m.SetInt(tagLastLiquidityInd, liquidityInd[er.Liquidity])
+		// absolute commission, negative for rebate
+		m.SetInt(tagCommission, er.Fee)
+		m.Set(tagCommType, "3")
+		or.st.send(srv, m)
+	case auction.ExecCanceled:
+		or.canceled = true
+		origID := or.clOrdID
+		if or.pendingID != "" {
+			or.clOrdID = or.pendingID
+			or.st.clOrds[or.clOrdID] = or
+		}
+		m := srv.newExecReport(or, "4")
+		m.Set(tagOrigClOrdID, origID)
+		or.st.send(srv, m)
+	case auction.ExecExpired:
+		or.canceled = true
+		or.expired = true
+		or.st.send(srv, srv.newExecReport(or, "C"))
+	}
+}
+
+// expireOrders run GTD expiry of engine every interval
+func (srv *fixServer) expireOrders(interval time.Duration) {
+	go func() {
+		for range time.Tick(interval) {
+			srv.mu.Lock()
+			auction.ExpireOrders()
+			srv.mu.Unlock()
+		}
+	}()
+}
+
+func main() {
+	flag.StringVar(&listenAddr, "addr", ":9878", "FIX listen address")
+	flag.StringVar(&compID, "comp", "AUCTION", "SenderCompID of gateway")
+	flag.BoolVar(&preAuction, "pre", false, "start in pre auction, no matching")
+	flag.BoolVar(&verbose, "v", false, "verbose log")
+	flag.BoolVar(&cod, "cod", false, "cancel open orders of session on disconnect")
+	flag.StringVar(&riskFile, "risk", "", "JSON risk limits by account, reload on SIGHUP")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: auction-fix [options]\n")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+	flag.Parse()
+	if !verbose {
+		logging.SetLevel(logging.WARNING, "go-auction")
+	}
+	if !preAuction {
+		auction.MarketStart(true)
+	}
+	srv := newFixServer(compID)
+	srv.cancelOnDisconnect = cod
+	srv.expireOrders(time.Second)
+	if riskFile != "" {
+		if err := srv.reloadRisk(riskFile); err != nil {
+			log.Error("risk limits", err)
+			os.Exit(1)
+		}
+		srv.watchRisk(riskFile)
+	}
+	if err := srv.listen(listenAddr); err != nil {
+		log.Error("listen", err)
+		os.Exit(1)
+	}
+	select {}
+}
+
+// `%{color}%{time:15:04:05.000} %{shortfunc} ▶ %{level:.4s} %{id:03x}%{color:reset} %{message}`
+func init() {
+	var format = logging.MustStringFormatter(
+		`%{color}%{time:01-02 15:04:05}  ▶ %{level:.4s} %{color:reset} %{message}`,
+	)
+
+	if runtime.GOARCH != "amd64" {
+		format = logging.MustStringFormatter(
+			`%{time:01-02 15:04:05} %{level:.4s} %{message}`,
+		)
+	}
+	logback := logging.NewLogBackend(os.Stderr, "", 0)
+	logfmt := logging.NewBackendFormatter(logback, format)
+	logging.SetBackend(logfmt)
+}
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	auction "github.com/kjx98/go-auction"
+	"github.com/op/go-logging"
+)
+
+var testSrv *fixServer
+
+func TestMain(m *testing.M) {
+	logging.SetLevel(logging.ERROR, "go-auction")
+	logging.SetLevel(logging.ERROR, "auction-fix")
+	auction.MarketStart(true)
+	testSrv = newFixServer("AUCTION")
+	if err := testSrv.listen("127.0.0.1:0"); err != nil {
+		panic(err)
+	}
+	res := m.Run()
+	testSrv.close()
+	os.Exit(res)
+}
+
+// fixClient is loopback FIX client for test
+type fixClient struct {
+	t      *testing.T
+	compID string
+	conn   net.Conn
+	rd     *bufio.Reader
+	seq    int
+}
+
+func dialFix(t *testing.T, compID string, hbInt int, reset bool) *fixClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", testSrv.ln.Addr().String())
+	if err != nil {
+		t.Fatal("dial", err)
+	}
+	c := &fixClient{t: t, compID: compID, conn: conn, rd: bufio.NewReader(conn), seq: 1}
+	logon := newFixMsg(msgLogon).Set(tagEncryptMethod, "0").SetInt(tagHeartBtInt, hbInt)
+	if reset {
+		logon.Set(tagResetSeqNumFlag, "Y")
+	}
+	c.send(logon)
+	c.expect(msgLogon)
+	return c
+}
+
+func (c *fixClient) send(m *fixMsg) {
+	c.t.Helper()
+	m.Set(tagSenderCompID, c.compID).Set(tagTargetCompID, "AUCTION")
+	if !m.Has(tagMsgSeqNum) {
+		m.SetInt(tagMsgSeqNum, c.seq)
+		c.seq++
+	}
+	m.Set(tagSendingTime, fixTime(time.Now()))
+	if _, err := c.conn.Write(m.Bytes()); err != nil {
+		c.t.Fatal("write", err)
+	}
+}
+
+func (c *fixClient) recv() *fixMsg {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	m, err := readFixMsg(c.rd)
+	if err != nil {
+		c.t.Fatal(c.compID, "read", err)
+	}
+	return m
+}
+
+// expect next message of msgType, heartbeat skipped
+func (c *fixClient) expect(msgType string) *fixMsg {
+	c.t.Helper()
+	for {
+		m := c.recv()
+		if m.MsgType() == msgHeartbeat && msgType != msgHeartbeat {
+			continue
+		}
+		if m.MsgType() != msgType {
+			c.t.Fatalf("%s got %s, want MsgType %s", c.compID, m, msgType)
+		}
+		return m
+	}
+}
+
+func (c *fixClient) expectExec(execType, ordStatus string) *fixMsg {
+	c.t.Helper()
+	m := c.expect(msgExecutionReport)
+	if m.Get(tagExecType) != execType || m.Get(tagOrdStatus) != ordStatus {
+		c.t.Fatalf("%s got %s, want ExecType %s OrdStatus %s", c.compID, m,
+			execType, ordStatus)
+	}
+	return m
+}
+
+func (c *fixClient) close() {
+	c.conn.Close()
+}
+
+func newOrderSingle(clOrdID, sym, side string, qty, price int) *fixMsg {
+	m := newFixMsg(msgNewOrderSingle).Set(tagClOrdID, clOrdID).Set(tagSymbol, sym)
+	m.Set(tagSide, side).SetInt(tagOrderQty, qty).Set(tagOrdType, "2")
+	return m.SetInt(tagPrice, price)
+}
+
+func checkTags(t *testing.T, m *fixMsg, want map[int]string) {
+	t.Helper()
+	for tag, v := range want {
+		if m.Get(tag) != v {
+			t.Errorf("tag %d = %s, want %s in %s", tag, m.Get(tag), v, m)
+		}
+	}
+}
+
+func TestFixMsgCodec(t *testing.T) {
+	m := newOrderSingle("c1", "cu1908", "1", 10, 43000)
+	m.Set(tagSenderCompID, "CLI").SetInt(tagMsgSeqNum, 3)
+	b := m.Bytes()
+	got, err := readFixMsg(bufio.NewReader(bytes.NewReader(b)))
+	if err != nil {
+		t.Fatal("readFixMsg", err)
+	}
+	if got.String() != m.String() {
+		t.Errorf("decode %s, want %s", got, m)
+	}
+	b[len(b)-3] = '9'
+	if _, err := readFixMsg(bufio.NewReader(bytes.NewReader(b))); err != errFixCheckSum {
+		t.Errorf("bad checksum error %v", err)
+	}
+	// oversized body or header field rejected before read
+	for _, raw := range []string{"8=FIX.4.4\x019=2000000000\x01",
+		"8=FIX.4.4\x019=" + strings.Repeat("0", 5000) + "\x01"} {
+		if _, err := readFixMsg(bufio.NewReader(strings.NewReader(raw))); err != errFixFormat {
+			t.Errorf("oversized message error %v", err)
+		}
+	}
+}
+
+func TestFixOrderFlow(t *testing.T) {
+	sym := "cu1908"
+	a := dialFix(t, "CLIA", 30, true)
+	defer a.close()
+	b := dialFix(t, "CLIB", 30, true)
+	defer b.close()
+	a.send(newOrderSingle("a1", sym, "1", 10, 43000))
+	er := a.expectExec("0", "0")
+	checkTags(t, er, map[int]string{tagClOrdID: "a1", tagLeavesQty: "10"})
+	b.send(newOrderSingle("b1", sym, "2", 15, 42900))
+	b.expectExec("0", "0")
+	er = b.expectExec("F", "1")
+	checkTags(t, er, map[int]string{tagLastQty: "10", tagLastPx: "42900",
+		tagCumQty: "10", tagLeavesQty: "5", tagLastLiquidityInd: "2",
+		tagCommission: "0"})
+	er = a.expectExec("F", "2")
+	checkTags(t, er, map[int]string{tagClOrdID: "a1", tagCumQty: "10",
+		tagLeavesQty: "0", tagAvgPx: "42900"})
+	// cancel rest of b1
+	b.send(newFixMsg(msgOrderCancelRequest).Set(tagOrigClOrdID, "b1").
+		Set(tagClOrdID, "b2").Set(tagSymbol, sym).Set(tagSide, "2"))
+	er = b.expectExec("4", "4")
+	checkTags(t, er, map[int]string{tagClOrdID: "b2", tagOrigClOrdID: "b1",
+		tagCumQty: "10", tagLeavesQty: "0"})
+	// filled order can't be canceled
+	a.send(newFixMsg(msgOrderCancelRequest).Set(tagOrigClOrdID, "a1").
+		Set(tagClOrdID, "a2").Set(tagSymbol, sym).Set(tagSide, "1"))
+	rej := a.expect(msgOrderCancelReject)
+	checkTags(t, rej, map[int]string{tagOrigClOrdID: "a1", tagOrdStatus: "2",
+		tagCxlRejResponseTo: "1"})
+	// unknown order
+	a.send(newFixMsg(msgOrderCancelRequest).Set(tagOrigClOrdID, "xx").
+		Set(tagClOrdID, "a3").Set(tagSymbol, sym).Set(tagSide, "1"))
+	rej = a.expect(msgOrderCancelReject)
+	checkTags(t, rej, map[int]string{tagCxlRejReason: "1"})
+	// duplicate ClOrdID and market order rejected
+	a.send(newOrderSingle("a1", sym, "1", 10, 43000))
+	er = a.expectExec("8", "8")
+	checkTags(t, er, map[int]string{tagOrdRejReason: "6"})
+	a.send(newOrderSingle("a4", sym, "1", 10, 43000).Set(tagOrdType, "1"))
+	a.expectExec("8", "8")
+}
+
+func TestFixReplace(t *testing.T) {
+	sym := "cu1909"
+	a := dialFix(t, "CLIE", 30, true)
+	defer a.close()
+	b := dialFix(t, "CLIF", 30, true)
+	defer b.close()
+	a.send(newOrderSingle("r1", sym, "1", 10, 42000))
+	oid := a.expectExec("0", "0").Get(tagOrderID)
+	b.send(newOrderSingle("s1", sym, "2", 4, 42000))
+	b.expectExec("0", "0")
+	b.expectExec("F", "2")
+	a.expectExec("F", "1")
+	replace := func(orig, id string, qty, price int) {
+		a.send(newFixMsg(msgOrderCancelReplace).Set(tagOrigClOrdID, orig).
+			Set(tagClOrdID, id).Set(tagSymbol, sym).Set(tagSide, "1").
+			Set(tagOrdType, "2").SetInt(tagOrderQty, qty).SetInt(tagPrice, price))
+	}
+	// reduce in place keep OrderID
+	replace("r1", "r2", 8, 42000)
+	er := a.expectExec("5", "1")
+	checkTags(t, er, map[int]string{tagOrderID: oid, tagClOrdID: "r2",
+		tagOrigClOrdID: "r1", tagOrderQty: "8", tagCumQty: "4", tagLeavesQty: "4"})
+	// price change, new OrderID
+	replace("r2", "r3", 9, 42100)
+	er = a.expectExec("5", "1")
+	checkTags(t, er, map[int]string{tagClOrdID: "r3", tagOrigClOrdID: "r2",
+		tagOrderQty: "9", tagPrice: "42100", tagCumQty: "4", tagLeavesQty: "5"})
+	if er.Get(tagOrderID) == oid {
+		t.Error("price replaced should have new OrderID")
+	}
+	b.send(newOrderSingle("s2", sym, "2", 10, 42100))
+	b.expectExec("0", "0")
+	b.expectExec("F", "1")
+	er = a.expectExec("F", "2")
+	checkTags(t, er, map[int]string{tagClOrdID: "r3", tagCumQty: "9",
+		tagLeavesQty: "0", tagLastQty: "5"})
+	// can't reduce below filled
+	replace("r3", "r4", 3, 42100)
+	rej := a.expect(msgOrderCancelReject)
+	checkTags(t, rej, map[int]string{tagCxlRejResponseTo: "2"})
+}
+
+func TestFixSession(t *testing.T) {
+	c := dialFix(t, "CLIC", 30, true)
+	c.send(newFixMsg(msgTestRequest).Set(tagTestReqID, "T1"))
+	hb := c.expect(msgHeartbeat)
+	checkTags(t, hb, map[int]string{tagTestReqID: "T1"})
+	c.send(newOrderSingle("c1", "cu1910", "1", 10, 40000))
+	c.expectExec("0", "0")
+	// skip MsgSeqNum 4, server ask resend from 4
+	c.seq++
+	c.send(newFixMsg(msgTestRequest).Set(tagTestReqID, "T2"))
+	rr := c.expect(msgResendRequest)
+	checkTags(t, rr, map[int]string{tagBeginSeqNo: "4", tagEndSeqNo: "0"})
+	gf := newFixMsg(msgSequenceReset).Set(tagGapFillFlag, "Y").SetInt(tagMsgSeqNum, 4)
+	gf.Set(tagPossDupFlag, "Y").SetInt(tagNewSeqNo, 6)
+	c.send(gf)
+	c.send(newFixMsg(msgTestRequest).Set(tagTestReqID, "T3"))
+	hb = c.expect(msgHeartbeat)
+	checkTags(t, hb, map[int]string{tagTestReqID: "T3"})
+	// ask server resend all, admin messages gap filled
+	c.send(newFixMsg(msgResendRequest).SetInt(tagBeginSeqNo, 1).SetInt(tagEndSeqNo, 0))
+	gap := c.expect(msgSequenceReset)
+	checkTags(t, gap, map[int]string{tagMsgSeqNum: "1", tagGapFillFlag: "Y",
+		tagNewSeqNo: "3"})
+	er := c.expectExec("0", "0")
+	checkTags(t, er, map[int]string{tagMsgSeqNum: "3", tagPossDupFlag: "Y",
+		tagClOrdID: "c1"})
+	gap = c.expect(msgSequenceReset)
+	checkTags(t, gap, map[int]string{tagMsgSeqNum: "4", tagNewSeqNo: "6"})
+	// logout, reconnect keep sequence numbers
+	c.send(newFixMsg(msgLogout))
+	c.expect(msgLogout)
+	c.close()
+	seq := c.seq
+	time.Sleep(50 * time.Millisecond)
+	c = dialFixSeq(t, "CLIC", seq)
+	defer c.close()
+	if c.seq != seq+1 {
+		t.Errorf("seq %d, want %d", c.seq, seq+1)
+	}
+	c.send(newFixMsg(msgOrderCancelRequest).Set(tagOrigClOrdID, "c1").
+		Set(tagClOrdID, "c2").Set(tagSymbol, "cu1910").Set(tagSide, "1"))
+	c.expectExec("4", "4")
+}
+
+func dialFixSeq(t *testing.T, compID string, seq int) *fixClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", testSrv.ln.Addr().String())
+	if err != nil {
+		t.Fatal("dial", err)
+	}
+	c := &fixClient{t: t, compID: compID, conn: conn, rd: bufio.NewReader(conn), seq: seq}
+	c.send(newFixMsg(msgLogon).Set(tagEncryptMethod, "0").SetInt(tagHeartBtInt, 30))
+	if m := c.expect(msgLogon); m.GetInt(tagMsgSeqNum) != 7 {
+		t.Errorf("Logon MsgSeqNum %s, want 7", m.Get(tagMsgSeqNum))
+	}
+	return c
+}
+
+func TestFixHeartbeat(t *testing.T) {
+	c := dialFix(t, "CLID", 1, true)
+	defer c.close()
+	start := time.Now()
+	c.expect(msgHeartbeat)
+	if du := time.Since(start); du < 500*time.Millisecond {
+		t.Errorf("Heartbeat after %v, want about 1s", du)
+	}
+	// no answer, server send TestRequest
+	tr := c.expect(msgTestRequest)
+	hb := newFixMsg(msgHeartbeat).Set(tagTestReqID, tr.Get(tagTestReqID))
+	c.send(hb)
+}
+
+func TestCancelOnDisconnect(t *testing.T) {
+	sym := "cu1912"
+	testSrv.mu.Lock()
+	testSrv.cancelOnDisconnect = true
+	testSrv.mu.Unlock()
+	defer func() {
+		testSrv.mu.Lock()
+		testSrv.cancelOnDisconnect = false
+		testSrv.mu.Unlock()
+	}()
+	c := dialFix(t, "CLIE", 30, true)
+	c.send(newOrderSingle("e1", sym, "2", 3, 45000))
+	c.expectExec("0", "0")
+	c.close()
+	for i := 0; ; i++ {
+		testSrv.mu.Lock()
+		_, asks := auction.OrderBookLen(sym)
+		testSrv.mu.Unlock()
+		if asks == 0 {
+			break
+		}
+		if i >= 100 {
+			t.Fatal("order not canceled on disconnect")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestFixExpire(t *testing.T) {
+	sym := "cu1909"
+	now := time.Now()
+	c := dialFix(t, "CLIF", 30, true)
+	defer c.close()
+	m := newOrderSingle("x1", sym, "1", 2, 41000).Set(tagTimeInForce, "6")
+	c.send(m)
+	checkTags(t, c.expectExec("8", "8"), map[int]string{tagClOrdID: "x1"})
+	m = newOrderSingle("x2", sym, "1", 2, 41000).Set(tagTimeInForce, "6").
+		Set(tagExpireTime, fixTime(now.Add(2*time.Second)))
+	c.send(m)
+	checkTags(t, c.expectExec("0", "0"), map[int]string{tagTimeInForce: "6"})
+	testSrv.mu.Lock()
+	auction.SetClock(func() time.Time { return now.Add(3 * time.Second) })
+	n := auction.ExpireOrders()
+	auction.SetClock(nil)
+	testSrv.mu.Unlock()
+	if n != 1 {
+		t.Errorf("%d orders expired", n)
+	}
+	checkTags(t, c.expectExec("C", "C"), map[int]string{tagClOrdID: "x2",
+		tagLeavesQty: "0"})
+}
+
+func TestFixPostOnly(t *testing.T) {
+	sym := "cu1908"
+	c := dialFix(t, "CLIG", 30, true)
+	defer c.close()
+	c.send(newOrderSingle("q1", sym, "2", 1, 43000))
+	c.expectExec("0", "0")
+	c.send(newOrderSingle("q2", sym, "1", 1, 43000).Set(tagExecInst, "6"))
+	c.expectExec("0", "0")
+	checkTags(t, c.expectExec("4", "4"), map[int]string{tagClOrdID: "q2",
+		tagLeavesQty: "0"})
+	testSrv.mu.Lock()
+	_, asks := auction.OrderBookLen(sym)
+	testSrv.mu.Unlock()
+	if asks != 1 {
+		t.Errorf("post-only order matched, asks %d", asks)
+	}
+}
+
+func TestFixPegged(t *testing.T) {
+	sym := "cu1907"
+	c := dialFix(t, "CLIH", 30, true)
+	defer c.close()
+	c.send(newOrderSingle("r1", sym, "1", 1, 43000))
+	c.expectExec("0", "0")
+	m := newOrderSingle("r2", sym, "1", 1, 43005).Set(tagOrdType, "P").
+		Set(tagExecInst, "R").SetInt(tagPegOffsetValue, 10)
+	c.send(m)
+	checkTags(t, c.expectExec("0", "0"), map[int]string{tagPrice: "43005"})
+	c.send(newOrderSingle("r3", sym, "1", 1, 42990).Set(tagOrdType, "P"))
+	c.expectExec("8", "8")
+	c.send(newOrderSingle("r4", sym, "1", 1, 42980))
+	c.expectExec("0", "0")
+	// capped below reference price
+	c.send(newOrderSingle("r5", sym, "1", 1, 42990).Set(tagOrdType, "P").
+		Set(tagExecInst, "R"))
+	checkTags(t, c.expectExec("0", "0"), map[int]string{tagPrice: "42990"})
+	c.send(newFixMsg(msgOrderCancelRequest).Set(tagOrigClOrdID, "r1").
+		Set(tagClOrdID, "r6").Set(tagSymbol, sym).Set(tagSide, "1"))
+	c.expectExec("4", "4")
+	// both pegs follow best bid 42980
+	checkTags(t, c.expectExec("D", "0"), map[int]string{tagClOrdID: "r2",
+		tagPrice: "42990"})
+	checkTags(t, c.expectExec("D", "0"), map[int]string{tagClOrdID: "r5",
+		tagPrice: "42980"})
+}
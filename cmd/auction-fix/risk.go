@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"os/signal"
+	"syscall"
+
+	auction "github.com/kjx98/go-auction"
+)
+
+// loadRisk read risk limits by account from JSON file, e.g.
+// {"ACC1": {"MaxOrderQty": 100, "CreditLimit": 10000000}}
+func loadRisk(path string) (map[string]auction.RiskLimits, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var limits map[string]auction.RiskLimits
+	if err := json.NewDecoder(f).Decode(&limits); err != nil {
+		return nil, err
+	}
+	return limits, nil
+}
+
+// reloadRisk replace risk limits of engine, limits kept if file invalid
+func (srv *fixServer) reloadRisk(path string) error {
+	limits, err := loadRisk(path)
+	if err != nil {
+		return err
+	}
+	srv.mu.Lock()
+	auction.ReloadRiskLimits(limits)
+	srv.mu.Unlock()
+	log.Infof("risk limits of %d accounts loaded from %s", len(limits), path)
+	return nil
+}
+
+// watchRisk reload risk limits on SIGHUP
+func (srv *fixServer) watchRisk(path string) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	go func() {
+		for range ch {
+			if err := srv.reloadRisk(path); err != nil {
+				log.Error("reload risk limits", err)
+			}
+		}
+	}()
+}
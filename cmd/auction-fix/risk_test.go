@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	auction "github.com/kjx98/go-auction"
+)
+
+func TestFixRisk(t *testing.T) {
+	sym := "cu1910"
+	path := filepath.Join(t.TempDir(), "risk.json")
+	if err := os.WriteFile(path, []byte(`{"CLIR": {"MaxOrderQty": 5}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer auction.ReloadRiskLimits(nil)
+	if err := testSrv.reloadRisk(path); err != nil {
+		t.Fatal("reloadRisk", err)
+	}
+	c := dialFix(t, "CLIR", 30, true)
+	defer c.close()
+	c.send(newOrderSingle("r1", sym, "1", 6, 42000))
+	er := c.expectExec("8", "8")
+	checkTags(t, er, map[int]string{tagOrdRejReason: "3"})
+	c.send(newOrderSingle("r2", sym, "1", 5, 42000))
+	c.expectExec("0", "0")
+	// invalid file keep limits loaded
+	os.WriteFile(path, []byte(`{`), 0644)
+	if err := testSrv.reloadRisk(path); err == nil {
+		t.Error("reloadRisk of invalid file should fail")
+	}
+	if lim, ok := auction.GetRiskLimits("CLIR"); !ok || lim.MaxOrderQty != 5 {
+		t.Errorf("risk limits %+v %v", lim, ok)
+	}
+}
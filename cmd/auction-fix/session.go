@@ -0,0 +1,372 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"time"
+
+	auction "github.com/kjx98/go-auction"
+)
+
+// fixSessionState survive reconnect of same SenderCompID
+type fixSessionState struct {
+	compID string
+	// next expected incoming and next outgoing MsgSeqNum
+	inSeq  int
+	outSeq int
+	sent   map[int]*fixMsg
+	clOrds map[string]*fixOrder
+	conn   *fixConn
+}
+
+func newFixSessionState(compID string) *fixSessionState {
+	st := fixSessionState{compID: compID}
+	st.reset()
+	st.clOrds = map[string]*fixOrder{}
+	return &st
+}
+
+func (st *fixSessionState) reset() {
+	st.inSeq = 1
+	st.outSeq = 1
+	st.sent = map[int]*fixMsg{}
+}
+
+// fixConn is one TCP connection of a logged on session
+type fixConn struct {
+	srv      *fixServer
+	st       *fixSessionState
+	conn     net.Conn
+	out      chan []byte
+	hbInt    time.Duration
+	lastRecv time.Time
+	lastSent time.Time
+	// TestReqID sent and not answered
+	testReqID     string
+	resendPending bool
+	closed        bool
+}
+
+const fixOutQueue = 4096
+
+func isAdminMsg(msgType string) bool {
+	switch msgType {
+	case msgHeartbeat, msgTestRequest, msgResendRequest, msgReject,
+		msgSequenceReset, msgLogout, msgLogon:
+		return true
+	}
+	return false
+}
+
+// send message with next MsgSeqNum, keep it for resend
+// must hold srv.mu
+func (st *fixSessionState) send(srv *fixServer, m *fixMsg) {
+	m.Set(tagSenderCompID, srv.compID)
+	m.Set(tagTargetCompID, st.compID)
+	m.SetInt(tagMsgSeqNum, st.outSeq)
+	m.Set(tagSendingTime, fixTime(time.Now()))
+	st.sent[st.outSeq] = m
+	st.outSeq++
+	if st.conn != nil {
+		st.conn.write(m)
+	}
+}
+
+// write queue message to writer, never block engine, slow peer dropped
+func (c *fixConn) write(m *fixMsg) {
+	if c.closed {
+		return
+	}
+	select {
+	case c.out <- m.Bytes():
+		c.lastSent = time.Now()
+	default:
+		log.Warningf("%s output queue full, disconnect", c.st.compID)
+		c.close()
+		c.conn.Close()
+	}
+}
+
+// close detach connection from session, writer flush queue then close
+// must hold srv.mu
+func (c *fixConn) close() {
+	if c.closed {
+		return
+	}
+	c.closed = true
+	close(c.out)
+	if c.st != nil && c.st.conn == c {
+		c.st.conn = nil
+	}
+}
+
+func (c *fixConn) writer() {
+	defer c.conn.Close()
+	for b := range c.out {
+		if _, err := c.conn.Write(b); err != nil {
+			return
+		}
+	}
+}
+
+func (c *fixConn) logout(text string) {
+	m := newFixMsg(msgLogout)
+	if text != "" {
+		m.Set(tagText, text)
+	}
+	c.st.send(c.srv, m)
+	c.close()
+}
+
+// heartbeat send Heartbeat and TestRequest, disconnect dead peer
+func (c *fixConn) heartbeat() {
+	tick := c.hbInt / 4
+	if tick < 100*time.Millisecond {
+		tick = 100 * time.Millisecond
+	}
+	tk := time.NewTicker(tick)
+	defer tk.Stop()
+	testReqNo := 0
+	for range tk.C {
+		c.srv.mu.Lock()
+		if c.closed {
+			c.srv.mu.Unlock()
+			return
+		}
+		now := time.Now()
+		switch {
+		case c.testReqID != "" && now.Sub(c.lastRecv) >= 2*c.hbInt:
+			log.Warningf("%s no response of TestRequest, disconnect", c.st.compID)
+			c.logout("heartbeat timeout")
+		case c.testReqID == "" && now.Sub(c.lastRecv) >= c.hbInt+c.hbInt/5:
+			testReqNo++
+			c.testReqID = "TEST" + strconv.Itoa(testReqNo)
+			c.st.send(c.srv, newFixMsg(msgTestRequest).Set(tagTestReqID, c.testReqID))
+		case now.Sub(c.lastSent) >= c.hbInt:
+			c.st.send(c.srv, newFixMsg(msgHeartbeat))
+		}
+		c.srv.mu.Unlock()
+	}
+}
+
+// serve run session on accepted connection
+func (srv *fixServer) serve(conn net.Conn) {
+	rd := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(srv.logonTimeout))
+	m, err := readFixMsg(rd)
+	if err != nil || m.MsgType() != msgLogon {
+		log.Warning("first message must be Logon", conn.RemoteAddr(), err)
+		conn.Close()
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+	c := &fixConn{srv: srv, conn: conn, out: make(chan []byte, fixOutQueue)}
+	go c.writer()
+	srv.mu.Lock()
+	ok := c.onLogon(m)
+	srv.mu.Unlock()
+	if !ok {
+		return
+	}
+	if c.hbInt > 0 {
+		go c.heartbeat()
+	}
+	for {
+		m, err := readFixMsg(rd)
+		srv.mu.Lock()
+		if err != nil {
+			if !c.closed {
+				log.Info(c.st.compID, "disconnected:", err)
+				c.close()
+			}
+			srv.onDisconnect(c)
+			srv.mu.Unlock()
+			return
+		}
+		if !c.closed {
+			c.onMessage(m)
+		}
+		srv.mu.Unlock()
+	}
+}
+
+// onDisconnect cancel open orders of session if cancelOnDisconnect,
+// session logged on again by other connection untouched, hold mu
+func (srv *fixServer) onDisconnect(c *fixConn) {
+	if !srv.cancelOnDisconnect || c.st == nil || c.st.conn != nil {
+		return
+	}
+	n, err := auction.MassCancel(auction.CancelFilter{Trader: c.st.compID})
+	if err != nil {
+		log.Warning(c.st.compID, "cancel on disconnect", err)
+	} else if n > 0 {
+		log.Infof("%s disconnected, %d orders canceled", c.st.compID, n)
+	}
+}
+
+// onLogon return false if logon refused
+func (c *fixConn) onLogon(m *fixMsg) bool {
+	srv := c.srv
+	compID := m.Get(tagSenderCompID)
+	if compID == "" || m.Get(tagTargetCompID) != srv.compID {
+		log.Warningf("Logon refused, SenderCompID %s TargetCompID %s",
+			compID, m.Get(tagTargetCompID))
+		c.close()
+		return false
+	}
+	st, ok := srv.states[compID]
+	if !ok {
+		st = newFixSessionState(compID)
+		srv.states[compID] = st
+	}
+	if st.conn != nil {
+		log.Warning(compID, "already logged on")
+		c.close()
+		return false
+	}
+	c.st = st
+	st.conn = c
+	c.lastRecv = time.Now()
+	c.lastSent = c.lastRecv
+	c.hbInt = time.Duration(m.GetInt(tagHeartBtInt)) * time.Second
+	reset := m.Get(tagResetSeqNumFlag) == "Y"
+	if reset {
+		st.reset()
+	}
+	seq := m.GetInt(tagMsgSeqNum)
+	if seq < st.inSeq {
+		c.logout("MsgSeqNum too low, expecting " + strconv.Itoa(st.inSeq))
+		return false
+	}
+	rsp := newFixMsg(msgLogon).Set(tagEncryptMethod, "0")
+	rsp.SetInt(tagHeartBtInt, m.GetInt(tagHeartBtInt))
+	if reset {
+		rsp.Set(tagResetSeqNumFlag, "Y")
+	}
+	st.send(srv, rsp)
+	log.Infof("%s logged on, seq in/out %d/%d", compID, st.inSeq, st.outSeq)
+	if seq > st.inSeq {
+		c.requestResend()
+	} else {
+		st.inSeq++
+	}
+	return true
+}
+
+func (c *fixConn) requestResend() {
+	if c.resendPending {
+		return
+	}
+	c.resendPending = true
+	m := newFixMsg(msgResendRequest).SetInt(tagBeginSeqNo, c.st.inSeq)
+	m.SetInt(tagEndSeqNo, 0)
+	c.st.send(c.srv, m)
+}
+
+func (c *fixConn) onMessage(m *fixMsg) {
+	st := c.st
+	c.lastRecv = time.Now()
+	seq := m.GetInt(tagMsgSeqNum)
+	msgType := m.MsgType()
+	if msgType == msgSequenceReset && m.Get(tagGapFillFlag) != "Y" {
+		// reset mode, MsgSeqNum ignored
+		if newSeq := m.GetInt(tagNewSeqNo); newSeq > st.inSeq {
+			st.inSeq = newSeq
+		}
+		c.resendPending = false
+		return
+	}
+	switch {
+	case seq > st.inSeq:
+		c.requestResend()
+		switch msgType {
+		case msgResendRequest:
+			c.onResendRequest(m)
+		case msgLogout:
+			c.logout("")
+		}
+		return
+	case seq < st.inSeq:
+		if m.Get(tagPossDupFlag) != "Y" {
+			c.logout("MsgSeqNum too low, expecting " + strconv.Itoa(st.inSeq))
+		}
+		return
+	}
+	st.inSeq++
+	c.resendPending = false
+	switch msgType {
+	case msgHeartbeat:
+		if id := m.Get(tagTestReqID); id != "" && id == c.testReqID {
+			c.testReqID = ""
+		}
+	case msgTestRequest:
+		st.send(c.srv, newFixMsg(msgHeartbeat).Set(tagTestReqID, m.Get(tagTestReqID)))
+	case msgResendRequest:
+		c.onResendRequest(m)
+	case msgSequenceReset:
+		if newSeq := m.GetInt(tagNewSeqNo); newSeq > st.inSeq {
+			st.inSeq = newSeq
+		}
+	case msgLogout:
+		log.Info(st.compID, "logout")
+		c.logout("")
+	case msgReject:
+		log.Warningf("%s Reject RefSeqNum %s: %s", st.compID, m.Get(tagRefSeqNum),
+			m.Get(tagText))
+	case msgNewOrderSingle:
+		c.srv.onNewOrder(st, m)
+	case msgOrderCancelRequest:
+		c.srv.onCancel(st, m)
+	case msgOrderCancelReplace:
+		c.srv.onReplace(st, m)
+	default:
+		rej := newFixMsg(msgReject).SetInt(tagRefSeqNum, seq)
+		rej.Set(tagRefMsgType, msgType).Set(tagSessionRejReason, "11")
+		rej.Set(tagText, "unsupported MsgType")
+		st.send(c.srv, rej)
+	}
+}
+
+// onResendRequest resend application messages with PossDupFlag,
+// admin messages replaced by SequenceReset-GapFill
+func (c *fixConn) onResendRequest(m *fixMsg) {
+	st := c.st
+	begin := m.GetInt(tagBeginSeqNo)
+	end := m.GetInt(tagEndSeqNo)
+	if end == 0 || end >= st.outSeq {
+		end = st.outSeq - 1
+	}
+	if begin < 1 {
+		begin = 1
+	}
+	gapFill := func(from, to int) {
+		if from == 0 {
+			return
+		}
+		gf := newFixMsg(msgSequenceReset).Set(tagGapFillFlag, "Y")
+		gf.SetInt(tagNewSeqNo, to)
+		gf.Set(tagSenderCompID, c.srv.compID).Set(tagTargetCompID, st.compID)
+		gf.SetInt(tagMsgSeqNum, from).Set(tagPossDupFlag, "Y")
+		gf.Set(tagSendingTime, fixTime(time.Now()))
+		c.write(gf)
+	}
+	gapStart := 0
+	for seq := begin; seq <= end; seq++ {
+		sm, ok := st.sent[seq]
+		if !ok || isAdminMsg(sm.MsgType()) {
+			if gapStart == 0 {
+				gapStart = seq
+			}
+			continue
+		}
+		gapFill(gapStart, seq)
+		gapStart = 0
+		rm := sm.clone()
+		rm.Set(tagPossDupFlag, "Y")
+		rm.Set(tagOrigSendingTime, sm.Get(tagSendingTime))
+		rm.Set(tagSendingTime, fixTime(time.Now()))
+		c.write(rm)
+	}
+	gapFill(gapStart, end+1)
+}
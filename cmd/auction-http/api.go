@@ -0,0 +1,733 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	auction "github.com/kjx98/go-auction"
+)
+
+var (
+	errBadOrder = errors.New("symbol, side buy/sell, qty and price required")
+	errRejected = errors.New("order rejected, wrong trading state")
+	errOrderID  = errors.New("invalid order id")
+	errNoOrder  = errors.New("order not found")
+	errSymbol   = errors.New("symbol required")
+	errSide     = errors.New("side must be buy or sell")
+	errAccount  = errors.New("account required")
+	errPolicy   = errors.New("policy must be reject or queue")
+	errTif      = errors.New("tif must be day, gtc or gtd")
+	errPostOnly = errors.New("postOnly must be reject or reprice")
+	errPeg      = errors.New("peg must be primary, midpoint or market")
+	errAlgo     = errors.New("algo must be fifo or prorata")
+	errSpread   = errors.New("spread not defined")
+)
+
+// orderView is order state tracked from execution reports
+type orderView struct {
+	Oid    int    `json:"oid"`
+	Symbol string `json:"symbol"`
+	Side   string `json:"side"`
+	Price  int    `json:"price"`
+	Qty    int    `json:"qty"`
+	Filled int    `json:"filled"`
+	Leaves int    `json:"leaves"`
+	Status string `json:"status"`
+	// participant of order, empty for anonymous order
+	Account string `json:"account,omitempty"`
+	Trader  string `json:"trader,omitempty"`
+	ClOrdID string `json:"clOrdID,omitempty"`
+	Tif     string `json:"tif,omitempty"`
+}
+
+// tradeView is trade of MdTrade, ID is increasing within server life
+type tradeView struct {
+	ID      int       `json:"id"`
+	TradeNo int       `json:"tradeNo"`
+	Symbol  string    `json:"symbol"`
+	Side    string    `json:"side,omitempty"`
+	Price   int       `json:"price"`
+	Volume  int       `json:"volume"`
+	Auction bool      `json:"auction,omitempty"`
+	Dark    bool      `json:"dark,omitempty"`
+	Implied bool      `json:"implied,omitempty"`
+	Block   bool      `json:"block,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+type levelView struct {
+	Price  int `json:"price"`
+	Volume int `json:"volume"`
+}
+
+type positionView struct {
+	Account    string `json:"account"`
+	Symbol     string `json:"symbol"`
+	Net        int    `json:"net"`
+	AvgPrice   int    `json:"avgPrice"`
+	LastPrice  int    `json:"lastPrice"`
+	Realized   int    `json:"realized"`
+	Unrealized int    `json:"unrealized"`
+	BuyQty     int    `json:"buyQty"`
+	SellQty    int    `json:"sellQty"`
+}
+
+type bookView struct {
+	Symbol string      `json:"symbol"`
+	Seq    uint64      `json:"seq"`
+	Bids   []levelView `json:"bids"`
+	Asks   []levelView `json:"asks"`
+}
+
+// levels return at most depth price levels, all if depth not positive
+func levels(pl []auction.PriceLevel, depth int) []levelView {
+	if depth > 0 && len(pl) > depth {
+		pl = pl[:depth]
+	}
+	res := make([]levelView, len(pl))
+	for i, v := range pl {
+		res[i] = levelView{Price: v.Price, Volume: v.Volume}
+	}
+	return res
+}
+
+// orderRequest is anonymous order if Account empty, otherwise ClOrdID
+// required
+type orderRequest struct {
+	Symbol  string `json:"symbol"`
+	Side    string `json:"side"`
+	Qty     int    `json:"qty"`
+	Price   int    `json:"price"`
+	Account string `json:"account"`
+	Trader  string `json:"trader"`
+	ClOrdID string `json:"clOrdID"`
+	// Tif day, gtc or gtd, gtc if empty, ExpireTime RFC3339 of gtd
+	Tif        string    `json:"tif"`
+	ExpireTime time.Time `json:"expireTime"`
+	// PostOnly reject or reprice if order would cross
+	PostOnly string `json:"postOnly"`
+	// Peg primary, midpoint or market, price is optional limit cap
+	Peg       string `json:"peg"`
+	PegOffset int    `json:"pegOffset"`
+	// Dark order match at lit midpoint, price is optional limit
+	Dark   bool `json:"dark"`
+	MinQty int  `json:"minQty"`
+}
+
+var tifNames = map[string]int{"": auction.TifGTC, "gtc": auction.TifGTC,
+	"day": auction.TifDay, "gtd": auction.TifGTD}
+
+var postOnlyNames = map[string]int{"": 0, "reject": auction.PostOnlyReject,
+	"reprice": auction.PostOnlyReprice}
+
+var pegNames = map[string]int{"": 0, "primary": auction.PegPrimary,
+	"midpoint": auction.PegMidpoint, "market": auction.PegMarket}
+
+type crossView struct {
+	Symbol string `json:"symbol"`
+	Price  int    `json:"price"`
+	Volume int    `json:"volume"`
+	Remain int    `json:"remain"`
+}
+
+var stateNames = map[int]string{
+	auction.StateIdle:        "idle",
+	auction.StatePreAuction:  "preAuction",
+	auction.StateCallAuction: "callAuction",
+	auction.StateTrading:     "trading",
+	auction.StateStop:        "stop",
+	auction.StateHalted:      "halted",
+}
+
+func sideName(isBuy bool) string {
+	if isBuy {
+		return "buy"
+	}
+	return "sell"
+}
+
+func tifName(tif int) string {
+	for k, v := range tifNames {
+		if v == tif && k != "" {
+			return k
+		}
+	}
+	return ""
+}
+
+// expireOrders run GTD expiry of engine every interval
+func (srv *httpServer) expireOrders(interval time.Duration) {
+	go func() {
+		for range time.Tick(interval) {
+			srv.mu.Lock()
+			auction.ExpireOrders()
+			srv.mu.Unlock()
+		}
+	}()
+}
+
+// httpServer serialize engine access with mu
+type httpServer struct {
+	mu     sync.Mutex
+	orders map[int]*orderView
+	trades []tradeView
+	// block trades by trade number
+	blocks  map[int]auction.BlockTrade
+	clients map[*wsClient]bool
+	mux     *http.ServeMux
+}
+
+func newHttpServer() *httpServer {
+	srv := &httpServer{orders: map[int]*orderView{}, mux: http.NewServeMux()}
+	srv.clients = map[*wsClient]bool{}
+	srv.blocks = map[int]auction.BlockTrade{}
+	auction.ExecSubscribe(srv.onExec)
+	auction.MdSubscribe(srv.onMd)
+	auction.StateSubscribe(srv.onState)
+	auction.SymbolStateSubscribe(srv.onSymbolState)
+	auction.RfqSubscribe(srv.onRfq)
+	srv.mux.HandleFunc("/orders", srv.handleOrders)
+	srv.mux.HandleFunc("/orders/", srv.handleOrder)
+	srv.mux.HandleFunc("/books/", srv.handleBook)
+	srv.mux.HandleFunc("/trades", srv.handleTrades)
+	srv.mux.HandleFunc("/rfqs", srv.handleRfqs)
+	srv.mux.HandleFunc("/rfqs/", srv.handleRfq)
+	srv.mux.HandleFunc("/quotes", srv.handleQuotes)
+	srv.mux.HandleFunc("/positions", srv.handlePositions)
+	srv.mux.HandleFunc("/reports/positions", srv.handlePositionReport)
+	srv.mux.HandleFunc("/admin/start", srv.handleStart)
+	srv.mux.HandleFunc("/admin/stop", srv.handleStop)
+	srv.mux.HandleFunc("/admin/cross", srv.handleCross)
+	srv.mux.HandleFunc("/admin/cancel", srv.handleMassCancel)
+	srv.mux.HandleFunc("/admin/kill", srv.handleKill)
+	srv.mux.HandleFunc("/admin/halt", srv.handleHalt)
+	srv.mux.HandleFunc("/admin/resume", srv.handleResume)
+	srv.mux.HandleFunc("/admin/match", srv.handleMatchAlgo)
+	srv.mux.HandleFunc("/admin/spread", srv.handleSpread)
+	srv.mux.HandleFunc("/admin/mmp", srv.handleMMP)
+	srv.mux.HandleFunc("/ws", srv.handleWs)
+	return srv
+}
+
+func (srv *httpServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if verbose {
+		log.Info(r.Method, r.URL)
+	}
+	srv.mux.ServeHTTP(w, r)
+}
+
+// onExec track order state, hold mu
+func (srv *httpServer) onExec(er *auction.ExecReport) {
+	if er.Block {
+		// block trade fill without order, reported by onRfq
+		return
+	}
+	or, ok := srv.orders[er.Oid]
+	if !ok {
+		or = &orderView{Oid: er.Oid, Symbol: er.Symbol, Side: sideName(er.IsBuy),
+			Account: er.Account, Trader: er.Trader}
+		if er.Tif != auction.TifGTC {
+			or.Tif = tifName(er.Tif)
+		}
+		srv.orders[er.Oid] = or
+	}
+	or.ClOrdID = er.ClOrdID
+	or.Price, or.Qty, or.Filled = er.Price, er.Qty, er.Filled
+	or.Leaves = er.Leaves()
+	switch {
+	case er.ExecType == auction.ExecCanceled:
+		or.Status = "canceled"
+	case er.ExecType == auction.ExecExpired:
+		or.Status = "expired"
+	case or.Leaves == 0:
+		or.Status = "filled"
+	case or.Filled > 0:
+		or.Status = "partial"
+	default:
+		or.Status = "new"
+	}
+	if er.ExecType == auction.ExecReplaced && er.OrigOid != er.Oid {
+		if orig, ok := srv.orders[er.OrigOid]; ok {
+			orig.Status = "replaced"
+			orig.Leaves = 0
+		}
+	}
+}
+
+// onMd record trades and stream market data, hold mu
+func (srv *httpServer) onMd(md *auction.MdUpdate) {
+	if md.Action != auction.MdTrade {
+		srv.wsOnMd(md, nil)
+		return
+	}
+	tr := tradeView{ID: len(srv.trades) + 1, TradeNo: md.TradeNo, Symbol: md.Symbol,
+		Price: md.Price, Volume: md.Volume, Auction: md.Auction, Dark: md.Dark,
+		Implied: md.Implied, Block: md.Block, Time: time.Now()}
+	if !md.Auction {
+		tr.Side = sideName(md.IsBuy)
+	}
+	srv.trades = append(srv.trades, tr)
+	srv.wsOnMd(md, &tr)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
+
+func allowMethod(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, m := range methods {
+		if r.Method == m {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	return false
+}
+
+// POST /orders
+func (srv *httpServer) handleOrders(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	var req orderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	peg, ok := pegNames[req.Peg]
+	if !ok {
+		writeError(w, http.StatusBadRequest, errPeg)
+		return
+	}
+	srv.mu.Lock()
+	_, spread := auction.GetSpread(req.Symbol)
+	srv.mu.Unlock()
+	// spread price may be zero or negative
+	if req.Symbol == "" || (req.Side != "buy" && req.Side != "sell") ||
+		req.Qty <= 0 || (!spread && (req.Price < 0 ||
+		(req.Price == 0 && peg == 0 && !req.Dark))) {
+		writeError(w, http.StatusBadRequest, errBadOrder)
+		return
+	}
+	tif, ok := tifNames[req.Tif]
+	if !ok {
+		writeError(w, http.StatusBadRequest, errTif)
+		return
+	}
+	postOnly, ok := postOnlyNames[req.PostOnly]
+	if !ok {
+		writeError(w, http.StatusBadRequest, errPostOnly)
+		return
+	}
+	opts := auction.OrderOpts{Tif: tif, ExpireTime: req.ExpireTime,
+		PostOnly: postOnly, Peg: peg, PegOffset: req.PegOffset, Dark: req.Dark,
+		MinQty: req.MinQty}
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	var oid int
+	if req.Account != "" || opts != (auction.OrderOpts{}) {
+		var ow *auction.Owner
+		if req.Account != "" {
+			ow = &auction.Owner{Account: req.Account, Trader: req.Trader,
+				ClOrdID: req.ClOrdID}
+		}
+		var err error
+		oid, err = auction.SendOrderOpts(ow, req.Symbol, req.Side == "buy",
+			req.Qty, req.Price, opts)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	} else {
+		oid = auction.SendOrder(req.Symbol, req.Side == "buy", req.Qty, req.Price)
+	}
+	if oid == 0 {
+		writeError(w, http.StatusConflict, errRejected)
+		return
+	}
+	writeJSON(w, http.StatusCreated, srv.orders[oid])
+}
+
+// GET/DELETE /orders/{oid}, DELETE?account= check order owner
+func (srv *httpServer) handleOrder(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet, http.MethodDelete) {
+		return
+	}
+	oid, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/orders/"))
+	if err != nil || oid <= 0 {
+		writeError(w, http.StatusBadRequest, errOrderID)
+		return
+	}
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	or, ok := srv.orders[oid]
+	if !ok {
+		writeError(w, http.StatusNotFound, errNoOrder)
+		return
+	}
+	if r.Method == http.MethodDelete {
+		if acct := r.URL.Query().Get("account"); acct != "" {
+			err = auction.CancelOrderOwner(acct, oid)
+		} else {
+			err = auction.CancelOrder(oid)
+		}
+		if err != nil {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, or)
+}
+
+// GET /books/{sym}?depth=N, all levels if depth not set or zero
+func (srv *httpServer) handleBook(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	sym := strings.TrimPrefix(r.URL.Path, "/books/")
+	if sym == "" {
+		writeError(w, http.StatusBadRequest, errSymbol)
+		return
+	}
+	depth, _ := strconv.Atoi(r.URL.Query().Get("depth"))
+	srv.mu.Lock()
+	seq, bids, asks := auction.MdSnapshot(sym)
+	srv.mu.Unlock()
+	writeJSON(w, http.StatusOK, &bookView{Symbol: sym, Seq: seq,
+		Bids: levels(bids, depth), Asks: levels(asks, depth)})
+}
+
+// GET /trades?sym=&since=, trades with id great than since
+func (srv *httpServer) handleTrades(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	sym := r.URL.Query().Get("sym")
+	since, _ := strconv.Atoi(r.URL.Query().Get("since"))
+	if since < 0 {
+		since = 0
+	}
+	res := []tradeView{}
+	srv.mu.Lock()
+	if since < len(srv.trades) {
+		for _, tr := range srv.trades[since:] {
+			if sym == "" || tr.Symbol == sym {
+				res = append(res, tr)
+			}
+		}
+	}
+	srv.mu.Unlock()
+	writeJSON(w, http.StatusOK, res)
+}
+
+// GET /positions?account=, all accounts if account not set
+func (srv *httpServer) handlePositions(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	srv.mu.Lock()
+	ps := auction.Positions(r.URL.Query().Get("account"))
+	srv.mu.Unlock()
+	res := make([]positionView, len(ps))
+	for i, p := range ps {
+		res[i] = positionView{Account: p.Account, Symbol: p.Symbol, Net: p.Net,
+			AvgPrice: p.AvgPrice, LastPrice: p.LastPrice, Realized: p.Realized,
+			Unrealized: p.Unrealized, BuyQty: p.BuyQty, SellQty: p.SellQty}
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// GET /reports/positions, end of day CSV of all positions
+func (srv *httpServer) handlePositionReport(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	var buf bytes.Buffer
+	srv.mu.Lock()
+	err := auction.WritePositionReport(&buf)
+	srv.mu.Unlock()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="positions.csv"`)
+	w.Write(buf.Bytes())
+}
+
+func (srv *httpServer) writeState(w http.ResponseWriter) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"state": stateNames[auction.MarketState()]})
+}
+
+// POST /admin/start?clean=1, clean reset order numbers
+func (srv *httpServer) handleStart(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	clean := r.URL.Query().Get("clean") == "1"
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	auction.MarketStart(clean)
+	srv.writeState(w)
+}
+
+// POST /admin/stop
+func (srv *httpServer) handleStop(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	auction.MarketStop()
+	srv.writeState(w)
+}
+
+// POST /admin/cross?sym=&pclose=&uncross=1, MatchCross price and volume,
+// orders filled if uncross
+func (srv *httpServer) handleCross(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	q := r.URL.Query()
+	sym := q.Get("sym")
+	if sym == "" {
+		writeError(w, http.StatusBadRequest, errSymbol)
+		return
+	}
+	pclose, _ := strconv.Atoi(q.Get("pclose"))
+	res := crossView{Symbol: sym}
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if q.Get("uncross") == "1" {
+		res.Price, res.Volume, res.Remain = auction.Uncross(sym, pclose)
+	} else {
+		res.Price, res.Volume, res.Remain = auction.MatchCross(sym, pclose)
+	}
+	writeJSON(w, http.StatusOK, &res)
+}
+
+// POST /admin/cancel?sym=&account=&trader=&side=, cancel all open orders
+// matched, all orders if no filter
+func (srv *httpServer) handleMassCancel(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	q := r.URL.Query()
+	f := auction.CancelFilter{Symbol: q.Get("sym"), Account: q.Get("account"),
+		Trader: q.Get("trader")}
+	switch q.Get("side") {
+	case "":
+	case "buy":
+		f.Side = auction.SideBuy
+	case "sell":
+		f.Side = auction.SideSell
+	default:
+		writeError(w, http.StatusBadRequest, errSide)
+		return
+	}
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	n, err := auction.MassCancel(f)
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"canceled": n})
+}
+
+// POST /admin/kill?account= cancel orders and block account,
+// DELETE /admin/kill?account= accept orders of account again
+func (srv *httpServer) handleKill(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost, http.MethodDelete) {
+		return
+	}
+	acct := r.URL.Query().Get("account")
+	if acct == "" {
+		writeError(w, http.StatusBadRequest, errAccount)
+		return
+	}
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if r.Method == http.MethodDelete {
+		auction.ReviveAccount(acct)
+		writeJSON(w, http.StatusOK, map[string]int{"canceled": 0})
+		return
+	}
+	n, err := auction.KillAccount(acct)
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"canceled": n})
+}
+
+// POST /admin/halt?sym=&policy=reject|queue, reject if policy not set
+func (srv *httpServer) handleHalt(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	q := r.URL.Query()
+	sym := q.Get("sym")
+	if sym == "" {
+		writeError(w, http.StatusBadRequest, errSymbol)
+		return
+	}
+	policy := auction.HaltReject
+	switch q.Get("policy") {
+	case "", "reject":
+	case "queue":
+		policy = auction.HaltQueue
+	default:
+		writeError(w, http.StatusBadRequest, errPolicy)
+		return
+	}
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	auction.HaltSymbol(sym, policy)
+	writeJSON(w, http.StatusOK, map[string]string{"symbol": sym,
+		"state": stateNames[auction.SymbolState(sym)]})
+}
+
+type matchAlgoView struct {
+	Symbol   string `json:"symbol"`
+	Algo     string `json:"algo"`
+	TopOrder bool   `json:"top"`
+	MinAlloc int    `json:"min"`
+	FifoPct  int    `json:"fifo"`
+}
+
+var algoNames = map[string]int{"fifo": auction.MatchFIFO,
+	"prorata": auction.MatchProRata}
+
+// GET|POST /admin/match?sym=&algo=fifo|prorata&top=1&min=&fifo=, POST set
+// matching algorithm of symbol, auction=1 for allocation of marginal
+// level in auction uncross
+func (srv *httpServer) handleMatchAlgo(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet, http.MethodPost) {
+		return
+	}
+	q := r.URL.Query()
+	sym := q.Get("sym")
+	if sym == "" {
+		writeError(w, http.StatusBadRequest, errSymbol)
+		return
+	}
+	set, get := auction.SetMatchAlgo, auction.GetMatchAlgo
+	if q.Get("auction") == "1" {
+		set, get = auction.SetAuctionAlgo, auction.GetAuctionAlgo
+	}
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if r.Method == http.MethodPost {
+		algo, ok := algoNames[q.Get("algo")]
+		if !ok {
+			writeError(w, http.StatusBadRequest, errAlgo)
+			return
+		}
+		minAlloc, _ := strconv.Atoi(q.Get("min"))
+		fifoPct, _ := strconv.Atoi(q.Get("fifo"))
+		set(sym, &auction.MatchAlgo{Algo: algo, TopOrder: q.Get("top") == "1",
+			MinAlloc: minAlloc, FifoPct: fifoPct})
+	}
+	ma := get(sym)
+	res := matchAlgoView{Symbol: sym, Algo: "fifo", TopOrder: ma.TopOrder,
+		MinAlloc: ma.MinAlloc, FifoPct: ma.FifoPct}
+	if ma.Algo == auction.MatchProRata {
+		res.Algo = "prorata"
+	}
+	writeJSON(w, http.StatusOK, &res)
+}
+
+// POST /admin/resume?sym=&pclose=, reopening auction result
+func (srv *httpServer) handleResume(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	q := r.URL.Query()
+	sym := q.Get("sym")
+	if sym == "" {
+		writeError(w, http.StatusBadRequest, errSymbol)
+		return
+	}
+	pclose, _ := strconv.Atoi(q.Get("pclose"))
+	res := crossView{Symbol: sym}
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	var err error
+	res.Price, res.Volume, res.Remain, err = auction.ResumeSymbol(sym, pclose)
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, &res)
+}
+
+type impliedView struct {
+	Symbol    string `json:"symbol"`
+	BidPrice  int    `json:"bidPrice"`
+	BidVolume int    `json:"bidVolume"`
+	AskPrice  int    `json:"askPrice"`
+	AskVolume int    `json:"askVolume"`
+}
+
+// spreadView is spread definition with implied-out quotes of legs
+type spreadView struct {
+	Symbol  string        `json:"symbol"`
+	Front   string        `json:"front"`
+	Back    string        `json:"back"`
+	Implied []impliedView `json:"implied"`
+}
+
+// GET|POST /admin/spread?sym=&front=&back=, POST define spread sym of
+// outright legs front and back
+func (srv *httpServer) handleSpread(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet, http.MethodPost) {
+		return
+	}
+	q := r.URL.Query()
+	sym := q.Get("sym")
+	if sym == "" {
+		writeError(w, http.StatusBadRequest, errSymbol)
+		return
+	}
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if r.Method == http.MethodPost {
+		if err := auction.DefineSpread(sym, q.Get("front"), q.Get("back")); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	sp, ok := auction.GetSpread(sym)
+	if !ok {
+		writeError(w, http.StatusNotFound, errSpread)
+		return
+	}
+	res := spreadView{Symbol: sp.Symbol, Front: sp.Front, Back: sp.Back,
+		Implied: []impliedView{}}
+	for _, leg := range []string{sp.Front, sp.Back} {
+		for _, iq := range auction.ImpliedQuotes(leg) {
+			if iq.Spread != sym {
+				continue
+			}
+			res.Implied = append(res.Implied, impliedView{Symbol: leg,
+				BidPrice: iq.BidPrice, BidVolume: iq.BidVolume,
+				AskPrice: iq.AskPrice, AskVolume: iq.AskVolume})
+		}
+	}
+	writeJSON(w, http.StatusOK, &res)
+}
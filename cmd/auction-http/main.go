@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"time"
+
+	auction "github.com/kjx98/go-auction"
+	"github.com/op/go-logging"
+)
+
+var (
+	listenAddr string
+	verbose    bool
+	preAuction bool
+)
+
+var log = logging.MustGetLogger("auction-http")
+
+func main() {
+	flag.StringVar(&listenAddr, "addr", ":8080", "HTTP listen address")
+	flag.BoolVar(&preAuction, "pre", false, "start in pre auction, no matching")
+	flag.BoolVar(&verbose, "v", false, "verbose log")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: auction-http [options]\n")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+	flag.Parse()
+	if !verbose {
+		logging.SetLevel(logging.WARNING, "go-auction")
+	}
+	if !preAuction {
+		auction.MarketStart(true)
+	}
+	srv := newHttpServer()
+	srv.expireOrders(time.Second)
+	log.Info("HTTP API listen on", listenAddr)
+	if err := http.ListenAndServe(listenAddr, srv); err != nil {
+		log.Error("listen", err)
+		os.Exit(1)
+	}
+}
+
+// `%{color}%{time:15:04:05.000} %{shortfunc} ▶ %{level:.4s} %{id:03x}%{color:reset} %{message}`
+func init() {
+	var format = logging.MustStringFormatter(
+		`%{color}%{time:01-02 15:04:05}  ▶ %{level:.4s} %{color:reset} %{message}`,
+	)
+
+	if runtime.GOARCH != "amd64" {
+		format = logging.MustStringFormatter(
+			`%{time:01-02 15:04:05} %{level:.4s} %{message}`,
+		)
+	}
+	logback := logging.NewLogBackend(os.Stderr, "", 0)
+	logfmt := logging.NewBackendFormatter(logback, format)
+	logging.SetBackend(logfmt)
+}
@@ -0,0 +1,450 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/op/go-logging"
+)
+
+var testSrv *httpServer
+
+func TestMain(m *testing.M) {
+	logging.SetLevel(logging.ERROR, "go-auction")
+	logging.SetLevel(logging.ERROR, "auction-http")
+	// engine start in pre auction
+	testSrv = newHttpServer()
+	os.Exit(m.Run())
+}
+
+func doRequest(t *testing.T, method, url, body string, code int, res interface{}) {
+	t.Helper()
+	req := httptest.NewRequest(method, url, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	testSrv.ServeHTTP(w, req)
+	if w.Code != code {
+		t.Fatalf("%s %s status %d, want %d: %s", method, url, w.Code, code,
+			w.Body.String())
+	}
+	if res != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), res); err != nil {
+			t.Fatalf("%s %s decode %v: %s", method, url, err, w.Body.String())
+		}
+	}
+}
+
+func postOrder(t *testing.T, sym, side string, qty, price int) *orderView {
+	t.Helper()
+	var or orderView
+	body := `{"symbol":"` + sym + `","side":"` + side + `","qty":` +
+		strconv.Itoa(qty) + `,"price":` + strconv.Itoa(price) + `}`
+	doRequest(t, http.MethodPost, "/orders", body, http.StatusCreated, &or)
+	return &or
+}
+
+func TestAuctionCross(t *testing.T) {
+	sym := "cu1908"
+	postOrder(t, sym, "buy", 10, 43000)
+	postOrder(t, sym, "buy", 5, 42800)
+	postOrder(t, sym, "sell", 8, 42900)
+	var cross crossView
+	doRequest(t, http.MethodPost, "/admin/cross?sym="+sym+"&pclose=42000", "",
+		http.StatusOK, &cross)
+	if cross.Volume != 8 || cross.Price == 0 {
+		t.Errorf("MatchCross %+v", cross)
+	}
+	var trades []tradeView
+	doRequest(t, http.MethodGet, "/trades?sym="+sym, "", http.StatusOK, &trades)
+	if len(trades) != 0 {
+		t.Errorf("trades before uncross %+v", trades)
+	}
+	doRequest(t, http.MethodPost, "/admin/cross?sym="+sym+"&pclose=42000&uncross=1",
+		"", http.StatusOK, &cross)
+	doRequest(t, http.MethodGet, "/trades?sym="+sym, "", http.StatusOK, &trades)
+	if len(trades) != 1 || !trades[0].Auction || trades[0].Volume != 8 ||
+		trades[0].Price != cross.Price {
+		t.Errorf("auction trades %+v", trades)
+	}
+	var state map[string]string
+	doRequest(t, http.MethodPost, "/admin/start", "", http.StatusOK, &state)
+	if state["state"] != "trading" {
+		t.Errorf("state %v", state)
+	}
+	doRequest(t, http.MethodPost, "/admin/cross", "", http.StatusBadRequest, nil)
+}
+
+func TestOrders(t *testing.T) {
+	sym := "cu1909"
+	buy := postOrder(t, sym, "buy", 10, 43000)
+	if buy.Status != "new" || buy.Leaves != 10 || buy.Side != "buy" {
+		t.Errorf("new order %+v", buy)
+	}
+	sell := postOrder(t, sym, "sell", 15, 42900)
+	if sell.Status != "partial" || sell.Filled != 10 || sell.Leaves != 5 {
+		t.Errorf("sell order %+v", sell)
+	}
+	var or orderView
+	doRequest(t, http.MethodGet, "/orders/"+strconv.Itoa(buy.Oid), "", http.StatusOK, &or)
+	if or.Status != "filled" || or.Filled != 10 {
+		t.Errorf("filled order %+v", or)
+	}
+	var book bookView
+	postOrder(t, sym, "sell", 3, 43100)
+	doRequest(t, http.MethodGet, "/books/"+sym+"?depth=1", "", http.StatusOK, &book)
+	if len(book.Bids) != 0 || len(book.Asks) != 1 || book.Asks[0] !=
+		(levelView{Price: 42900, Volume: 5}) || book.Seq == 0 {
+		t.Errorf("book %+v", book)
+	}
+	doRequest(t, http.MethodGet, "/books/"+sym, "", http.StatusOK, &book)
+	if len(book.Asks) != 2 {
+		t.Errorf("full book %+v", book)
+	}
+	var trades []tradeView
+	doRequest(t, http.MethodGet, "/trades?sym="+sym, "", http.StatusOK, &trades)
+	if len(trades) != 1 || trades[0].Price != 42900 || trades[0].Volume != 10 ||
+		trades[0].Side != "sell" {
+		t.Fatalf("trades %+v", trades)
+	}
+	since := strconv.Itoa(trades[0].ID)
+	doRequest(t, http.MethodGet, "/trades?since="+since, "", http.StatusOK, &trades)
+	if len(trades) != 0 {
+		t.Errorf("trades since %s: %+v", since, trades)
+	}
+	// cancel rest of sell order
+	doRequest(t, http.MethodDelete, "/orders/"+strconv.Itoa(sell.Oid), "",
+		http.StatusOK, &or)
+	if or.Status != "canceled" || or.Leaves != 0 || or.Filled != 10 {
+		t.Errorf("canceled order %+v", or)
+	}
+	doRequest(t, http.MethodDelete, "/orders/"+strconv.Itoa(sell.Oid), "",
+		http.StatusConflict, nil)
+	doRequest(t, http.MethodGet, "/orders/99999", "", http.StatusNotFound, nil)
+	doRequest(t, http.MethodGet, "/orders/x", "", http.StatusBadRequest, nil)
+	doRequest(t, http.MethodPut, "/orders/1", "", http.StatusMethodNotAllowed, nil)
+	doRequest(t, http.MethodPost, "/orders", `{"symbol":"cu1909","side":"buy"}`,
+		http.StatusBadRequest, nil)
+	// orders rejected after market stop
+	doRequest(t, http.MethodPost, "/admin/stop", "", http.StatusOK, nil)
+	doRequest(t, http.MethodPost, "/orders",
+		`{"symbol":"cu1909","side":"buy","qty":1,"price":42000}`, http.StatusConflict, nil)
+	doRequest(t, http.MethodPost, "/admin/start", "", http.StatusOK, nil)
+}
+
+func TestOrderAccount(t *testing.T) {
+	sym := "cu1912"
+	var or orderView
+	body := `{"symbol":"` + sym + `","side":"buy","qty":2,"price":41000,` +
+		`"account":"acc1","trader":"t1","clOrdID":"c1"}`
+	doRequest(t, http.MethodPost, "/orders", body, http.StatusCreated, &or)
+	if or.Account != "acc1" || or.Trader != "t1" || or.ClOrdID != "c1" {
+		t.Errorf("owner order %+v", or)
+	}
+	// duplicate ClOrdID
+	doRequest(t, http.MethodPost, "/orders", body, http.StatusBadRequest, nil)
+	url := "/orders/" + strconv.Itoa(or.Oid)
+	doRequest(t, http.MethodDelete, url+"?account=acc2", "", http.StatusConflict, nil)
+	doRequest(t, http.MethodDelete, url+"?account=acc1", "", http.StatusOK, &or)
+	if or.Status != "canceled" {
+		t.Errorf("canceled order %+v", or)
+	}
+}
+
+func TestPositions(t *testing.T) {
+	sym := "cu1912"
+	body := `{"symbol":"` + sym + `","side":"sell","qty":3,"price":40000,` +
+		`"account":"acc5","clOrdID":"p1"}`
+	doRequest(t, http.MethodPost, "/orders", body, http.StatusCreated, nil)
+	postOrder(t, sym, "buy", 3, 40000)
+	var ps []positionView
+	doRequest(t, http.MethodGet, "/positions?account=acc5", "", http.StatusOK, &ps)
+	if len(ps) != 1 || ps[0].Net != -3 || ps[0].AvgPrice != 40000 || ps[0].SellQty != 3 {
+		t.Errorf("positions %+v", ps)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/reports/positions", nil)
+	w := httptest.NewRecorder()
+	testSrv.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(),
+		"acc5,"+sym+",-3,40000,40000,0,0,0,3") {
+		t.Errorf("position report %d\n%s", w.Code, w.Body.String())
+	}
+}
+
+func TestMassCancel(t *testing.T) {
+	sym := "cu1913"
+	for i, side := range []string{"buy", "sell"} {
+		body := `{"symbol":"` + sym + `","side":"` + side + `","qty":1,"price":` +
+			strconv.Itoa(40000+i*2000) + `,"account":"acc6","clOrdID":"k` +
+			strconv.Itoa(i) + `"}`
+		doRequest(t, http.MethodPost, "/orders", body, http.StatusCreated, nil)
+	}
+	var res map[string]int
+	doRequest(t, http.MethodPost, "/admin/cancel?sym="+sym+"&side=sell", "",
+		http.StatusOK, &res)
+	if res["canceled"] != 1 {
+		t.Errorf("mass cancel %v", res)
+	}
+	doRequest(t, http.MethodPost, "/admin/cancel?side=x", "", http.StatusBadRequest, nil)
+	doRequest(t, http.MethodPost, "/admin/kill?account=acc6", "", http.StatusOK, &res)
+	if res["canceled"] != 1 {
+		t.Errorf("kill %v", res)
+	}
+	body := `{"symbol":"` + sym + `","side":"buy","qty":1,"price":40000,` +
+		`"account":"acc6","clOrdID":"k3"}`
+	doRequest(t, http.MethodPost, "/orders", body, http.StatusBadRequest, nil)
+	doRequest(t, http.MethodDelete, "/admin/kill?account=acc6", "", http.StatusOK, nil)
+	doRequest(t, http.MethodPost, "/orders", body, http.StatusCreated, nil)
+	doRequest(t, http.MethodPost, "/admin/kill", "", http.StatusBadRequest, nil)
+}
+
+func TestHaltResume(t *testing.T) {
+	sym := "cu1914"
+	var res map[string]string
+	doRequest(t, http.MethodPost, "/admin/halt?sym="+sym+"&policy=queue", "",
+		http.StatusOK, &res)
+	if res["state"] != "halted" {
+		t.Errorf("halt %v", res)
+	}
+	postOrder(t, sym, "buy", 4, 42000)
+	postOrder(t, sym, "sell", 3, 41900)
+	var cross crossView
+	doRequest(t, http.MethodPost, "/admin/resume?sym="+sym+"&pclose=41000", "",
+		http.StatusOK, &cross)
+	if cross.Volume != 3 {
+		t.Errorf("reopening auction %+v", cross)
+	}
+	doRequest(t, http.MethodPost, "/admin/resume?sym="+sym, "", http.StatusConflict, nil)
+	doRequest(t, http.MethodPost, "/admin/halt?sym="+sym+"&policy=x", "",
+		http.StatusBadRequest, nil)
+	doRequest(t, http.MethodPost, "/admin/halt?sym="+sym, "", http.StatusOK, nil)
+	doRequest(t, http.MethodPost, "/orders",
+		`{"symbol":"`+sym+`","side":"buy","qty":1,"price":42000}`, http.StatusConflict, nil)
+	doRequest(t, http.MethodPost, "/admin/resume?sym="+sym, "", http.StatusOK, nil)
+}
+
+func TestOrderExpire(t *testing.T) {
+	sym := "cu1915"
+	body := `{"symbol":"` + sym + `","side":"buy","qty":1,"price":40000,` +
+		`"tif":"gtd","expireTime":"2019-01-02T15:00:00Z"}`
+	doRequest(t, http.MethodPost, "/orders", body, http.StatusBadRequest, nil)
+	body = `{"symbol":"` + sym + `","side":"buy","qty":1,"price":40000,"tif":"fok"}`
+	doRequest(t, http.MethodPost, "/orders", body, http.StatusBadRequest, nil)
+	var or orderView
+	body = `{"symbol":"` + sym + `","side":"buy","qty":1,"price":40000,"tif":"day"}`
+	doRequest(t, http.MethodPost, "/orders", body, http.StatusCreated, &or)
+	if or.Tif != "day" || or.Status != "new" {
+		t.Errorf("day order %+v", or)
+	}
+	// session end expire day orders
+	doRequest(t, http.MethodPost, "/admin/stop", "", http.StatusOK, nil)
+	doRequest(t, http.MethodPost, "/admin/start", "", http.StatusOK, nil)
+	doRequest(t, http.MethodGet, "/orders/"+strconv.Itoa(or.Oid), "", http.StatusOK, &or)
+	if or.Status != "expired" || or.Leaves != 0 {
+		t.Errorf("day order after stop %+v", or)
+	}
+}
+
+func TestPostOnly(t *testing.T) {
+	sym := "cu1916"
+	postOrder(t, sym, "sell", 1, 42000)
+	var or orderView
+	body := `{"symbol":"` + sym + `","side":"buy","qty":1,"price":42000,` +
+		`"postOnly":"reprice"}`
+	doRequest(t, http.MethodPost, "/orders", body, http.StatusCreated, &or)
+	if or.Price != 41999 || or.Leaves != 1 {
+		t.Errorf("repriced order %+v", or)
+	}
+	body = `{"symbol":"` + sym + `","side":"buy","qty":1,"price":42000,` +
+		`"postOnly":"reject"}`
+	doRequest(t, http.MethodPost, "/orders", body, http.StatusCreated, &or)
+	if or.Status != "canceled" {
+		t.Errorf("post-only order %+v", or)
+	}
+	body = `{"symbol":"` + sym + `","side":"buy","qty":1,"price":42000,` +
+		`"postOnly":"x"}`
+	doRequest(t, http.MethodPost, "/orders", body, http.StatusBadRequest, nil)
+}
+
+func TestPeggedOrder(t *testing.T) {
+	sym := "cu1917"
+	postOrder(t, sym, "buy", 1, 41000)
+	postOrder(t, sym, "sell", 1, 41100)
+	var or orderView
+	body := `{"symbol":"` + sym + `","side":"buy","qty":2,"peg":"midpoint"}`
+	doRequest(t, http.MethodPost, "/orders", body, http.StatusCreated, &or)
+	if or.Price != 41050 {
+		t.Errorf("midpoint peg %+v", or)
+	}
+	postOrder(t, sym, "buy", 1, 41020)
+	doRequest(t, http.MethodGet, "/orders/"+strconv.Itoa(or.Oid), "", http.StatusOK, &or)
+	if or.Price != 41060 || or.Leaves != 2 {
+		t.Errorf("repegged order %+v", or)
+	}
+	body = `{"symbol":"` + sym + `","side":"buy","qty":2,"peg":"best"}`
+	doRequest(t, http.MethodPost, "/orders", body, http.StatusBadRequest, nil)
+}
+
+func TestMatchAlgo(t *testing.T) {
+	sym := "cu1918"
+	var res matchAlgoView
+	doRequest(t, http.MethodPost, "/admin/match?sym="+sym+"&algo=prorata&min=2",
+		"", http.StatusOK, &res)
+	if res.Algo != "prorata" || res.MinAlloc != 2 {
+		t.Errorf("match algo %+v", res)
+	}
+	o1 := postOrder(t, sym, "sell", 10, 42000)
+	o2 := postOrder(t, sym, "sell", 30, 42000)
+	postOrder(t, sym, "buy", 20, 42000)
+	doRequest(t, http.MethodGet, "/orders/"+strconv.Itoa(o1.Oid), "", http.StatusOK, o1)
+	doRequest(t, http.MethodGet, "/orders/"+strconv.Itoa(o2.Oid), "", http.StatusOK, o2)
+	if o1.Leaves != 5 || o2.Leaves != 15 {
+		t.Errorf("pro-rata leaves %d/%d", o1.Leaves, o2.Leaves)
+	}
+	doRequest(t, http.MethodPost, "/admin/match?sym="+sym+"&algo=lifo", "",
+		http.StatusBadRequest, nil)
+	doRequest(t, http.MethodPost, "/admin/match?sym="+sym+"&algo=fifo", "",
+		http.StatusOK, &res)
+	if res.Algo != "fifo" {
+		t.Errorf("match algo %+v", res)
+	}
+	doRequest(t, http.MethodPost, "/admin/match?sym="+sym+"&auction=1&algo=prorata",
+		"", http.StatusOK, &res)
+	doRequest(t, http.MethodGet, "/admin/match?sym="+sym, "", http.StatusOK, &res)
+	if res.Algo != "fifo" {
+		t.Errorf("continuous algo %+v after auction algo set", res)
+	}
+	doRequest(t, http.MethodGet, "/admin/match?sym="+sym+"&auction=1", "",
+		http.StatusOK, &res)
+	if res.Algo != "prorata" {
+		t.Errorf("auction algo %+v", res)
+	}
+}
+
+func TestDarkOrder(t *testing.T) {
+	sym := "cu1919"
+	postOrder(t, sym, "buy", 1, 41000)
+	postOrder(t, sym, "sell", 1, 41100)
+	var d1, d2 orderView
+	body := `{"symbol":"` + sym + `","side":"buy","qty":4,"dark":true}`
+	doRequest(t, http.MethodPost, "/orders", body, http.StatusCreated, &d1)
+	body = `{"symbol":"` + sym + `","side":"sell","qty":3,"price":41000,` +
+		`"dark":true,"minQty":2}`
+	doRequest(t, http.MethodPost, "/orders", body, http.StatusCreated, &d2)
+	if d2.Status != "filled" {
+		t.Errorf("dark sell %+v", d2)
+	}
+	var trades []tradeView
+	doRequest(t, http.MethodGet, "/trades?sym="+sym, "", http.StatusOK, &trades)
+	if len(trades) != 1 || !trades[0].Dark || trades[0].Price != 41050 ||
+		trades[0].Volume != 3 {
+		t.Errorf("dark trades %+v", trades)
+	}
+}
+
+func TestSpreadOrder(t *testing.T) {
+	front, back, sym := "cu2011", "cu2012", "cu2011-2012"
+	var sp spreadView
+	doRequest(t, http.MethodPost, "/admin/spread?sym="+sym+"&front="+front+
+		"&back="+back, "", http.StatusOK, &sp)
+	if sp.Front != front || sp.Back != back {
+		t.Errorf("spread %+v", sp)
+	}
+	doRequest(t, http.MethodPost, "/admin/spread?sym=x&front="+front+"&back="+front,
+		"", http.StatusBadRequest, nil)
+	postOrder(t, front, "sell", 2, 41000)
+	postOrder(t, back, "buy", 2, 41100)
+	// negative spread price, matched with implied price
+	or := postOrder(t, sym, "buy", 3, -50)
+	if or.Status != "partial" {
+		t.Errorf("spread order %+v", or)
+	}
+	var trades []tradeView
+	doRequest(t, http.MethodGet, "/trades?sym="+sym, "", http.StatusOK, &trades)
+	if len(trades) != 1 || !trades[0].Implied || trades[0].Price != -100 ||
+		trades[0].Volume != 2 {
+		t.Errorf("spread trades %+v", trades)
+	}
+	postOrder(t, back, "buy", 1, 41200)
+	doRequest(t, http.MethodGet, "/admin/spread?sym="+sym, "", http.StatusOK, &sp)
+	// front bid implied by spread bid and back bid
+	if len(sp.Implied) != 2 || sp.Implied[0].BidPrice != 41150 ||
+		sp.Implied[0].BidVolume != 1 {
+		t.Errorf("implied quotes %+v", sp.Implied)
+	}
+}
+
+func TestRfqBlock(t *testing.T) {
+	sym := "cu1920"
+	var rfq rfqView
+	doRequest(t, http.MethodPost, "/rfqs",
+		`{"account":"RFQH1","symbol":"`+sym+`","qty":50}`, http.StatusCreated, &rfq)
+	if rfq.State != "open" || rfq.Qty != 50 {
+		t.Fatalf("new rfq %+v", rfq)
+	}
+	id := strconv.Itoa(rfq.ID)
+	doRequest(t, http.MethodPost, "/rfqs/"+id+"/quotes",
+		`{"account":"RFQH1","bid":40000}`, http.StatusConflict, nil)
+	doRequest(t, http.MethodPost, "/rfqs/"+id+"/quotes",
+		`{"account":"RFQH2","bid":40000,"ask":40100}`, http.StatusCreated, &rfq)
+	if len(rfq.Quotes) != 1 || rfq.Quotes[0].AskPrice != 40100 {
+		t.Fatalf("quoted rfq %+v", rfq)
+	}
+	var bt blockView
+	doRequest(t, http.MethodPost, "/rfqs/"+id+"/accept",
+		`{"account":"RFQH1","quoteID":`+strconv.Itoa(rfq.Quotes[0].ID)+`,"side":"sell"}`,
+		http.StatusOK, &bt)
+	if bt.Price != 40000 || bt.Qty != 50 || bt.Buyer != "RFQH2" || bt.Seller != "RFQH1" {
+		t.Errorf("block trade %+v", bt)
+	}
+	var trades []tradeView
+	doRequest(t, http.MethodGet, "/trades?sym="+sym, "", http.StatusOK, &trades)
+	if len(trades) != 1 || !trades[0].Block || trades[0].TradeNo != bt.TradeNo {
+		t.Errorf("block trades %+v", trades)
+	}
+	doRequest(t, http.MethodGet, "/rfqs/"+id, "", http.StatusOK, &rfq)
+	if rfq.State != "done" {
+		t.Errorf("accepted rfq %+v", rfq)
+	}
+	doRequest(t, http.MethodDelete, "/rfqs/"+id+"?account=RFQH1", "",
+		http.StatusConflict, nil)
+}
+
+func TestMassQuote(t *testing.T) {
+	sym := "cu1921"
+	var mmp mmpView
+	doRequest(t, http.MethodPost, "/admin/mmp?account=MMH1&window=1000&volume=3", "",
+		http.StatusOK, &mmp)
+	if mmp.WindowMs != 1000 || mmp.VolumeLimit != 3 || mmp.Tripped {
+		t.Errorf("mmp %+v", mmp)
+	}
+	var acks []quoteAckView
+	body := `{"account":"MMH1","quotes":[{"symbol":"` + sym + `","quoteID":"q1",` +
+		`"bidPrice":42000,"bidQty":2,"askPrice":42100,"askQty":2}]}`
+	doRequest(t, http.MethodPost, "/quotes", body, http.StatusOK, &acks)
+	if len(acks) != 1 || acks[0].BidOid == 0 || acks[0].AskOid == 0 {
+		t.Fatalf("quote acks %+v", acks)
+	}
+	postOrder(t, sym, "sell", 2, 42000)
+	postOrder(t, sym, "buy", 1, 42100)
+	var book bookView
+	doRequest(t, http.MethodGet, "/books/"+sym, "", http.StatusOK, &book)
+	if len(book.Bids) != 0 || len(book.Asks) != 0 {
+		t.Errorf("book after MMP %+v", book)
+	}
+	doRequest(t, http.MethodPost, "/quotes", body, http.StatusConflict, nil)
+	doRequest(t, http.MethodPost, "/admin/mmp?account=MMH1&reset=1", "",
+		http.StatusOK, &mmp)
+	if mmp.Tripped || mmp.VolumeLimit != 3 {
+		t.Errorf("reset mmp %+v", mmp)
+	}
+	doRequest(t, http.MethodPost, "/quotes", body, http.StatusOK, &acks)
+	var res map[string]int
+	doRequest(t, http.MethodDelete, "/quotes?account=MMH1", "", http.StatusOK, &res)
+	if res["canceled"] != 2 {
+		t.Errorf("canceled quotes %v", res)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kjx98/go-auction"
+)
+
+type quoteEntry struct {
+	Symbol   string `json:"symbol"`
+	QuoteID  string `json:"quoteID"`
+	BidPrice int    `json:"bidPrice"`
+	BidQty   int    `json:"bidQty"`
+	AskPrice int    `json:"askPrice"`
+	AskQty   int    `json:"askQty"`
+}
+
+// massQuoteRequest replace quotes of Account, one entry per symbol
+type massQuoteRequest struct {
+	Account string       `json:"account"`
+	Quotes  []quoteEntry `json:"quotes"`
+}
+
+type quoteAckView struct {
+	Symbol  string `json:"symbol"`
+	QuoteID string `json:"quoteID"`
+	BidOid  int    `json:"bidOid,omitempty"`
+	AskOid  int    `json:"askOid,omitempty"`
+}
+
+type mmpView struct {
+	Account     string `json:"account"`
+	WindowMs    int64  `json:"windowMs"`
+	VolumeLimit int    `json:"volume"`
+	DeltaLimit  int    `json:"delta"`
+	Tripped     bool   `json:"tripped"`
+}
+
+// POST /quotes mass quote, DELETE /quotes?account=&sym= pull quotes of
+// account, all symbols if sym not set
+func (srv *httpServer) handleQuotes(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost, http.MethodDelete) {
+		return
+	}
+	if r.Method == http.MethodDelete {
+		q := r.URL.Query()
+		account := q.Get("account")
+		if account == "" {
+			writeError(w, http.StatusBadRequest, errAccount)
+			return
+		}
+		srv.mu.Lock()
+		n := auction.CancelQuotes(account, q.Get("sym"))
+		srv.mu.Unlock()
+		writeJSON(w, http.StatusOK, map[string]int{"canceled": n})
+		return
+	}
+	var req massQuoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.Account == "" {
+		writeError(w, http.StatusBadRequest, errAccount)
+		return
+	}
+	entries := make([]auction.QuoteEntry, len(req.Quotes))
+	for i, q := range req.Quotes {
+		entries[i] = auction.QuoteEntry{Symbol: q.Symbol, QuoteID: q.QuoteID,
+			BidPrice: q.BidPrice, BidQty: q.BidQty, AskPrice: q.AskPrice,
+			AskQty: q.AskQty}
+	}
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	acks, err := auction.MassQuote(req.Account, entries)
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	res := make([]quoteAckView, len(acks))
+	for i, a := range acks {
+		res[i] = quoteAckView{Symbol: a.Symbol, QuoteID: a.QuoteID,
+			BidOid: a.BidOid, AskOid: a.AskOid}
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// POST /admin/mmp?account=&window=ms&volume=&delta=, reset=1 accept
+// quotes again after trip, without limits keep settings
+func (srv *httpServer) handleMMP(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	q := r.URL.Query()
+	account := q.Get("account")
+	if account == "" {
+		writeError(w, http.StatusBadRequest, errAccount)
+		return
+	}
+	windowMs, _ := strconv.ParseInt(q.Get("window"), 10, 64)
+	volume, _ := strconv.Atoi(q.Get("volume"))
+	delta, _ := strconv.Atoi(q.Get("delta"))
+	p := auction.MMProtection{Window: time.Duration(windowMs) * time.Millisecond,
+		VolumeLimit: volume, DeltaLimit: delta}
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if q.Get("reset") == "1" {
+		auction.ResetMMP(account)
+	}
+	if volume > 0 || delta > 0 {
+		auction.SetMMP(account, p)
+	}
+	p = auction.GetMMP(account)
+	writeJSON(w, http.StatusOK, &mmpView{Account: account,
+		WindowMs: int64(p.Window / time.Millisecond), VolumeLimit: p.VolumeLimit,
+		DeltaLimit: p.DeltaLimit, Tripped: auction.MMPTripped(account)})
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/kjx98/go-auction"
+)
+
+var (
+	errRfqID  = errors.New("invalid rfq id")
+	errNoRfq  = errors.New("rfq not found")
+	errRfqReq = errors.New("account, symbol and qty required")
+)
+
+var rfqStateNames = map[int]string{auction.RfqOpen: "open",
+	auction.RfqDone: "done", auction.RfqCanceled: "canceled"}
+
+type quoteView struct {
+	ID       int    `json:"id"`
+	Account  string `json:"account"`
+	BidPrice int    `json:"bidPrice,omitempty"`
+	AskPrice int    `json:"askPrice,omitempty"`
+}
+
+type rfqView struct {
+	ID        int         `json:"id"`
+	Symbol    string      `json:"symbol"`
+	Qty       int         `json:"qty"`
+	Requester string      `json:"requester"`
+	State     string      `json:"state"`
+	Quotes    []quoteView `json:"quotes"`
+}
+
+type blockView struct {
+	TradeNo int    `json:"tradeNo"`
+	RfqID   int    `json:"rfqID"`
+	Symbol  string `json:"symbol"`
+	Price   int    `json:"price"`
+	Qty     int    `json:"qty"`
+	Buyer   string `json:"buyer"`
+	Seller  string `json:"seller"`
+}
+
+// rfqRequest is body of RFQ calls, Symbol and Qty of new RFQ, Bid and Ask
+// of quote, QuoteID and Side of accept
+type rfqRequest struct {
+	Account string `json:"account"`
+	Symbol  string `json:"symbol"`
+	Qty     int    `json:"qty"`
+	Bid     int    `json:"bid"`
+	Ask     int    `json:"ask"`
+	QuoteID int    `json:"quoteID"`
+	Side    string `json:"side"`
+}
+
+func newRfqView(rfq *auction.Rfq) *rfqView {
+	res := &rfqView{ID: rfq.ID, Symbol: rfq.Symbol, Qty: rfq.Qty,
+		Requester: rfq.Requester, State: rfqStateNames[rfq.State],
+		Quotes: []quoteView{}}
+	for _, q := range rfq.Quotes {
+		res.Quotes = append(res.Quotes, quoteView{ID: q.ID, Account: q.Account,
+			BidPrice: q.BidPrice, AskPrice: q.AskPrice})
+	}
+	return res
+}
+
+// GET /rfqs?sym= open RFQs, POST /rfqs new RFQ
+func (srv *httpServer) handleRfqs(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet, http.MethodPost) {
+		return
+	}
+	if r.Method == http.MethodGet {
+		res := []*rfqView{}
+		srv.mu.Lock()
+		for _, id := range auction.OpenRfqs(r.URL.Query().Get("sym")) {
+			rfq, _ := auction.GetRfq(id)
+			res = append(res, newRfqView(&rfq))
+		}
+		srv.mu.Unlock()
+		writeJSON(w, http.StatusOK, res)
+		return
+	}
+	var req rfqRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.Account == "" || req.Symbol == "" || req.Qty <= 0 {
+		writeError(w, http.StatusBadRequest, errRfqReq)
+		return
+	}
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	id, err := auction.RequestQuote(req.Account, req.Symbol, req.Qty)
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	rfq, _ := auction.GetRfq(id)
+	writeJSON(w, http.StatusCreated, newRfqView(&rfq))
+}
+
+// GET|DELETE /rfqs/{id}, DELETE?account= cancel by requester,
+// POST /rfqs/{id}/quotes quote, POST /rfqs/{id}/accept block trade
+func (srv *httpServer) handleRfq(w http.ResponseWriter, r *http.Request) {
+	path := strings.Split(strings.TrimPrefix(r.URL.Path, "/rfqs/"), "/")
+	id, err := strconv.Atoi(path[0])
+	if err != nil || id <= 0 || len(path) > 2 {
+		writeError(w, http.StatusBadRequest, errRfqID)
+		return
+	}
+	action := ""
+	if len(path) == 2 {
+		action = path[1]
+	}
+	switch action {
+	case "":
+		if !allowMethod(w, r, http.MethodGet, http.MethodDelete) {
+			return
+		}
+	case "quotes", "accept":
+		if !allowMethod(w, r, http.MethodPost) {
+			return
+		}
+	default:
+		writeError(w, http.StatusNotFound, errNoRfq)
+		return
+	}
+	var req rfqRequest
+	if r.Method == http.MethodPost {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if action == "accept" && req.Side != "buy" && req.Side != "sell" {
+			writeError(w, http.StatusBadRequest, errSide)
+			return
+		}
+	}
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if _, ok := auction.GetRfq(id); !ok {
+		writeError(w, http.StatusNotFound, errNoRfq)
+		return
+	}
+	code := http.StatusOK
+	switch {
+	case action == "quotes":
+		_, err = auction.QuoteRfq(id, req.Account, req.Bid, req.Ask)
+		code = http.StatusCreated
+	case action == "accept":
+		var tNo int
+		tNo, err = auction.AcceptQuote(id, req.Account, req.QuoteID, req.Side == "buy")
+		if err == nil {
+			srv.writeBlock(w, tNo)
+			return
+		}
+	case r.Method == http.MethodDelete:
+		err = auction.CancelRfq(id, r.URL.Query().Get("account"))
+	}
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	rfq, _ := auction.GetRfq(id)
+	writeJSON(w, code, newRfqView(&rfq))
+}
+
+// onRfq record block trades, hold mu
+func (srv *httpServer) onRfq(ev *auction.RfqEvent) {
+	if ev.Type == auction.RfqEventTrade {
+		srv.blocks[ev.Trade.TradeNo] = ev.Trade
+	}
+}
+
+// writeBlock write block trade tNo of accepted RFQ
+func (srv *httpServer) writeBlock(w http.ResponseWriter, tNo int) {
+	bt := srv.blocks[tNo]
+	writeJSON(w, http.StatusOK, &blockView{TradeNo: bt.TradeNo, RfqID: bt.RfqID,
+		Symbol: bt.Symbol, Price: bt.Price, Qty: bt.Qty, Buyer: bt.Buyer,
+		Seller: bt.Seller})
+}
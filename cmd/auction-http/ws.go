@@ -0,0 +1,398 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	auction "github.com/kjx98/go-auction"
+)
+
+// minimal RFC 6455 server side WebSocket, text messages only
+const (
+	wsGUID        = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	wsOpCont      = 0
+	wsOpText      = 1
+	wsOpBinary    = 2
+	wsOpClose     = 8
+	wsOpPing      = 9
+	wsOpPong      = 10
+	wsMaxMessage  = 65536
+	wsOutQueue    = 1024
+	wsPingPeriod  = 30 * time.Second
+	wsReadTimeout = 2 * wsPingPeriod
+)
+
+var (
+	errWsHandshake = errors.New("not a WebSocket handshake")
+	errWsTooLarge  = errors.New("WebSocket message too large")
+)
+
+func wsAcceptKey(key string) string {
+	h := sha1.Sum([]byte(key + wsGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+func headerContains(h http.Header, name, token string) bool {
+	for _, v := range h[http.CanonicalHeaderKey(name)] {
+		for _, s := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(s), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// wsFrame encode unmasked server frame
+func wsFrame(op byte, payload []byte) []byte {
+	n := len(payload)
+	b := make([]byte, 0, n+10)
+	b = append(b, 0x80|op)
+	switch {
+	case n < 126:
+		b = append(b, byte(n))
+	case n < 65536:
+		b = append(b, 126, byte(n>>8), byte(n))
+	default:
+		var ext [8]byte
+		binary.BigEndian.PutUint64(ext[:], uint64(n))
+		b = append(b, 127)
+		b = append(b, ext[:]...)
+	}
+	return append(b, payload...)
+}
+
+// readWsFrame read one frame, unmask payload if masked
+func readWsFrame(rd *bufio.Reader) (fin bool, op byte, payload []byte, err error) {
+	var hdr [2]byte
+	if _, err = io.ReadFull(rd, hdr[:]); err != nil {
+		return
+	}
+	fin = hdr[0]&0x80 != 0
+	op = hdr[0] & 0x0f
+	masked := hdr[1]&0x80 != 0
+	n := uint64(hdr[1] & 0x7f)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(rd, ext[:]); err != nil {
+			return
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(rd, ext[:]); err != nil {
+			return
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if n > wsMaxMessage {
+		err = errWsTooLarge
+		return
+	}
+	var mask [4]byte
+	if masked {
+		if _, err = io.ReadFull(rd, mask[:]); err != nil {
+			return
+		}
+	}
+	payload = make([]byte, n)
+	if _, err = io.ReadFull(rd, payload); err != nil {
+		return
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i&3]
+		}
+	}
+	return
+}
+
+// wsClient is one WebSocket connection, out never block engine
+// lagged set when out is full, messages dropped until queue drained, then
+// snapshots of subscribed symbols resent
+type wsClient struct {
+	conn   net.Conn
+	out    chan []byte
+	subs   map[string]bool
+	lagged bool
+	closed bool
+}
+
+// wsRequest is client command, Op subscribe or unsubscribe
+type wsRequest struct {
+	Op      string   `json:"op"`
+	Symbols []string `json:"symbols"`
+}
+
+type wsSnapshot struct {
+	Type   string      `json:"type"`
+	Symbol string      `json:"symbol"`
+	Seq    uint64      `json:"seq"`
+	Bids   []levelView `json:"bids"`
+	Asks   []levelView `json:"asks"`
+}
+
+type wsDepth struct {
+	Type   string `json:"type"`
+	Symbol string `json:"symbol"`
+	Seq    uint64 `json:"seq"`
+	Action string `json:"action"`
+	Side   string `json:"side"`
+	Price  int    `json:"price"`
+	Volume int    `json:"volume"`
+}
+
+type wsTrade struct {
+	Type string `json:"type"`
+	Seq  uint64 `json:"seq"`
+	tradeView
+}
+
+// wsState is session state, or state of Symbol if set
+type wsState struct {
+	Type   string `json:"type"`
+	Symbol string `json:"symbol,omitempty"`
+	State  string `json:"state"`
+}
+
+type wsError struct {
+	Type  string `json:"type"`
+	Error string `json:"error"`
+}
+
+var depthActions = map[int]string{
+	auction.MdNewLevel:    "new",
+	auction.MdChangeLevel: "change",
+	auction.MdDeleteLevel: "delete",
+}
+
+// send queue encoded frame, hold srv.mu
+func (c *wsClient) send(frame []byte) {
+	if c.closed || c.lagged {
+		return
+	}
+	select {
+	case c.out <- frame:
+	default:
+		c.lagged = true
+	}
+}
+
+func (c *wsClient) sendJSON(v interface{}) {
+	if b, err := json.Marshal(v); err == nil {
+		c.send(wsFrame(wsOpText, b))
+	}
+}
+
+func (c *wsClient) close() {
+	if c.closed {
+		return
+	}
+	c.closed = true
+	close(c.out)
+}
+
+// GET /ws
+func (srv *httpServer) handleWs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet || !headerContains(r.Header, "Connection", "upgrade") ||
+		!headerContains(r.Header, "Upgrade", "websocket") ||
+		r.Header.Get("Sec-WebSocket-Key") == "" {
+		writeError(w, http.StatusBadRequest, errWsHandshake)
+		return
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errWsHandshake)
+		return
+	}
+	conn, brw, err := hj.Hijack()
+	if err != nil {
+		log.Warning("hijack", err)
+		return
+	}
+	resp := "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\n" +
+		"Connection: Upgrade\r\nSec-WebSocket-Accept: " +
+		wsAcceptKey(r.Header.Get("Sec-WebSocket-Key")) + "\r\n\r\n"
+	if _, err := conn.Write([]byte(resp)); err != nil {
+		conn.Close()
+		return
+	}
+	c := &wsClient{conn: conn, out: make(chan []byte, wsOutQueue),
+		subs: map[string]bool{}}
+	srv.mu.Lock()
+	srv.clients[c] = true
+	c.sendJSON(&wsState{Type: "state", State: stateNames[auction.MarketState()]})
+	srv.mu.Unlock()
+	go srv.wsWriter(c)
+	srv.wsReader(c, brw.Reader)
+}
+
+func (srv *httpServer) wsReader(c *wsClient, rd *bufio.Reader) {
+	defer func() {
+		srv.mu.Lock()
+		delete(srv.clients, c)
+		c.close()
+		srv.mu.Unlock()
+	}()
+	var msg []byte
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(wsReadTimeout))
+		fin, op, payload, err := readWsFrame(rd)
+		if err != nil {
+			return
+		}
+		switch op {
+		case wsOpClose:
+			return
+		case wsOpPing:
+			srv.mu.Lock()
+			c.send(wsFrame(wsOpPong, payload))
+			srv.mu.Unlock()
+			continue
+		case wsOpPong:
+			continue
+		case wsOpText, wsOpBinary, wsOpCont:
+			msg = append(msg, payload...)
+		default:
+			return
+		}
+		if len(msg) > wsMaxMessage {
+			return
+		}
+		if !fin {
+			continue
+		}
+		srv.onWsRequest(c, msg)
+		msg = nil
+	}
+}
+
+// wsWriter write queued messages, ping when idle
+func (srv *httpServer) wsWriter(c *wsClient) {
+	defer c.conn.Close()
+	tk := time.NewTicker(wsPingPeriod)
+	defer tk.Stop()
+	for {
+		select {
+		case frame, ok := <-c.out:
+			if !ok {
+				c.conn.Write(wsFrame(wsOpClose, nil))
+				return
+			}
+			c.conn.SetWriteDeadline(time.Now().Add(wsReadTimeout))
+			if _, err := c.conn.Write(frame); err != nil {
+				return
+			}
+			if len(c.out) == 0 {
+				srv.wsResync(c)
+			}
+		case <-tk.C:
+			c.conn.SetWriteDeadline(time.Now().Add(wsReadTimeout))
+			if _, err := c.conn.Write(wsFrame(wsOpPing, nil)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// wsResync resend snapshots after lagged client drained its queue
+func (srv *httpServer) wsResync(c *wsClient) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if !c.lagged || c.closed {
+		return
+	}
+	c.lagged = false
+	for sym := range c.subs {
+		srv.wsSnapshot(c, sym)
+	}
+}
+
+func (srv *httpServer) wsSnapshot(c *wsClient, sym string) {
+	seq, bids, asks := auction.MdSnapshot(sym)
+	c.sendJSON(&wsSnapshot{Type: "snapshot", Symbol: sym, Seq: seq,
+		Bids: levels(bids, 0), Asks: levels(asks, 0)})
+}
+
+func (srv *httpServer) onWsRequest(c *wsClient, msg []byte) {
+	var req wsRequest
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if err := json.Unmarshal(msg, &req); err != nil {
+		c.sendJSON(&wsError{Type: "error", Error: err.Error()})
+		return
+	}
+	switch req.Op {
+	case "subscribe":
+		for _, sym := range req.Symbols {
+			if sym == "" || c.subs[sym] {
+				continue
+			}
+			c.subs[sym] = true
+			srv.wsSnapshot(c, sym)
+		}
+	case "unsubscribe":
+		for _, sym := range req.Symbols {
+			delete(c.subs, sym)
+		}
+	default:
+		c.sendJSON(&wsError{Type: "error", Error: "unknown op " + req.Op})
+	}
+}
+
+// wsOnMd stream depth and trades to subscribed clients, hold mu
+func (srv *httpServer) wsOnMd(md *auction.MdUpdate, tr *tradeView) {
+	if len(srv.clients) == 0 {
+		return
+	}
+	var frame []byte
+	for c := range srv.clients {
+		if !c.subs[md.Symbol] {
+			continue
+		}
+		if frame == nil {
+			var msg []byte
+			if tr != nil {
+				msg, _ = json.Marshal(&wsTrade{Type: "trade", Seq: md.Seq,
+					tradeView: *tr})
+			} else {
+				msg, _ = json.Marshal(&wsDepth{Type: "depth", Symbol: md.Symbol,
+					Seq: md.Seq, Action: depthActions[md.Action],
+					Side: sideName(md.IsBuy), Price: md.Price, Volume: md.Volume})
+			}
+			frame = wsFrame(wsOpText, msg)
+		}
+		c.send(frame)
+	}
+}
+
+// onState stream session state to all clients, hold mu
+func (srv *httpServer) onState(state int) {
+	msg, _ := json.Marshal(&wsState{Type: "state", State: stateNames[state]})
+	frame := wsFrame(wsOpText, msg)
+	for c := range srv.clients {
+		c.send(frame)
+	}
+}
+
+// onSymbolState stream symbol state to subscribed clients, hold mu
+func (srv *httpServer) onSymbolState(sym string, state int) {
+	msg, _ := json.Marshal(&wsState{Type: "state", Symbol: sym,
+		State: stateNames[state]})
+	frame := wsFrame(wsOpText, msg)
+	for c := range srv.clients {
+		if c.subs[sym] {
+			c.send(frame)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type wsTestClient struct {
+	t    *testing.T
+	conn net.Conn
+	rd   *bufio.Reader
+}
+
+func dialWs(t *testing.T, addr string) *wsTestClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal("dial", err)
+	}
+	key := "dGhlIHNhbXBsZSBub25jZQ=="
+	req := "GET /ws HTTP/1.1\r\nHost: " + addr + "\r\nUpgrade: websocket\r\n" +
+		"Connection: Upgrade\r\nSec-WebSocket-Key: " + key +
+		"\r\nSec-WebSocket-Version: 13\r\n\r\n"
+	if _, err := conn.Write([]byte(req)); err != nil {
+		t.Fatal("handshake", err)
+	}
+	rd := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(rd, nil)
+	if err != nil || resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatal("handshake response", resp, err)
+	}
+	// sample accept key of RFC 6455
+	if resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Error("Sec-WebSocket-Accept", resp.Header.Get("Sec-WebSocket-Accept"))
+	}
+	return &wsTestClient{t: t, conn: conn, rd: rd}
+}
+
+// send masked text frame
+func (c *wsTestClient) send(msg string) {
+	mask := []byte{1, 2, 3, 4}
+	b := []byte{0x80 | wsOpText, 0x80 | byte(len(msg))}
+	b = append(b, mask...)
+	for i := 0; i < len(msg); i++ {
+		b = append(b, msg[i]^mask[i&3])
+	}
+	if _, err := c.conn.Write(b); err != nil {
+		c.t.Fatal("write", err)
+	}
+}
+
+func (c *wsTestClient) recv() map[string]interface{} {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	for {
+		_, op, payload, err := readWsFrame(c.rd)
+		if err != nil {
+			c.t.Fatal("read", err)
+		}
+		if op != wsOpText {
+			continue
+		}
+		var res map[string]interface{}
+		if err := json.Unmarshal(payload, &res); err != nil {
+			c.t.Fatal("decode", err)
+		}
+		return res
+	}
+}
+
+func (c *wsTestClient) expect(want map[string]interface{}) map[string]interface{} {
+	c.t.Helper()
+	m := c.recv()
+	for k, v := range want {
+		if m[k] != v {
+			c.t.Fatalf("got %v, want %s = %v", m, k, v)
+		}
+	}
+	return m
+}
+
+func TestWebSocket(t *testing.T) {
+	sym := "cu1910"
+	ts := httptest.NewServer(testSrv)
+	defer ts.Close()
+	c := dialWs(t, strings.TrimPrefix(ts.URL, "http://"))
+	defer c.conn.Close()
+	c.expect(map[string]interface{}{"type": "state", "state": "trading"})
+	c.send(`{"op":"subscribe","symbols":["` + sym + `"]}`)
+	snap := c.expect(map[string]interface{}{"type": "snapshot", "symbol": sym})
+	seq := snap["seq"].(float64)
+	postOrder(t, sym, "buy", 5, 42000)
+	c.expect(map[string]interface{}{"type": "depth", "seq": seq + 1,
+		"action": "new", "side": "buy", "price": 42000.0, "volume": 5.0})
+	postOrder(t, sym, "sell", 2, 42000)
+	c.expect(map[string]interface{}{"type": "trade", "seq": seq + 2,
+		"price": 42000.0, "volume": 2.0, "side": "sell"})
+	c.expect(map[string]interface{}{"type": "depth", "seq": seq + 3,
+		"action": "change", "volume": 3.0})
+	c.send(`{"op":"unsubscribe","symbols":["` + sym + `"]}`)
+	c.send(`{"op":"bad"}`)
+	c.expect(map[string]interface{}{"type": "error"})
+	postOrder(t, sym, "buy", 1, 41000)
+	c.send(`{"op":"subscribe","symbols":["cu1911"]}`)
+	c.expect(map[string]interface{}{"type": "snapshot", "symbol": "cu1911"})
+	doRequest(t, http.MethodPost, "/admin/halt?sym=cu1911", "", http.StatusOK, nil)
+	c.expect(map[string]interface{}{"type": "state", "symbol": "cu1911",
+		"state": "halted"})
+	doRequest(t, http.MethodPost, "/admin/resume?sym=cu1911", "", http.StatusOK, nil)
+	c.expect(map[string]interface{}{"type": "state", "symbol": "cu1911",
+		"state": "callAuction"})
+	// reopening auction trades and depth before trading state
+	m := c.recv()
+	for m["type"] != "state" {
+		m = c.recv()
+	}
+	if m["symbol"] != "cu1911" || m["state"] != "trading" {
+		t.Errorf("state after reopening %v", m)
+	}
+	doRequest(t, http.MethodPost, "/admin/stop", "", http.StatusOK, nil)
+	c.expect(map[string]interface{}{"type": "state", "state": "stop"})
+	doRequest(t, http.MethodPost, "/admin/start", "", http.StatusOK, nil)
+	c.expect(map[string]interface{}{"type": "state", "state": "trading"})
+	// request without upgrade rejected
+	doRequest(t, http.MethodGet, "/ws", "", http.StatusBadRequest, nil)
+}
+
+func TestWsBackpressure(t *testing.T) {
+	c := &wsClient{out: make(chan []byte, 1), subs: map[string]bool{"cu1910": true}}
+	testSrv.mu.Lock()
+	c.send([]byte("a"))
+	c.send([]byte("b"))
+	testSrv.mu.Unlock()
+	if !c.lagged || len(c.out) != 1 {
+		t.Fatalf("lagged %v, queued %d", c.lagged, len(c.out))
+	}
+	<-c.out
+	testSrv.wsResync(c)
+	if c.lagged || len(c.out) != 1 {
+		t.Fatalf("after resync lagged %v, queued %d", c.lagged, len(c.out))
+	}
+	frame := <-c.out
+	_, op, payload, err := readWsFrame(bufio.NewReader(strings.NewReader(string(frame))))
+	if err != nil || op != wsOpText || !strings.Contains(string(payload), `"snapshot"`) {
+		t.Errorf("resync frame %d %s %v", op, payload, err)
+	}
+}
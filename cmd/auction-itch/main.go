@@ -0,0 +1,189 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"runtime"
+	"time"
+
+	auction "github.com/kjx98/go-auction"
+	"github.com/op/go-logging"
+)
+
+var (
+	udpAddr     string
+	retransAddr string
+	session     string
+	symbol      string
+	count       int
+	pclose      int
+	holdTime    time.Duration
+	checkBook   bool
+	verbose     bool
+)
+
+var log = logging.MustGetLogger("auction-itch")
+
+// simulate publish a simulated session of sym, call auction with imbalance
+// then continuous trading with random cancels
+func simulate(feed *auction.ItchFeed, pub *moldPublisher, sym string, n int) {
+	var oids []int
+	send := func() {
+		price := rand.Intn(2000) + pclose - 1000
+		vol := rand.Intn(100) + 1
+		if oid := auction.SendOrder(sym, (price&1) != 0, vol, price); oid != 0 {
+			oids = append(oids, oid)
+		}
+	}
+	for i := 0; i < n/2; i++ {
+		send()
+		pub.flush()
+	}
+	feed.Imbalance(sym, pclose)
+	last, vol, _ := auction.Uncross(sym, pclose)
+	log.Infof("Uncross price: %d, volume: %d", last, vol)
+	auction.MarketStart(false)
+	pub.flush()
+	for i := n / 2; i < n; i++ {
+		if i%5 == 0 && len(oids) > 0 {
+			auction.CancelOrder(oids[rand.Intn(len(oids))])
+		} else {
+			send()
+		}
+		pub.flush()
+	}
+	auction.MarketStop()
+	pub.flush()
+}
+
+func runPublish() error {
+	var rcv *moldReceiver
+	if checkBook {
+		var err error
+		if rcv, err = newMoldReceiver(session, udpAddr, retransAddr); err != nil {
+			return err
+		}
+		defer rcv.close()
+		go rcv.run()
+	}
+	pub, err := newMoldPublisher(session, udpAddr)
+	if err != nil {
+		return err
+	}
+	defer pub.close()
+	if err := pub.listenRetrans(retransAddr); err != nil {
+		return err
+	}
+	feed := auction.NewItchFeed(pub.add)
+	rand.Seed(time.Now().Unix())
+	simulate(feed, pub, symbol, count)
+	fmt.Fprintf(os.Stderr, "published %d messages\n", feed.Seq())
+	// keep retransmission service for late receivers
+	time.Sleep(holdTime)
+	pub.endSession()
+	if rcv == nil {
+		return nil
+	}
+	select {
+	case <-rcv.done:
+	case <-time.After(moldRetransWait):
+	}
+	if rcv.seq() != feed.Seq() {
+		return fmt.Errorf("received %d messages, published %d", rcv.seq(), feed.Seq())
+	}
+	if err := rcv.verify(symbol); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "orderBook of %s verified, %d messages recovered\n",
+		symbol, rcv.recovered)
+	return nil
+}
+
+// runDecode receive stream until end of session, print rebuilt orderBook
+func runDecode() error {
+	rcv, err := newMoldReceiver(session, udpAddr, retransAddr)
+	if err != nil {
+		return err
+	}
+	defer rcv.close()
+	var trades, volume int
+	rcv.onMsg = func(m *auction.ItchMsg) {
+		switch m.Type {
+		case auction.ItchTrade, auction.ItchCross:
+			trades++
+			volume += m.Qty
+		case auction.ItchImbalance:
+			fmt.Printf("%s imbalance price %d paired %d imbalance %d buy %v\n",
+				m.Symbol, m.Price, m.Paired, m.Imbalance, m.IsBuy)
+		case auction.ItchTradingAction:
+			fmt.Printf("%s trading state %d\n", m.Symbol, m.State)
+		}
+	}
+	rcv.run()
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	bids, asks := rcv.book.Orders(symbol)
+	fmt.Printf("messages %d (recovered %d), state %d, trades %d volume %d\n",
+		rcv.book.Seq(), rcv.recovered, rcv.book.State(), trades, volume)
+	fmt.Printf("%s orders bid %d ask %d\n", symbol, len(bids), len(asks))
+	for i := 0; i < 5 && (i < len(bids) || i < len(asks)); i++ {
+		var b, a auction.ItchOrder
+		if i < len(bids) {
+			b = bids[i]
+		}
+		if i < len(asks) {
+			a = asks[i]
+		}
+		fmt.Printf("%8d %6d | %8d %6d\n", b.Price, b.Qty, a.Price, a.Qty)
+	}
+	return nil
+}
+
+func main() {
+	flag.StringVar(&udpAddr, "udp", "127.0.0.1:9880", "UDP destination, multicast group or localhost")
+	flag.StringVar(&retransAddr, "retrans", "127.0.0.1:9881", "TCP retransmission service address")
+	flag.StringVar(&session, "session", "AUCTION", "MoldUDP64 session")
+	flag.StringVar(&symbol, "sym", "cu1908", "symbol of simulated session")
+	flag.IntVar(&count, "n", 10000, "orders of simulated session")
+	flag.IntVar(&pclose, "pclose", 50000, "previous close price")
+	flag.DurationVar(&holdTime, "hold", time.Second, "retransmission hold time before end of session")
+	flag.BoolVar(&checkBook, "check", false, "receive on udp address and verify orderBook")
+	flag.BoolVar(&verbose, "v", false, "verbose log")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: auction-itch [options] [decode]\n")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+	flag.Parse()
+	if !verbose {
+		logging.SetLevel(logging.WARNING, "go-auction")
+	}
+	var err error
+	if flag.Arg(0) == "decode" {
+		err = runDecode()
+	} else {
+		err = runPublish()
+	}
+	if err != nil {
+		log.Error(err)
+		os.Exit(1)
+	}
+}
+
+// `%{color}%{time:15:04:05.000} %{shortfunc} ▶ %{level:.4s} %{id:03x}%{color:reset} %{message}`
+func init() {
+	var format = logging.MustStringFormatter(
+		`%{color}%{time:01-02 15:04:05}  ▶ %{level:.4s} %{color:reset} %{message}`,
+	)
+
+	if runtime.GOARCH != "amd64" {
+		format = logging.MustStringFormatter(
+			`%{time:01-02 15:04:05} %{level:.4s} %{message}`,
+		)
+	}
+	logback := logging.NewLogBackend(os.Stderr, "", 0)
+	logfmt := logging.NewBackendFormatter(logback, format)
+	logging.SetBackend(logfmt)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	auction "github.com/kjx98/go-auction"
+	"github.com/op/go-logging"
+)
+
+func TestMoldPacket(t *testing.T) {
+	msgs := [][]byte{[]byte("abc"), []byte("de")}
+	p, err := decodeMold(encodeMold("AUCTION", 5, msgs))
+	if err != nil || p.session != "AUCTION" || p.seq != 5 || len(p.msgs) != 2 ||
+		string(p.msgs[0]) != "abc" || string(p.msgs[1]) != "de" {
+		t.Errorf("decodeMold %+v %v", p, err)
+	}
+	b := encodeMold("AUCTION", 5, msgs)
+	if _, err := decodeMold(b[:len(b)-1]); err != errMoldPacket {
+		t.Errorf("short packet error %v", err)
+	}
+	p, err = decodeMold(moldHeader("AUCTION", 7, moldEndSession))
+	if err != nil || p.count != moldEndSession {
+		t.Errorf("end of session %+v %v", p, err)
+	}
+}
+
+func TestItchRecovery(t *testing.T) {
+	logging.SetLevel(logging.ERROR, "go-auction")
+	logging.SetLevel(logging.ERROR, "auction-itch")
+	sym := "cu1908"
+	rcv, err := newMoldReceiver("AUCTION", "127.0.0.1:0", "")
+	if err != nil {
+		t.Fatal("newMoldReceiver", err)
+	}
+	defer rcv.close()
+	pub, err := newMoldPublisher("AUCTION", rcv.conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal("newMoldPublisher", err)
+	}
+	defer pub.close()
+	if err := pub.listenRetrans("127.0.0.1:0"); err != nil {
+		t.Fatal("listenRetrans", err)
+	}
+	rcv.retrans = pub.ln.Addr().String()
+	// lose every 7th packet, recovered by retransmission
+	pub.drop = func(seq uint64) bool {
+		return seq%7 == 0
+	}
+	go rcv.run()
+	feed := auction.NewItchFeed(pub.add)
+	defer feed.Stop()
+	pclose = 50000
+	simulate(feed, pub, sym, 2000)
+	pub.endSession()
+	select {
+	case <-rcv.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("end of session not received")
+	}
+	if rcv.seq() != feed.Seq() {
+		t.Fatalf("received %d messages, published %d", rcv.seq(), feed.Seq())
+	}
+	if rcv.recovered == 0 {
+		t.Error("no message recovered")
+	}
+	if err := rcv.verify(sym); err != nil {
+		t.Error(err)
+	}
+	if bids, asks := auction.BuildOrBk(sym); len(bids)+len(asks) == 0 {
+		t.Error("empty orderBook")
+	}
+}
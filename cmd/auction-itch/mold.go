@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MoldUDP64 like packet: session 10 bytes, sequence number of first
+// message uint64, message count uint16, then messages each prefixed by
+// uint16 length, count 0 is heartbeat and 0xffff end of session
+// retransmission request over TCP is packet header with count of messages
+// wanted, response packets prefixed by uint16 length
+const (
+	moldSessionLen  = 10
+	moldHdrLen      = moldSessionLen + 8 + 2
+	moldMTU         = 1400
+	moldEndSession  = 0xffff
+	moldMaxRetrans  = 1000
+	moldHbInterval  = time.Second
+	moldRetransWait = 3 * time.Second
+)
+
+var (
+	errMoldPacket  = errors.New("wrong MoldUDP64 packet")
+	errMoldSession = errors.New("MoldUDP64 session mismatch")
+)
+
+type moldPacket struct {
+	session string
+	seq     uint64
+	count   int
+	msgs    [][]byte
+}
+
+func moldHeader(session string, seq uint64, count int) []byte {
+	b := make([]byte, moldHdrLen, moldMTU)
+	copy(b, strings.Repeat(" ", moldSessionLen))
+	copy(b, session)
+	binary.BigEndian.PutUint64(b[moldSessionLen:], seq)
+	binary.BigEndian.PutUint16(b[moldSessionLen+8:], uint16(count))
+	return b
+}
+
+// encodeMold pack messages of seq into one packet
+func encodeMold(session string, seq uint64, msgs [][]byte) []byte {
+	b := moldHeader(session, seq, len(msgs))
+	for _, m := range msgs {
+		b = append(b, byte(len(m)>>8), byte(len(m)))
+		b = append(b, m...)
+	}
+	return b
+}
+
+func decodeMoldHeader(b []byte) (*moldPacket, error) {
+	if len(b) < moldHdrLen {
+		return nil, errMoldPacket
+	}
+	p := &moldPacket{session: strings.TrimSpace(string(b[:moldSessionLen]))}
+	p.seq = binary.BigEndian.Uint64(b[moldSessionLen:])
+	p.count = int(binary.BigEndian.Uint16(b[moldSessionLen+8:]))
+	return p, nil
+}
+
+func decodeMold(b []byte) (*moldPacket, error) {
+	p, err := decodeMoldHeader(b)
+	if err != nil || p.count == moldEndSession {
+		return p, err
+	}
+	b = b[moldHdrLen:]
+	for i := 0; i < p.count; i++ {
+		if len(b) < 2 {
+			return nil, errMoldPacket
+		}
+		n := int(binary.BigEndian.Uint16(b))
+		if len(b) < 2+n {
+			return nil, errMoldPacket
+		}
+		p.msgs = append(p.msgs, b[2:2+n])
+		b = b[2+n:]
+	}
+	return p, nil
+}
+
+// moldPublisher send ITCH messages in MoldUDP64 packets, keep all messages
+// for retransmission
+type moldPublisher struct {
+	mu      sync.Mutex
+	session string
+	conn    *net.UDPConn
+	msgs    [][]byte
+	// last sequence number sent
+	sent     uint64
+	pending  int
+	lastSent time.Time
+	ended    bool
+	ln       net.Listener
+	// test hook, packet not sent if drop return true
+	drop func(seq uint64) bool
+}
+
+func newMoldPublisher(session, dest string) (*moldPublisher, error) {
+	addr, err := net.ResolveUDPAddr("udp", dest)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialUDP("udp", nil, addr)
+	if err != nil {
+		return nil, err
+	}
+	p := &moldPublisher{session: session, conn: conn}
+	go p.heartbeat()
+	return p, nil
+}
+
+// add is ItchHandler of ItchFeed, called by engine
+func (p *moldPublisher) add(seq uint64, msg []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if seq != uint64(len(p.msgs))+1 {
+		log.Errorf("ITCH seq %d, want %d", seq, len(p.msgs)+1)
+	}
+	if p.pending+2+len(msg) > moldMTU-moldHdrLen {
+		p.flushLocked()
+	}
+	p.msgs = append(p.msgs, msg)
+	p.pending += 2 + len(msg)
+}
+
+// flush send all queued messages, called after each engine operation
+func (p *moldPublisher) flush() {
+	p.mu.Lock()
+	p.flushLocked()
+	p.mu.Unlock()
+}
+
+func (p *moldPublisher) flushLocked() {
+	p.pending = 0
+	for p.sent < uint64(len(p.msgs)) {
+		seq := p.sent + 1
+		msgs := p.batch(seq, moldMTU)
+		p.sent += uint64(len(msgs))
+		if p.drop != nil && p.drop(seq) {
+			continue
+		}
+		p.write(encodeMold(p.session, seq, msgs))
+	}
+}
+
+// batch return messages from seq fit in size
+func (p *moldPublisher) batch(seq uint64, size int) [][]byte {
+	var res [][]byte
+	n := moldHdrLen
+	for i := seq - 1; i < uint64(len(p.msgs)); i++ {
+		m := p.msgs[i]
+		if n+2+len(m) > size || len(res) >= moldMaxRetrans {
+			break
+		}
+		n += 2 + len(m)
+		res = append(res, m)
+	}
+	return res
+}
+
+func (p *moldPublisher) write(b []byte) {
+	p.lastSent = time.Now()
+	if _, err := p.conn.Write(b); err != nil {
+		log.Warning("UDP write", err)
+	}
+}
+
+func (p *moldPublisher) heartbeat() {
+	tk := time.NewTicker(moldHbInterval / 4)
+	defer tk.Stop()
+	for range tk.C {
+		p.mu.Lock()
+		if p.ended {
+			p.mu.Unlock()
+			return
+		}
+		p.flushLocked()
+		if time.Since(p.lastSent) >= moldHbInterval {
+			p.write(moldHeader(p.session, p.sent+1, 0))
+		}
+		p.mu.Unlock()
+	}
+}
+
+// endSession flush and send end of session
+func (p *moldPublisher) endSession() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.flushLocked()
+	p.ended = true
+	p.write(moldHeader(p.session, p.sent+1, moldEndSession))
+}
+
+func (p *moldPublisher) close() {
+	p.mu.Lock()
+	p.ended = true
+	p.mu.Unlock()
+	if p.ln != nil {
+		p.ln.Close()
+	}
+	p.conn.Close()
+}
+
+// listenRetrans start retransmission service on TCP addr
+func (p *moldPublisher) listenRetrans(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	p.ln = ln
+	log.Info("retransmission listen on", ln.Addr())
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go p.serveRetrans(conn)
+		}
+	}()
+	return nil
+}
+
+func (p *moldPublisher) serveRetrans(conn net.Conn) {
+	defer conn.Close()
+	rd := bufio.NewReader(conn)
+	req := make([]byte, moldHdrLen)
+	for {
+		conn.SetReadDeadline(time.Now().Add(time.Minute))
+		if _, err := io.ReadFull(rd, req); err != nil {
+			return
+		}
+		rp, err := decodeMoldHeader(req)
+		if err != nil || rp.session != p.session {
+			log.Warning("bad retransmission request from", conn.RemoteAddr())
+			return
+		}
+		count := rp.count
+		if count > moldMaxRetrans {
+			count = moldMaxRetrans
+		}
+		p.mu.Lock()
+		var out []byte
+		for seq := rp.seq; count > 0 && seq > 0 && seq <= p.sent; {
+			msgs := p.batch(seq, moldMTU)
+			if len(msgs) > count {
+				msgs = msgs[:count]
+			}
+			b := encodeMold(p.session, seq, msgs)
+			out = append(out, byte(len(b)>>8), byte(len(b)))
+			out = append(out, b...)
+			seq += uint64(len(msgs))
+			count -= len(msgs)
+		}
+		if len(out) == 0 {
+			// nothing to resend, answer with heartbeat of next seq
+			b := moldHeader(p.session, p.sent+1, 0)
+			out = append([]byte{0, byte(len(b))}, b...)
+		}
+		p.mu.Unlock()
+		if _, err := conn.Write(out); err != nil {
+			return
+		}
+	}
+}
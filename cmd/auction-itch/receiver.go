@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	auction "github.com/kjx98/go-auction"
+)
+
+// moldReceiver rebuild orderBooks from MoldUDP64 stream, gap recovered
+// from retransmission service
+type moldReceiver struct {
+	mu      sync.Mutex
+	session string
+	conn    *net.UDPConn
+	retrans string
+	book    *auction.ItchBook
+	// messages recovered by retransmission
+	recovered int
+	ended     bool
+	done      chan struct{}
+	// called with each applied message, hold mu
+	onMsg func(m *auction.ItchMsg)
+}
+
+// newMoldReceiver listen on UDP addr, join group if addr is multicast
+func newMoldReceiver(session, addr, retrans string) (*moldReceiver, error) {
+	uaddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	var conn *net.UDPConn
+	if uaddr.IP != nil && uaddr.IP.IsMulticast() {
+		conn, err = net.ListenMulticastUDP("udp", nil, uaddr)
+	} else {
+		conn, err = net.ListenUDP("udp", uaddr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn.SetReadBuffer(4 << 20)
+	r := &moldReceiver{session: session, conn: conn, retrans: retrans,
+		book: auction.NewItchBook(), done: make(chan struct{})}
+	return r, nil
+}
+
+func (r *moldReceiver) run() {
+	defer close(r.done)
+	buf := make([]byte, 65536)
+	for {
+		n, _, err := r.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		p, err := decodeMold(buf[:n])
+		if err != nil {
+			log.Warning("drop packet", err)
+			continue
+		}
+		if p.session != r.session {
+			log.Warning("drop packet", errMoldSession, p.session)
+			continue
+		}
+		r.mu.Lock()
+		err = r.onPacket(p)
+		ended := r.ended
+		r.mu.Unlock()
+		if err != nil {
+			log.Error("receiver", err)
+			return
+		}
+		if ended {
+			return
+		}
+	}
+}
+
+// onPacket apply packet, recover gap before it, hold mu
+func (r *moldReceiver) onPacket(p *moldPacket) error {
+	if p.seq > r.book.Seq()+1 {
+		if err := r.recover(p.seq - 1); err != nil {
+			return err
+		}
+	}
+	for i, msg := range p.msgs {
+		if err := r.apply(p.seq+uint64(i), msg); err != nil {
+			return err
+		}
+	}
+	if p.count == moldEndSession {
+		r.ended = true
+	}
+	return nil
+}
+
+func (r *moldReceiver) apply(seq uint64, msg []byte) error {
+	if seq <= r.book.Seq() {
+		return nil
+	}
+	if err := r.book.Apply(seq, msg); err != nil {
+		return err
+	}
+	if r.onMsg != nil {
+		if m, err := auction.DecodeItch(msg); err == nil {
+			r.onMsg(m)
+		}
+	}
+	return nil
+}
+
+// recover request messages up to seq from retransmission service
+func (r *moldReceiver) recover(upto uint64) error {
+	conn, err := net.DialTimeout("tcp", r.retrans, moldRetransWait)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	rd := bufio.NewReader(conn)
+	for r.book.Seq() < upto {
+		next := r.book.Seq() + 1
+		count := upto - r.book.Seq()
+		if count > moldMaxRetrans {
+			count = moldMaxRetrans
+		}
+		conn.SetDeadline(time.Now().Add(moldRetransWait))
+		if _, err := conn.Write(moldHeader(r.session, next, int(count))); err != nil {
+			return err
+		}
+		for got := uint64(0); got < count; {
+			var hdr [2]byte
+			if _, err := io.ReadFull(rd, hdr[:]); err != nil {
+				return err
+			}
+			b := make([]byte, binary.BigEndian.Uint16(hdr[:]))
+			if _, err := io.ReadFull(rd, b); err != nil {
+				return err
+			}
+			p, err := decodeMold(b)
+			if err != nil {
+				return err
+			}
+			if len(p.msgs) == 0 {
+				// publisher has nothing more
+				return errMoldPacket
+			}
+			for i, msg := range p.msgs {
+				if err := r.apply(p.seq+uint64(i), msg); err != nil {
+					return err
+				}
+			}
+			got += uint64(len(p.msgs))
+			r.recovered += len(p.msgs)
+		}
+	}
+	return nil
+}
+
+// seq return sequence number of last applied message
+func (r *moldReceiver) seq() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.book.Seq()
+}
+
+// verify compare rebuilt orderBook of sym with engine
+func (r *moldReceiver) verify(sym string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.book.Verify(sym)
+}
+
+func (r *moldReceiver) close() {
+	r.conn.Close()
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ouchClient is soup client, used by load generator and tests
+type ouchClient struct {
+	conn    net.Conn
+	rd      *bufio.Reader
+	session string
+	// next expected sequence number
+	seq int
+}
+
+func dialOuch(addr, user string, seq int) (*ouchClient, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &ouchClient{conn: conn, rd: bufio.NewReader(conn)}
+	if _, err := conn.Write(loginRequest(user, "", "", seq)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetReadDeadline(time.Now().Add(soupTimeout))
+	typ, payload, err := readSoup(c.rd)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if typ != soupLoginAccepted || len(payload) != soupSessionLen+soupSeqLen {
+		conn.Close()
+		return nil, fmt.Errorf("login rejected: %q", payload)
+	}
+	c.session = strings.TrimSpace(string(payload[:soupSessionLen]))
+	c.seq, _ = strconv.Atoi(strings.TrimSpace(string(payload[soupSessionLen:])))
+	return c, nil
+}
+
+func (c *ouchClient) send(m *ouchMsg) error {
+	_, err := c.conn.Write(soupPacket(soupUnsequenced, m.encodeInbound()))
+	return err
+}
+
+// recv return next sequenced message, heartbeats skipped
+func (c *ouchClient) recv(timeout time.Duration) (*ouchMsg, error) {
+	c.conn.SetReadDeadline(time.Now().Add(timeout))
+	for {
+		typ, payload, err := readSoup(c.rd)
+		if err != nil {
+			return nil, err
+		}
+		switch typ {
+		case soupSequenced:
+			c.seq++
+			return decodeOutbound(payload)
+		case soupEndOfSession:
+			return nil, fmt.Errorf("end of session")
+		}
+	}
+}
+
+func (c *ouchClient) heartbeat() error {
+	_, err := c.conn.Write(soupPacket(soupClientHeartbeat, nil))
+	return err
+}
+
+func (c *ouchClient) close() {
+	c.conn.Write(soupPacket(soupLogoutRequest, nil))
+	c.conn.Close()
+}
+
+type loadStats struct {
+	count int
+	total time.Duration
+	rtt   []time.Duration
+}
+
+func (st *loadStats) String() string {
+	if st.count == 0 {
+		return "no orders"
+	}
+	sort.Slice(st.rtt, func(i, j int) bool { return st.rtt[i] < st.rtt[j] })
+	pct := func(p int) time.Duration {
+		return st.rtt[(len(st.rtt)-1)*p/100]
+	}
+	return fmt.Sprintf("%d orders in %v, %.0f/s, RTT min %v avg %v p50 %v p99 %v max %v",
+		st.count, st.total, float64(st.count)/st.total.Seconds(), st.rtt[0],
+		st.total/time.Duration(st.count), pct(50), pct(99), st.rtt[len(st.rtt)-1])
+}
+
+// runLoad send n orders one by one, each wait for its first response,
+// orders alternate buy/sell at crossing prices around 40000
+func runLoad(addr, user, sym string, n int) (*loadStats, error) {
+	c, err := dialOuch(addr, user, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer c.close()
+	st := &loadStats{rtt: make([]time.Duration, 0, n)}
+	prefix := fmt.Sprintf("%X", time.Now().UnixNano()&0xffffff)
+	start := time.Now()
+	for i := 0; i < n; i++ {
+		token := prefix + strconv.Itoa(i)
+		m := ouchMsg{Type: ouchEnterOrder, Token: token, Side: 'B', Qty: 1,
+			Symbol: sym, Price: 40000 + i%10}
+		if i&1 != 0 {
+			m.Side = 'S'
+		}
+		t0 := time.Now()
+		if err := c.send(&m); err != nil {
+			return st, err
+		}
+		for {
+			r, err := c.recv(soupTimeout)
+			if err != nil {
+				return st, err
+			}
+			if r.Token == token {
+				break
+			}
+		}
+		st.rtt = append(st.rtt, time.Since(t0))
+		st.count++
+	}
+	st.total = time.Since(start)
+	return st, nil
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	auction "github.com/kjx98/go-auction"
+	"github.com/op/go-logging"
+)
+
+var (
+	listenAddr string
+	verbose    bool
+	preAuction bool
+	loadCount  int
+	loadSym    string
+	loadUser   string
+	cod        bool
+)
+
+var log = logging.MustGetLogger("auction-ouch")
+
+// ouchOrder is order of a soup user, qty is open shares of engine order
+// filled is executed volume of current engine order
+type ouchOrder struct {
+	user   *soupUser
+	token  string
+	oid    int
+	symbol string
+	side   byte
+	price  int
+	qty    int
+	filled int
+	// token of pending replace
+	newToken  string
+	replacing bool
+	replaced  bool
+}
+
+// ouchServer serialize engine access and all sessions with mu
+type ouchServer struct {
+	mu      sync.Mutex
+	session string
+	users   map[string]*soupUser
+	owners  map[int]*ouchOrder
+	// order sent to engine, bound to oid on ExecNew
+	pending *ouchOrder
+	ln      net.Listener
+	// cancel open orders of user when disconnected
+	cancelOnDisconnect bool
+	// reason of engine cancel reported, cancelUser unless canceled by system
+	cancelReason byte
+}
+
+func newOuchServer(session string) *ouchServer {
+	srv := &ouchServer{session: session, cancelReason: cancelUser}
+	srv.users = map[string]*soupUser{}
+	srv.owners = map[int]*ouchOrder{}
+	auction.ExecSubscribe(srv.onExec)
+	return srv
+}
+
+func (srv *ouchServer) listen(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	srv.ln = ln
+	log.Info("OUCH gateway listen on", ln.Addr())
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go srv.serve(conn)
+		}
+	}()
+	return nil
+}
+
+func (srv *ouchServer) close() {
+	if srv.ln != nil {
+		srv.ln.Close()
+	}
+	srv.mu.Lock()
+	for _, u := range srv.users {
+		if u.conn != nil {
+			u.conn.write(soupPacket(soupEndOfSession, nil))
+			u.conn.close()
+		}
+	}
+	srv.mu.Unlock()
+}
+
+// ouchTimestamp is nanoseconds since midnight
+func ouchTimestamp() int64 {
+	now := time.Now()
+	y, m, d := now.Date()
+	return now.Sub(time.Date(y, m, d, 0, 0, 0, 0, now.Location())).Nanoseconds()
+}
+
+func (srv *ouchServer) reject(u *soupUser, token string, reason byte) {
+	m := ouchMsg{Type: ouchRejected, Timestamp: ouchTimestamp(), Token: token,
+		Reason: reason}
+	u.send(m.encodeOutbound())
+}
+
+func (srv *ouchServer) onMessage(u *soupUser, m *ouchMsg) {
+	switch m.Type {
+	case ouchEnterOrder:
+		srv.onEnterOrder(u, m)
+	case ouchReplaceOrder:
+		srv.onReplace(u, m)
+	case ouchCancelOrder:
+		srv.onCancel(u, m)
+	}
+}
+
+func (srv *ouchServer) onEnterOrder(u *soupUser, m *ouchMsg) {
+	switch {
+	case m.Token == "" || u.tokens[m.Token] != nil:
+		srv.reject(u, m.Token, rejectDuplicate)
+		return
+	case m.Side != 'B' && m.Side != 'S':
+		srv.reject(u, m.Token, rejectSide)
+		return
+	case m.Symbol == "":
+		srv.reject(u, m.Token, rejectSymbol)
+		return
+	case m.Qty <= 0:
+		srv.reject(u, m.Token, rejectQuantity)
+		return
+	case m.Price <= 0:
+		srv.reject(u, m.Token, rejectPrice)
+		return
+	}
+	or := &ouchOrder{user: u, token: m.Token, symbol: m.Symbol, side: m.Side,
+		price: m.Price, qty: m.Qty}
+	// token used even order rejected
+	u.tokens[m.Token] = or
+	// soup user is account, token identify order as ClOrdID
+	ow := auction.Owner{Account: u.name, ClOrdID: m.Token}
+	srv.pending = or
+	oid, err := auction.SendOrderOwner(ow, m.Symbol, m.Side == 'B', m.Qty, m.Price)
+	srv.pending = nil
+	if err != nil || oid == 0 {
+		srv.reject(u, m.Token, rejectEngine)
+	}
+}
+
+// onCancel Qty is new intended open shares, zero for cancel
+func (srv *ouchServer) onCancel(u *soupUser, m *ouchMsg) {
+	or := u.tokens[m.Token]
+	if or == nil || or.oid == 0 {
+		srv.reject(u, m.Token, rejectUnknown)
+		return
+	}
+	var err error
+	if m.Qty == 0 {
+		err = auction.CancelOrderOwner(u.name, or.oid)
+	} else if m.Qty < or.qty-or.filled {
+		err = auction.ReduceOrderOwner(u.name, or.oid, or.filled+m.Qty)
+	}
+	if err != nil {
+		log.Infof("%s cancel %s: %v", u.name, m.Token, err)
+	}
+}
+
+func (srv *ouchServer) onReplace(u *soupUser, m *ouchMsg) {
+	or := u.tokens[m.PrevToken]
+	if or == nil || or.oid == 0 {
+		srv.reject(u, m.Token, rejectUnknown)
+		return
+	}
+	if m.Token == "" || u.tokens[m.Token] != nil {
+		srv.reject(u, m.Token, rejectDuplicate)
+		return
+	}
+	if m.Qty <= 0 || m.Price <= 0 {
+		srv.reject(u, m.Token, rejectQuantity)
+		return
+	}
+	or.newToken = m.Token
+	or.replacing = true
+	or.replaced = false
+	oid, err := auction.ReplaceOrderOwner(u.name, or.oid, m.Token, or.filled+m.Qty,
+		m.Price)
+	if err != nil || oid == 0 {
+		srv.reject(u, m.Token, rejectUnknown)
+	} else if !or.replaced {
+		// nothing changed in engine
+		srv.replaced(or, or.oid, or.filled+m.Qty, m.Price)
+	}
+	or.replacing = false
+}
+
+// replaced report replace done with new token
+func (srv *ouchServer) replaced(or *ouchOrder, oid, qty, price int) {
+	prev := or.token
+	or.replaced = true
+	if oid != or.oid {
+		delete(srv.owners, or.oid)
+		srv.owners[oid] = or
+		or.oid = oid
+		or.filled = 0
+	}
+	or.qty = qty
+	or.price = price
+	or.token = or.newToken
+	or.user.tokens[or.token] = or
+	m := ouchMsg{Type: ouchReplaced, Timestamp: ouchTimestamp(), Token: or.token,
+		Side: or.side, Qty: or.qty - or.filled, Symbol: or.symbol, Price: or.price,
+		OrderRef: int64(or.oid), PrevToken: prev}
+	or.user.send(m.encodeOutbound())
+}
+
+// onDisconnect cancel open orders of user if cancelOnDisconnect, user
+// logged in again by other connection untouched, hold mu
+func (srv *ouchServer) onDisconnect(c *soupConn) {
+	if !srv.cancelOnDisconnect || c.user == nil || c.user.conn != nil {
+		return
+	}
+	var oids []int
+	for oid, or := range srv.owners {
+		if or.user == c.user && or.qty > or.filled {
+			oids = append(oids, oid)
+		}
+	}
+	sort.Ints(oids)
+	srv.cancelReason = cancelSystem
+	for _, oid := range oids {
+		auction.CancelOrderOwner(c.user.name, oid)
+	}
+	srv.cancelReason = cancelUser
+	if len(oids) > 0 {
+		log.Infof("%s disconnected, %d orders canceled", c.user.name, len(oids))
+	}
+}
+
+// onExec route engine execution reports to owner, hold mu
+func (srv *ouchServer) onExec(er *auction.ExecReport) {
+	if er.ExecType == auction.ExecNew {
+		or := srv.pending
+		if or == nil {
+			return
+		}
+		srv.pending = nil
+		or.oid = er.Oid
+		srv.owners[er.Oid] = or
+		m := ouchMsg{Type: ouchAccepted, Timestamp: ouchTimestamp(), Token: or.token,
+			Side: or.side, Qty: or.qty, Symbol: or.symbol, Price: or.price,
+			OrderRef: int64(or.oid)}
+		or.user.send(m.encodeOutbound())
+		return
+	}
+	if er.ExecType == auction.ExecReplaced {
+		or, ok := srv.owners[er.OrigOid]
+		if !ok {
+			return
+		}
+		if or.replacing {
+			srv.replaced(or, er.Oid, er.Qty, er.Price)
+			return
+		}
+		// reduced by cancel with intended shares
+		dec := or.qty - er.Qty
+		or.qty = er.Qty
+		m := ouchMsg{Type: ouchCanceled, Timestamp: ouchTimestamp(), Token: or.token,
+			Qty: dec, Reason: cancelUser}
+		or.user.send(m.encodeOutbound())
+		return
+	}
+	or, ok := srv.owners[er.Oid]
+	if !ok {
+		return
+	}
+	var m ouchMsg
+	switch er.ExecType {
+	case auction.ExecFill:
+		or.filled += er.LastQty
+		m = ouchMsg{Type: ouchExecuted, Timestamp: ouchTimestamp(), Token: or.token,
+			Qty: er.LastQty, Price: er.LastPrice, MatchNo: int64(er.TradeNo)}
+	case auction.ExecCanceled:
+		m = ouchMsg{Type: ouchCanceled, Timestamp: ouchTimestamp(), Token: or.token,
+			Qty: er.Qty - er.Filled, Reason: srv.cancelReason}
+		or.qty = or.filled
+	default:
+		return
+	}
+	or.user.send(m.encodeOutbound())
+}
+
+func main() {
+	flag.StringVar(&listenAddr, "addr", ":9879", "listen address, or server address of load")
+	flag.BoolVar(&preAuction, "pre", false, "start in pre auction, no matching")
+	flag.BoolVar(&verbose, "v", false, "verbose log")
+	flag.BoolVar(&cod, "cod", false, "cancel open orders of user on disconnect")
+	flag.IntVar(&loadCount, "n", 100000, "orders sent by load")
+	flag.StringVar(&loadSym, "sym", "cu1908", "symbol of load orders")
+	flag.StringVar(&loadUser, "user", "LOAD", "soup user of load")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: auction-ouch [options] [load]\n")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+	flag.Parse()
+	if !verbose {
+		logging.SetLevel(logging.WARNING, "go-auction")
+	}
+	if flag.Arg(0) == "load" {
+		addr := listenAddr
+		if addr[0] == ':' {
+			addr = "127.0.0.1" + addr
+		}
+		st, err := runLoad(addr, loadUser, loadSym, loadCount)
+		if err != nil {
+			log.Error("load", err)
+			os.Exit(1)
+		}
+		fmt.Println(st)
+		return
+	}
+	if !preAuction {
+		auction.MarketStart(true)
+	}
+	srv := newOuchServer("AUCTION")
+	srv.cancelOnDisconnect = cod
+	if err := srv.listen(listenAddr); err != nil {
+		log.Error("listen", err)
+		os.Exit(1)
+	}
+	select {}
+}
+
+// `%{color}%{time:15:04:05.000} %{shortfunc} ▶ %{level:.4s} %{id:03x}%{color:reset} %{message}`
+func init() {
+	var format = logging.MustStringFormatter(
+		`%{color}%{time:01-02 15:04:05}  ▶ %{level:.4s} %{color:reset} %{message}`,
+	)
+
+	if runtime.GOARCH != "amd64" {
+		format = logging.MustStringFormatter(
+			`%{time:01-02 15:04:05} %{level:.4s} %{message}`,
+		)
+	}
+	logback := logging.NewLogBackend(os.Stderr, "", 0)
+	logfmt := logging.NewBackendFormatter(logback, format)
+	logging.SetBackend(logfmt)
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	auction "github.com/kjx98/go-auction"
+	"github.com/op/go-logging"
+)
+
+var testSrv *ouchServer
+
+func TestMain(m *testing.M) {
+	logging.SetLevel(logging.ERROR, "go-auction")
+	logging.SetLevel(logging.ERROR, "auction-ouch")
+	auction.MarketStart(true)
+	testSrv = newOuchServer("AUCTION")
+	if err := testSrv.listen("127.0.0.1:0"); err != nil {
+		panic(err)
+	}
+	res := m.Run()
+	testSrv.close()
+	os.Exit(res)
+}
+
+func dialTest(t *testing.T, user string, seq int) *ouchClient {
+	t.Helper()
+	var err error
+	// previous session of user may not be closed by server yet
+	for i := 0; i < 50; i++ {
+		var c *ouchClient
+		if c, err = dialOuch(testSrv.ln.Addr().String(), user, seq); err == nil {
+			return c
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal(user, "login", err)
+	return nil
+}
+
+func expectMsg(t *testing.T, c *ouchClient, want ouchMsg) *ouchMsg {
+	t.Helper()
+	m, err := c.recv(3 * time.Second)
+	if err != nil {
+		t.Fatal("recv", err)
+	}
+	got := *m
+	got.Timestamp = 0
+	if want.OrderRef == 0 {
+		got.OrderRef = 0
+	}
+	if want.MatchNo == 0 {
+		got.MatchNo = 0
+	}
+	if got != want {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	return m
+}
+
+func enterOrder(token, sym string, side byte, qty, price int) *ouchMsg {
+	return &ouchMsg{Type: ouchEnterOrder, Token: token, Side: side, Qty: qty,
+		Symbol: sym, Price: price}
+}
+
+func TestOuchCodec(t *testing.T) {
+	in := []ouchMsg{
+		*enterOrder("t1", "cu1908", 'B', 10, 43000),
+		{Type: ouchReplaceOrder, PrevToken: "t1", Token: "t2", Qty: 5, Price: 43100},
+		{Type: ouchCancelOrder, Token: "t2"},
+	}
+	for _, m := range in {
+		got, err := decodeInbound(m.encodeInbound())
+		if err != nil || *got != m {
+			t.Errorf("decodeInbound %+v %v, want %+v", got, err, m)
+		}
+	}
+	out := []ouchMsg{
+		{Type: ouchAccepted, Timestamp: 1, Token: "t1", Side: 'S', Qty: 3,
+			Symbol: "cu1908", Price: 43000, OrderRef: 7},
+		{Type: ouchReplaced, Timestamp: 2, Token: "t2", Side: 'S', Qty: 3,
+			Symbol: "cu1908", Price: 43000, OrderRef: 8, PrevToken: "t1"},
+		{Type: ouchCanceled, Timestamp: 3, Token: "t2", Qty: 3, Reason: cancelUser},
+		{Type: ouchExecuted, Timestamp: 4, Token: "t2", Qty: 1, Price: 43000, MatchNo: 9},
+		{Type: ouchRejected, Timestamp: 5, Token: "t3", Reason: rejectDuplicate},
+	}
+	for _, m := range out {
+		got, err := decodeOutbound(m.encodeOutbound())
+		if err != nil || *got != m {
+			t.Errorf("decodeOutbound %+v %v, want %+v", got, err, m)
+		}
+	}
+	if _, err := decodeInbound([]byte{ouchEnterOrder, 1}); err != errOuchLength {
+		t.Errorf("short message error %v", err)
+	}
+}
+
+func TestOuchOrderFlow(t *testing.T) {
+	sym := "cu1908"
+	a := dialTest(t, "USERA", 0)
+	defer a.close()
+	b := dialTest(t, "USERB", 0)
+	defer b.close()
+	a.send(enterOrder("a1", sym, 'B', 10, 43000))
+	expectMsg(t, a, ouchMsg{Type: ouchAccepted, Token: "a1", Side: 'B', Qty: 10,
+		Symbol: sym, Price: 43000})
+	b.send(enterOrder("b1", sym, 'S', 15, 42900))
+	expectMsg(t, b, ouchMsg{Type: ouchAccepted, Token: "b1", Side: 'S', Qty: 15,
+		Symbol: sym, Price: 42900})
+	e := expectMsg(t, b, ouchMsg{Type: ouchExecuted, Token: "b1", Qty: 10, Price: 42900})
+	ea := expectMsg(t, a, ouchMsg{Type: ouchExecuted, Token: "a1", Qty: 10, Price: 42900})
+	if e.MatchNo == 0 || e.MatchNo != ea.MatchNo {
+		t.Errorf("match number %d/%d", e.MatchNo, ea.MatchNo)
+	}
+	// reduce open shares of b1 from 5 to 2, then cancel
+	b.send(&ouchMsg{Type: ouchCancelOrder, Token: "b1", Qty: 2})
+	expectMsg(t, b, ouchMsg{Type: ouchCanceled, Token: "b1", Qty: 3, Reason: cancelUser})
+	b.send(&ouchMsg{Type: ouchCancelOrder, Token: "b1"})
+	expectMsg(t, b, ouchMsg{Type: ouchCanceled, Token: "b1", Qty: 2, Reason: cancelUser})
+	// duplicate token, bad price and unknown token rejected
+	a.send(enterOrder("a1", sym, 'B', 10, 43000))
+	expectMsg(t, a, ouchMsg{Type: ouchRejected, Token: "a1", Reason: rejectDuplicate})
+	a.send(enterOrder("a2", sym, 'B', 10, 0))
+	expectMsg(t, a, ouchMsg{Type: ouchRejected, Token: "a2", Reason: rejectPrice})
+	a.send(&ouchMsg{Type: ouchCancelOrder, Token: "xx"})
+	expectMsg(t, a, ouchMsg{Type: ouchRejected, Token: "xx", Reason: rejectUnknown})
+}
+
+func TestOuchReplace(t *testing.T) {
+	sym := "cu1909"
+	a := dialTest(t, "USERC", 0)
+	defer a.close()
+	b := dialTest(t, "USERD", 0)
+	defer b.close()
+	a.send(enterOrder("r1", sym, 'B', 10, 42000))
+	acc := expectMsg(t, a, ouchMsg{Type: ouchAccepted, Token: "r1", Side: 'B',
+		Qty: 10, Symbol: sym, Price: 42000})
+	b.send(enterOrder("s1", sym, 'S', 4, 42000))
+	expectMsg(t, b, ouchMsg{Type: ouchAccepted, Token: "s1", Side: 'S', Qty: 4,
+		Symbol: sym, Price: 42000})
+	expectMsg(t, a, ouchMsg{Type: ouchExecuted, Token: "r1", Qty: 4, Price: 42000})
+	// reduce in place keep order reference
+	a.send(&ouchMsg{Type: ouchReplaceOrder, PrevToken: "r1", Token: "r2", Qty: 4,
+		Price: 42000})
+	expectMsg(t, a, ouchMsg{Type: ouchReplaced, Token: "r2", Side: 'B', Qty: 4,
+		Symbol: sym, Price: 42000, OrderRef: acc.OrderRef, PrevToken: "r1"})
+	// price change get new order reference
+	a.send(&ouchMsg{Type: ouchReplaceOrder, PrevToken: "r2", Token: "r3", Qty: 5,
+		Price: 42100})
+	rep := expectMsg(t, a, ouchMsg{Type: ouchReplaced, Token: "r3", Side: 'B',
+		Qty: 5, Symbol: sym, Price: 42100, PrevToken: "r2"})
+	if rep.OrderRef == acc.OrderRef {
+		t.Error("order reference not changed by price replace")
+	}
+	// engine order owned by soup user with token as ClOrdID
+	testSrv.mu.Lock()
+	oid, ok := auction.LookupOrder("USERC", "r3")
+	ow, _ := auction.OrderOwner(int(rep.OrderRef))
+	testSrv.mu.Unlock()
+	if !ok || oid != int(rep.OrderRef) || ow.Account != "USERC" || ow.ClOrdID != "r3" {
+		t.Errorf("engine order %d owner %+v", oid, ow)
+	}
+	a.send(&ouchMsg{Type: ouchCancelOrder, Token: "r3"})
+	expectMsg(t, a, ouchMsg{Type: ouchCanceled, Token: "r3", Qty: 5, Reason: cancelUser})
+}
+
+func TestSoupReplay(t *testing.T) {
+	sym := "cu1910"
+	c := dialTest(t, "USERE", 0)
+	if c.seq != 1 || c.session != "AUCTION" {
+		t.Errorf("login seq %d session %s", c.seq, c.session)
+	}
+	c.send(enterOrder("e1", sym, 'B', 1, 41000))
+	want := ouchMsg{Type: ouchAccepted, Token: "e1", Side: 'B', Qty: 1, Symbol: sym,
+		Price: 41000}
+	expectMsg(t, c, want)
+	// second session of same user not available
+	if _, err := dialOuch(testSrv.ln.Addr().String(), "USERE", 0); err == nil {
+		t.Error("second login of USERE accepted")
+	}
+	c.close()
+	// replay from first message
+	c = dialTest(t, "USERE", 1)
+	if c.seq != 1 {
+		t.Errorf("replay login seq %d, want 1", c.seq)
+	}
+	expectMsg(t, c, want)
+	c.close()
+	c = dialTest(t, "USERE", 0)
+	defer c.close()
+	if c.seq != 2 {
+		t.Errorf("login seq %d, want 2", c.seq)
+	}
+}
+
+func TestOuchLoad(t *testing.T) {
+	st, err := runLoad(testSrv.ln.Addr().String(), "LOAD", "cu1911", 200)
+	if err != nil {
+		t.Fatal("runLoad", err)
+	}
+	if st.count != 200 || len(st.rtt) != 200 {
+		t.Errorf("load count %d", st.count)
+	}
+	t.Log(st)
+}
+
+func TestCancelOnDisconnect(t *testing.T) {
+	sym := "cu1912"
+	testSrv.mu.Lock()
+	testSrv.cancelOnDisconnect = true
+	testSrv.mu.Unlock()
+	defer func() {
+		testSrv.mu.Lock()
+		testSrv.cancelOnDisconnect = false
+		testSrv.mu.Unlock()
+	}()
+	c := dialTest(t, "USERG", 0)
+	c.send(enterOrder("g1", sym, 'B', 3, 41000))
+	expectMsg(t, c, ouchMsg{Type: ouchAccepted, Token: "g1", Side: 'B', Qty: 3,
+		Symbol: sym, Price: 41000})
+	c.close()
+	// cancel replayed after login again
+	c = dialTest(t, "USERG", 2)
+	defer c.close()
+	expectMsg(t, c, ouchMsg{Type: ouchCanceled, Token: "g1", Qty: 3,
+		Reason: cancelSystem})
+	if bids, _ := auction.OrderBookLen(sym); bids != 0 {
+		t.Errorf("bids %d after disconnect", bids)
+	}
+}
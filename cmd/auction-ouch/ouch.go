@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// OUCH style order entry messages, fixed length, integers big endian,
+// alpha fields left justified and space padded
+const (
+	ouchTokenLen  = 14
+	ouchSymbolLen = 8
+)
+
+// inbound message types
+const (
+	ouchEnterOrder   = 'O'
+	ouchReplaceOrder = 'U'
+	ouchCancelOrder  = 'X'
+)
+
+// outbound message types
+const (
+	ouchAccepted = 'A'
+	ouchReplaced = 'U'
+	ouchCanceled = 'C'
+	ouchExecuted = 'E'
+	ouchRejected = 'J'
+)
+
+// reject reasons
+const (
+	rejectSymbol    = 'S'
+	rejectQuantity  = 'Z'
+	rejectPrice     = 'X'
+	rejectSide      = 'B'
+	rejectDuplicate = 'D'
+	rejectUnknown   = 'U'
+	rejectEngine    = 'O'
+)
+
+// cancel reasons
+const (
+	cancelUser   = 'U'
+	cancelSystem = 'Z'
+)
+
+// message lengths include type byte
+const (
+	enterOrderLen   = 1 + ouchTokenLen + 1 + 4 + ouchSymbolLen + 4
+	replaceOrderLen = 1 + ouchTokenLen + ouchTokenLen + 4 + 4
+	cancelOrderLen  = 1 + ouchTokenLen + 4
+	acceptedLen     = 1 + 8 + ouchTokenLen + 1 + 4 + ouchSymbolLen + 4 + 8
+	replacedLen     = acceptedLen + ouchTokenLen
+	canceledLen     = 1 + 8 + ouchTokenLen + 4 + 1
+	executedLen     = 1 + 8 + ouchTokenLen + 4 + 4 + 8
+	rejectedLen     = 1 + 8 + ouchTokenLen + 1
+)
+
+var errOuchLength = errors.New("wrong OUCH message length")
+
+type ouchWriter struct {
+	b   []byte
+	off int
+}
+
+func newOuchWriter(typ byte, size int) *ouchWriter {
+	w := &ouchWriter{b: make([]byte, size)}
+	w.b[0] = typ
+	w.off = 1
+	return w
+}
+
+func (w *ouchWriter) alpha(s string, n int) {
+	copy(w.b[w.off:w.off+n], bytes.Repeat([]byte{' '}, n))
+	copy(w.b[w.off:w.off+n], s)
+	w.off += n
+}
+
+func (w *ouchWriter) byte(c byte) {
+	w.b[w.off] = c
+	w.off++
+}
+
+func (w *ouchWriter) u32(v int) {
+	binary.BigEndian.PutUint32(w.b[w.off:], uint32(v))
+	w.off += 4
+}
+
+func (w *ouchWriter) u64(v int64) {
+	binary.BigEndian.PutUint64(w.b[w.off:], uint64(v))
+	w.off += 8
+}
+
+type ouchReader struct {
+	b   []byte
+	off int
+}
+
+func (r *ouchReader) alpha(n int) string {
+	s := string(bytes.TrimRight(r.b[r.off:r.off+n], " "))
+	r.off += n
+	return s
+}
+
+func (r *ouchReader) byte() byte {
+	c := r.b[r.off]
+	r.off++
+	return c
+}
+
+func (r *ouchReader) u32() int {
+	v := binary.BigEndian.Uint32(r.b[r.off:])
+	r.off += 4
+	return int(v)
+}
+
+func (r *ouchReader) u64() int64 {
+	v := binary.BigEndian.Uint64(r.b[r.off:])
+	r.off += 8
+	return int64(v)
+}
+
+// ouchMsg is decoded OUCH message, fields used depend on Type
+type ouchMsg struct {
+	Type      byte
+	Timestamp int64
+	Token     string
+	PrevToken string
+	Side      byte
+	Qty       int
+	Symbol    string
+	Price     int
+	OrderRef  int64
+	MatchNo   int64
+	Reason    byte
+}
+
+func (m *ouchMsg) encodeInbound() []byte {
+	var w *ouchWriter
+	switch m.Type {
+	case ouchEnterOrder:
+		w = newOuchWriter(m.Type, enterOrderLen)
+		w.alpha(m.Token, ouchTokenLen)
+		w.byte(m.Side)
+		w.u32(m.Qty)
+		w.alpha(m.Symbol, ouchSymbolLen)
+		w.u32(m.Price)
+	case ouchReplaceOrder:
+		w = newOuchWriter(m.Type, replaceOrderLen)
+		w.alpha(m.PrevToken, ouchTokenLen)
+		w.alpha(m.Token, ouchTokenLen)
+		w.u32(m.Qty)
+		w.u32(m.Price)
+	case ouchCancelOrder:
+		w = newOuchWriter(m.Type, cancelOrderLen)
+		w.alpha(m.Token, ouchTokenLen)
+		w.u32(m.Qty)
+	default:
+		return nil
+	}
+	return w.b
+}
+
+func decodeInbound(b []byte) (*ouchMsg, error) {
+	if len(b) == 0 {
+		return nil, errOuchLength
+	}
+	m := &ouchMsg{Type: b[0]}
+	r := &ouchReader{b: b, off: 1}
+	switch m.Type {
+	case ouchEnterOrder:
+		if len(b) != enterOrderLen {
+			return nil, errOuchLength
+		}
+		m.Token = r.alpha(ouchTokenLen)
+		m.Side = r.byte()
+		m.Qty = r.u32()
+		m.Symbol = r.alpha(ouchSymbolLen)
+		m.Price = r.u32()
+	case ouchReplaceOrder:
+		if len(b) != replaceOrderLen {
+			return nil, errOuchLength
+		}
+		m.PrevToken = r.alpha(ouchTokenLen)
+		m.Token = r.alpha(ouchTokenLen)
+		m.Qty = r.u32()
+		m.Price = r.u32()
+	case ouchCancelOrder:
+		if len(b) != cancelOrderLen {
+			return nil, errOuchLength
+		}
+		m.Token = r.alpha(ouchTokenLen)
+		m.Qty = r.u32()
+	default:
+		return nil, errOuchLength
+	}
+	return m, nil
+}
+
+func (m *ouchMsg) encodeOutbound() []byte {
+	var w *ouchWriter
+	switch m.Type {
+	case ouchAccepted, ouchReplaced:
+		size := acceptedLen
+		if m.Type == ouchReplaced {
+			size = replacedLen
+		}
+		w = newOuchWriter(m.Type, size)
+		w.u64(m.Timestamp)
+		w.alpha(m.Token, ouchTokenLen)
+		w.byte(m.Side)
+		w.u32(m.Qty)
+		w.alpha(m.Symbol, ouchSymbolLen)
+		w.u32(m.Price)
+		w.u64(m.OrderRef)
+		if m.Type == ouchReplaced {
+			w.alpha(m.PrevToken, ouchTokenLen)
+		}
+	case ouchCanceled:
+		w = newOuchWriter(m.Type, canceledLen)
+		w.u64(m.Timestamp)
+		w.alpha(m.Token, ouchTokenLen)
+		w.u32(m.Qty)
+		w.byte(m.Reason)
+	case ouchExecuted:
+		w = newOuchWriter(m.Type, executedLen)
+		w.u64(m.Timestamp)
+		w.alpha(m.Token, ouchTokenLen)
+		w.u32(m.Qty)
+		w.u32(m.Price)
+		w.u64(m.MatchNo)
+	case ouchRejected:
+		w = newOuchWriter(m.Type, rejectedLen)
+		w.u64(m.Timestamp)
+		w.alpha(m.Token, ouchTokenLen)
+		w.byte(m.Reason)
+	default:
+		return nil
+	}
+	return w.b
+}
+
+func decodeOutbound(b []byte) (*ouchMsg, error) {
+	if len(b) == 0 {
+		return nil, errOuchLength
+	}
+	m := &ouchMsg{Type: b[0]}
+	r := &ouchReader{b: b, off: 1}
+	want := map[byte]int{ouchAccepted: acceptedLen, ouchReplaced: replacedLen,
+		ouchCanceled: canceledLen, ouchExecuted: executedLen,
+		ouchRejected: rejectedLen}
+	if n, ok := want[m.Type]; !ok || n != len(b) {
+		return nil, errOuchLength
+	}
+	m.Timestamp = r.u64()
+	m.Token = r.alpha(ouchTokenLen)
+	switch m.Type {
+	case ouchAccepted, ouchReplaced:
+		m.Side = r.byte()
+		m.Qty = r.u32()
+		m.Symbol = r.alpha(ouchSymbolLen)
+		m.Price = r.u32()
+		m.OrderRef = r.u64()
+		if m.Type == ouchReplaced {
+			m.PrevToken = r.alpha(ouchTokenLen)
+		}
+	case ouchCanceled:
+		m.Qty = r.u32()
+		m.Reason = r.byte()
+	case ouchExecuted:
+		m.Qty = r.u32()
+		m.Price = r.u32()
+		m.MatchNo = r.u64()
+	case ouchRejected:
+		m.Reason = r.byte()
+	}
+	return m, nil
+}
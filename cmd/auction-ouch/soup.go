@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SoupBinTCP like session layer, packet is length uint16 big endian
+// of type and payload, type byte, payload
+const (
+	soupLoginRequest    = 'L'
+	soupUnsequenced     = 'U'
+	soupClientHeartbeat = 'R'
+	soupLogoutRequest   = 'O'
+	soupLoginAccepted   = 'A'
+	soupLoginRejected   = 'J'
+	soupSequenced       = 'S'
+	soupServerHeartbeat = 'H'
+	soupEndOfSession    = 'Z'
+)
+
+// login rejected reasons
+const (
+	soupNotAuthorized       = 'A'
+	soupSessionNotAvailable = 'S'
+)
+
+const (
+	soupUserLen    = 6
+	soupPassLen    = 10
+	soupSessionLen = 10
+	soupSeqLen     = 20
+	soupLoginLen   = soupUserLen + soupPassLen + soupSessionLen + soupSeqLen
+	soupHbInterval = time.Second
+	soupTimeout    = 15 * time.Second
+	soupOutQueue   = 65536
+)
+
+var errSoupLength = errors.New("wrong soup packet length")
+
+func soupPacket(typ byte, payload []byte) []byte {
+	b := make([]byte, 3+len(payload))
+	binary.BigEndian.PutUint16(b, uint16(1+len(payload)))
+	b[2] = typ
+	copy(b[3:], payload)
+	return b
+}
+
+func readSoup(rd *bufio.Reader) (typ byte, payload []byte, err error) {
+	var hdr [2]byte
+	if _, err = io.ReadFull(rd, hdr[:]); err != nil {
+		return
+	}
+	n := int(binary.BigEndian.Uint16(hdr[:]))
+	if n == 0 {
+		return 0, nil, errSoupLength
+	}
+	b := make([]byte, n)
+	if _, err = io.ReadFull(rd, b); err != nil {
+		return
+	}
+	return b[0], b[1:], nil
+}
+
+func padLeft(s string, n int) string {
+	return fmt.Sprintf("%*s", n, s)
+}
+
+func padRight(s string, n int) string {
+	return fmt.Sprintf("%-*s", n, s)
+}
+
+func loginRequest(user, pass, session string, seq int) []byte {
+	s := padRight(user, soupUserLen) + padRight(pass, soupPassLen) +
+		padLeft(session, soupSessionLen) + padLeft(strconv.Itoa(seq), soupSeqLen)
+	return soupPacket(soupLoginRequest, []byte(s))
+}
+
+func loginAccepted(session string, seq int) []byte {
+	s := padLeft(session, soupSessionLen) + padLeft(strconv.Itoa(seq), soupSeqLen)
+	return soupPacket(soupLoginAccepted, []byte(s))
+}
+
+// soupUser keep sequenced messages for replay after reconnect
+type soupUser struct {
+	name   string
+	msgs   [][]byte
+	tokens map[string]*ouchOrder
+	conn   *soupConn
+}
+
+// send sequenced message, must hold srv.mu
+func (u *soupUser) send(payload []byte) {
+	u.msgs = append(u.msgs, payload)
+	if u.conn != nil {
+		u.conn.write(soupPacket(soupSequenced, payload))
+	}
+}
+
+type soupConn struct {
+	srv      *ouchServer
+	user     *soupUser
+	conn     net.Conn
+	out      chan []byte
+	lastSent time.Time
+	closed   bool
+}
+
+// write never block engine, slow peer dropped, must hold srv.mu
+func (c *soupConn) write(b []byte) {
+	if c.closed {
+		return
+	}
+	select {
+	case c.out <- b:
+		c.lastSent = time.Now()
+	default:
+		log.Warningf("%s output queue full, disconnect", c.user.name)
+		c.close()
+		c.conn.Close()
+	}
+}
+
+func (c *soupConn) close() {
+	if c.closed {
+		return
+	}
+	c.closed = true
+	close(c.out)
+	if c.user != nil && c.user.conn == c {
+		c.user.conn = nil
+	}
+}
+
+func (c *soupConn) writer() {
+	defer c.conn.Close()
+	wr := bufio.NewWriter(c.conn)
+	for b := range c.out {
+		if _, err := wr.Write(b); err != nil {
+			return
+		}
+		// flush when no more queued
+		if len(c.out) == 0 {
+			if err := wr.Flush(); err != nil {
+				return
+			}
+		}
+	}
+	wr.Flush()
+}
+
+func (c *soupConn) heartbeat() {
+	tk := time.NewTicker(soupHbInterval / 4)
+	defer tk.Stop()
+	for range tk.C {
+		c.srv.mu.Lock()
+		if c.closed {
+			c.srv.mu.Unlock()
+			return
+		}
+		if time.Since(c.lastSent) >= soupHbInterval {
+			c.write(soupPacket(soupServerHeartbeat, nil))
+		}
+		c.srv.mu.Unlock()
+	}
+}
+
+// serve run soup session on accepted connection
+func (srv *ouchServer) serve(conn net.Conn) {
+	rd := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(soupTimeout))
+	typ, payload, err := readSoup(rd)
+	if err != nil || typ != soupLoginRequest || len(payload) != soupLoginLen {
+		log.Warning("first packet must be LoginRequest", conn.RemoteAddr(), err)
+		conn.Close()
+		return
+	}
+	c := &soupConn{srv: srv, conn: conn, out: make(chan []byte, soupOutQueue)}
+	go c.writer()
+	srv.mu.Lock()
+	ok := c.onLogin(string(payload))
+	srv.mu.Unlock()
+	if !ok {
+		return
+	}
+	go c.heartbeat()
+	for {
+		conn.SetReadDeadline(time.Now().Add(soupTimeout))
+		typ, payload, err := readSoup(rd)
+		srv.mu.Lock()
+		if err != nil || c.closed {
+			if !c.closed {
+				log.Info(c.user.name, "disconnected:", err)
+				c.close()
+			}
+			srv.onDisconnect(c)
+			srv.mu.Unlock()
+			return
+		}
+		switch typ {
+		case soupUnsequenced:
+			if m, err := decodeInbound(payload); err != nil {
+				log.Warning(c.user.name, "bad message", err)
+				c.close()
+			} else {
+				srv.onMessage(c.user, m)
+			}
+		case soupClientHeartbeat:
+		case soupLogoutRequest:
+			log.Info(c.user.name, "logout")
+			c.close()
+		default:
+			log.Warningf("%s unknown packet type %c", c.user.name, typ)
+			c.close()
+		}
+		srv.mu.Unlock()
+	}
+}
+
+// onLogin accept session, replay sequenced messages from requested seq
+func (c *soupConn) onLogin(req string) bool {
+	srv := c.srv
+	name := strings.TrimSpace(req[:soupUserLen])
+	session := strings.TrimSpace(req[soupUserLen+soupPassLen : soupUserLen+soupPassLen+soupSessionLen])
+	seq, _ := strconv.Atoi(strings.TrimSpace(req[soupLoginLen-soupSeqLen:]))
+	reject := func(reason byte) bool {
+		c.write(soupPacket(soupLoginRejected, []byte{reason}))
+		c.close()
+		return false
+	}
+	if name == "" {
+		return reject(soupNotAuthorized)
+	}
+	if session != "" && session != srv.session {
+		return reject(soupSessionNotAvailable)
+	}
+	u, ok := srv.users[name]
+	if !ok {
+		u = &soupUser{name: name, tokens: map[string]*ouchOrder{}}
+		srv.users[name] = u
+	}
+	if u.conn != nil {
+		return reject(soupSessionNotAvailable)
+	}
+	c.user = u
+	u.conn = c
+	next := len(u.msgs) + 1
+	if seq <= 0 || seq > next {
+		seq = next
+	}
+	c.write(loginAccepted(srv.session, seq))
+	for _, b := range u.msgs[seq-1:] {
+		c.write(soupPacket(soupSequenced, b))
+	}
+	log.Infof("%s logged in, seq %d", name, seq)
+	return true
+}
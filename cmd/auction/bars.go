@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"time"
+
+	auction "github.com/kjx98/go-auction"
+)
+
+// orders of bars session without -count, default of -count build too
+// large book for a demo
+const barsOrders = 20000
+
+// runBars simulate a session, call auction then continuous trading with
+// simulated clock, emit bars as csv to stdout
+func runBars() {
+	n := barsOrders
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "count" {
+			n = count
+		}
+	})
+	count = n
+	start := time.Now().Truncate(24 * time.Hour).Add(9 * time.Hour)
+	now := start
+	auction.SetClock(func() time.Time { return now })
+	defer auction.SetClock(nil)
+
+	w := csv.NewWriter(os.Stdout)
+	defer w.Flush()
+	w.Write([]string{"symbol", "time", "open", "high", "low", "close",
+		"volume", "turnover", "vwap", "count"})
+	emit := func(bar *auction.Bar) {
+		w.Write([]string{bar.Symbol, bar.Start.Format("2006-01-02 15:04:05"),
+			strconv.Itoa(bar.Open), strconv.Itoa(bar.High),
+			strconv.Itoa(bar.Low), strconv.Itoa(bar.Close),
+			strconv.Itoa(bar.Volume), strconv.Itoa(bar.Turnover),
+			strconv.FormatFloat(bar.Vwap, 'f', 2, 64),
+			strconv.Itoa(bar.Count)})
+	}
+	var bb *auction.BarBuilder
+	if barVolume > 0 {
+		bb = auction.NewVolumeBars(instr, barVolume, emit)
+	} else {
+		bb = auction.NewTimeBars(instr, barPeriod, emit)
+	}
+
+	buildOrderBook(false)
+	last, volume, _ := auction.Uncross(instr, pclose)
+	log.Infof("Uncross price: %d, volume: %d", last, volume)
+	auction.MarketStart(false)
+	for i := 0; i < count; i++ {
+		now = now.Add(orderTick)
+		price := rand.Intn(20000) + pclose - 10000
+		vol := rand.Intn(100) + 1
+		auction.SendOrder(instr, (price&1) != 0, vol, price)
+	}
+	auction.MarketStop()
+	bb.Flush()
+	fmt.Fprintf(os.Stderr, "session %s to %s, trades: %d\n",
+		start.Format("15:04:05"), now.Format("15:04:05"), auction.DealCount()/2)
+}
@@ -22,6 +22,9 @@ var (
 	algo        int
 	verbose     bool
 	testTrading bool
+	barPeriod   time.Duration
+	barVolume   int
+	orderTick   time.Duration
 )
 
 var log = logging.MustGetLogger("auction")
@@ -90,19 +93,26 @@ func main() {
 	flag.StringVar(&orderFile, "order", "", "csv format orders")
 	flag.StringVar(&longFile, "long", "", "csv format long orders")
 	flag.StringVar(&shortFile, "short", "", "csv format short orders")
-	flag.IntVar(&count, "count", 2000000, "orders count")
+	flag.IntVar(&count, "count", 2000000, "orders count, 20000 for bars if not set")
 	flag.IntVar(&algo, "algo", 1, "Call Auction Algorithm")
 	flag.BoolVar(&verbose, "v", false, "verbose log")
 	flag.BoolVar(&testTrading, "t", false, "test continuous trading")
+	flag.DurationVar(&barPeriod, "period", time.Minute, "bars period")
+	flag.IntVar(&barVolume, "barvol", 0, "volume bars, volume of each bar")
+	flag.DurationVar(&orderTick, "tick", time.Millisecond, "simulated time between orders")
 	if !verbose {
 		logging.SetLevel(logging.WARNING, "go-auction")
 	}
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "usage: auction [options]\n")
+		fmt.Fprintf(os.Stderr, "usage: auction [options] [bars]\n")
 		flag.PrintDefaults()
 		os.Exit(2)
 	}
 	flag.Parse()
+	if flag.Arg(0) == "bars" {
+		runBars()
+		return
+	}
 	if orderFile != "" {
 		if fd, err := os.Open(orderFile); err != nil {
 			rcnt := 0
@@ -0,0 +1,210 @@
+package auction
+
+import (
+	"sort"
+)
+
+// darkBook is non displayed orderBook of a symbol, orders in time
+// priority, matched only at midpoint of lit BBO, never in depth feeds.
+// Dark orders can be canceled but not replaced
+type darkBook struct {
+	bids, asks []*simOrderType
+	// lit BBO of last check
+	bid, ask int
+}
+
+var darkBooks = map[string]*darkBook{}
+
+func getDarkBook(sym string) *darkBook {
+	db, ok := darkBooks[sym]
+	if !ok {
+		db = &darkBook{}
+		darkBooks[sym] = db
+	}
+	return db
+}
+
+// darkInsert add dark order and check matching
+func darkInsert(or *simOrderType) {
+	db := getDarkBook(or.Symbol)
+	if or.bBuy {
+		db.bids = append(db.bids, or)
+	} else {
+		db.asks = append(db.asks, or)
+	}
+	darkMatch(or.Symbol, true)
+}
+
+// darkRemove return removed dark order, nil if not found
+func darkRemove(or *simOrderType) *simOrderType {
+	db, ok := darkBooks[or.Symbol]
+	if !ok {
+		return nil
+	}
+	side := &db.asks
+	if or.bBuy {
+		side = &db.bids
+	}
+	for i, v := range *side {
+		if v.oid == or.oid {
+			*side = append((*side)[:i], (*side)[i+1:]...)
+			return v
+		}
+	}
+	return nil
+}
+
+// darkOrders return open dark orders of sym, bids first
+func darkOrders(sym string) []*simOrderType {
+	db, ok := darkBooks[sym]
+	if !ok {
+		return nil
+	}
+	res := append([]*simOrderType{}, db.bids...)
+	return append(res, db.asks...)
+}
+
+func sortedDarkSymbols() []string {
+	var syms []string
+	for sym := range darkBooks {
+		syms = append(syms, sym)
+	}
+	sort.Strings(syms)
+	return syms
+}
+
+// DarkBookLen return number of open dark orders of sym
+func DarkBookLen(sym string) (bids, asks int) {
+	if db, ok := darkBooks[sym]; ok {
+		return len(db.bids), len(db.asks)
+	}
+	return 0, 0
+}
+
+// litBest return best lit price of side with open volume, resting market
+// orders of price zero skipped, zero if none
+func litBest(orB *orderBook, isBuy bool) (price int) {
+	levels := orB.askLevels
+	if isBuy {
+		levels = orB.bidLevels
+	}
+	orB.walk(isBuy, func(v *simOrderType) bool {
+		if v.price != 0 && levels[v.price] > 0 {
+			price = v.price
+			return false
+		}
+		return true
+	})
+	return price
+}
+
+// darkMidpoint return midpoint of lit BBO rounded down to tick, zero if any
+// side empty or not trading
+func darkMidpoint(sym string) (mid, bid, ask int) {
+	orB, ok := simOrderBook[sym]
+	if !ok || SymbolState(sym) != StateTrading {
+		return
+	}
+	bid, ask = litBest(orB, true), litBest(orB, false)
+	if bid == 0 || ask == 0 || bid >= ask {
+		return 0, bid, ask
+	}
+	tick := TickSize(sym)
+	mid = (bid + ask) / 2
+	return mid - mid%tick, bid, ask
+}
+
+// darkExecQty return quantity executable between dark orders, zero if
+// below minimum execution quantity of either
+func darkExecQty(b, s *simOrderType) int {
+	bLeaves, sLeaves := b.Qty-b.Filled, s.Qty-s.Filled
+	qty := bLeaves
+	if sLeaves < qty {
+		qty = sLeaves
+	}
+	// minimum capped by open volume, last part of order can execute
+	for _, or := range []*simOrderType{b, s} {
+		minQty := or.MinQty
+		if leaves := or.Qty - or.Filled; minQty > leaves {
+			minQty = leaves
+		}
+		if qty < minQty {
+			return 0
+		}
+	}
+	return qty
+}
+
+// darkMatch match dark orders of sym at lit midpoint, only if lit BBO
+// changed since last check unless newOrder
+func darkMatch(sym string, newOrder bool) {
+	db, ok := darkBooks[sym]
+	if !ok || len(db.bids) == 0 || len(db.asks) == 0 {
+		return
+	}
+	mid, bid, ask := darkMidpoint(sym)
+	if !newOrder && bid == db.bid && ask == db.ask {
+		return
+	}
+	db.bid, db.ask = bid, ask
+	if mid == 0 {
+		// check again once trading with valid BBO
+		db.bid, db.ask = 0, 0
+		return
+	}
+	// fills lower open volume under MinQty of other orders, repeat
+	for filled := true; filled; {
+		filled = false
+		for _, b := range db.bids {
+			if b.price != 0 && b.price < mid {
+				continue
+			}
+			for _, s := range db.asks {
+				if b.Filled >= b.Qty {
+					break
+				}
+				if s.Filled >= s.Qty || (s.price != 0 && s.price > mid) ||
+					selfTrade(b, s) {
+					continue
+				}
+				if qty := darkExecQty(b, s); qty > 0 {
+					darkFill(b, s, mid, qty)
+					filled = true
+				}
+			}
+		}
+	}
+	db.bids = darkOpen(db.bids)
+	db.asks = darkOpen(db.asks)
+}
+
+func darkOpen(side []*simOrderType) []*simOrderType {
+	res := side[:0]
+	for _, or := range side {
+		if or.Filled < or.Qty {
+			res = append(res, or)
+		}
+	}
+	return res
+}
+
+// darkFill execute dark trade, later order of pair is taker
+func darkFill(b, s *simOrderType, price, qty int) {
+	tNo := nextTradeNo()
+	bLiq, sLiq := LiqMaker, LiqTaker
+	if b.seq > s.seq {
+		bLiq, sLiq = LiqTaker, LiqMaker
+	}
+	for _, f := range []struct {
+		or  *simOrderType
+		liq int
+	}{{b, bLiq}, {s, sLiq}} {
+		f.or.Filled += qty
+		f.or.PriceFilled = price
+		pushDeal(f.or.oid, price, qty)
+		execFill(f.or, price, qty, tNo, f.liq)
+	}
+	md := MdUpdate{Symbol: b.Symbol, Action: MdTrade, IsBuy: bLiq == LiqTaker,
+		Price: price, Volume: qty, TradeNo: tNo, Dark: true}
+	mdPublish(&md)
+}
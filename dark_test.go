@@ -0,0 +1,104 @@
+package auction
+
+import (
+	"testing"
+)
+
+func TestDarkBook(t *testing.T) {
+	instr := "cu1912"
+	defer MdUnsubscribeAll()
+	defer ExecUnsubscribeAll()
+	cleanupOrderBook(instr)
+	MarketStart(false)
+	var depth int
+	var trades []MdUpdate
+	MdSubscribe(func(md *MdUpdate) {
+		if md.Symbol != instr {
+			return
+		}
+		if md.Action == MdTrade {
+			trades = append(trades, *md)
+		} else {
+			depth++
+		}
+	})
+	fills := map[int]int{}
+	ExecSubscribe(func(er *ExecReport) {
+		if er.ExecType == ExecFill {
+			if !er.Dark || er.LastPrice != 50050 {
+				t.Errorf("dark fill %+v", er)
+			}
+			fills[er.Oid] += er.LastQty
+		}
+	})
+	dark := func(ow *Owner, bBuy bool, qty, limit, minQty int) int {
+		t.Helper()
+		oid, err := SendOrderOpts(ow, instr, bBuy, qty, limit,
+			OrderOpts{Dark: true, MinQty: minQty})
+		if err != nil || oid == 0 {
+			t.Fatal("SendOrderOpts dark", err)
+		}
+		return oid
+	}
+	if _, err := SendOrderOpts(nil, instr, true, 1, 0,
+		OrderOpts{Dark: true, Peg: PegMidpoint}); err != errDarkOpts {
+		t.Error("pegged dark order", err)
+	}
+	// no lit BBO, no match
+	d1 := dark(&Owner{Account: "DARK1", ClOrdID: "d1"}, true, 10, 0, 5)
+	d2 := dark(nil, false, 3, 0, 0)
+	SendOrder(instr, true, 1, 50000)
+	SendOrder(instr, false, 1, 50100)
+	depth = 0
+	// d2 below d1 minimum until d1 partially filled by d3
+	d3 := dark(nil, false, 8, 50040, 0)
+	if fills[d1] != 10 || fills[d2] != 2 || fills[d3] != 8 {
+		t.Errorf("dark fills %v", fills)
+	}
+	if bids, asks := DarkBookLen(instr); bids != 0 || asks != 1 {
+		t.Errorf("dark book %d/%d", bids, asks)
+	}
+	if depth != 0 || len(trades) != 2 || !trades[0].Dark || trades[0].Volume != 8 {
+		t.Errorf("depth updates %d, trades %+v", depth, trades)
+	}
+	if pos, _ := GetPosition("DARK1", instr); pos.Net != 10 {
+		t.Errorf("DARK1 position %d", pos.Net)
+	}
+
+	// sell limit above midpoint match once lit BBO move
+	CancelOrder(d2)
+	SendOrder(instr, false, 1, 50080)
+	d4 := dark(nil, true, 5, 50050, 0)
+	d5 := dark(nil, false, 2, 50050, 0)
+	if fills[d4] != 0 || fills[d5] != 0 {
+		t.Error("dark sell matched below limit")
+	}
+	trades = nil
+	SendOrder(instr, true, 1, 50020)
+	// midpoint of 50020/50080
+	if fills[d4] != 2 || fills[d5] != 2 || len(trades) != 1 {
+		t.Errorf("fills after BBO change %v, trades %d", fills, len(trades))
+	}
+	if n, _ := MassCancel(CancelFilter{Symbol: instr, Side: SideBuy}); n != 3 {
+		t.Errorf("mass cancel %d orders", n)
+	}
+	if bids, _ := DarkBookLen(instr); bids != 0 {
+		t.Error("dark bid not canceled")
+	}
+
+	// resting market bid not BBO, midpoint rounded down to tick
+	sym := "cu1919"
+	cleanupOrderBook(sym)
+	SetTickSize(sym, 20)
+	defer SetTickSize(sym, 0)
+	simState = StatePreAuction
+	SendOrder(sym, true, 1, 0)
+	SendOrder(sym, true, 1, 50000)
+	SendOrder(sym, false, 1, 50110)
+	simState = StateTrading
+	if mid, bid, ask := darkMidpoint(sym); mid != 50040 || bid != 50000 || ask != 50110 {
+		t.Errorf("darkMidpoint %d of %d/%d", mid, bid, ask)
+	}
+	cleanupOrderBook(sym)
+	MarketStop()
+}
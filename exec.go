@@ -0,0 +1,113 @@
+package auction
+
+// execution report types
+const (
+	ExecNew = iota + 1
+	ExecFill
+	ExecCanceled
+	ExecReplaced
+	ExecExpired
+)
+
+// liquidity of fill
+const (
+	LiqMaker = iota + 1
+	LiqTaker
+	LiqAuction
+)
+
+// ExecReport is order state change for order owner
+// OrigOid is replaced order for ExecReplaced, Oid same as OrigOid if
+// quantity reduced in place
+type ExecReport struct {
+	ExecType  int
+	Oid       int
+	OrigOid   int
+	Symbol    string
+	IsBuy     bool
+	Price     int
+	Qty       int
+	Filled    int
+	LastPrice int
+	LastQty   int
+	TradeNo   int
+	// Liquidity and Fee charged of ExecFill, negative Fee is rebate
+	Liquidity int
+	Fee       int
+	// front and back leg prices of spread order fill
+	LegPrices [2]int
+	// ExecFill of block trade side, no order so Oid zero
+	Block bool
+	// participant and ClOrdID of order
+	Owner
+	OrderOpts
+}
+
+// Leaves return open volume of order
+func (er *ExecReport) Leaves() int {
+	if er.ExecType == ExecCanceled || er.ExecType == ExecExpired {
+		return 0
+	}
+	return er.Qty - er.Filled
+}
+
+type ExecHandler func(er *ExecReport)
+
+var execHandlers []ExecHandler
+
+// ExecSubscribe register handler for execution reports of all orders
+func ExecSubscribe(fn ExecHandler) {
+	execHandlers = append(execHandlers, fn)
+}
+
+func ExecUnsubscribeAll() {
+	execHandlers = nil
+}
+
+func newExecReport(typ int, or *simOrderType) ExecReport {
+	return ExecReport{ExecType: typ, Oid: or.oid, Symbol: or.Symbol,
+		IsBuy: or.bBuy, Price: or.price, Qty: or.Qty, Filled: or.Filled,
+		Owner: or.Owner, OrderOpts: or.OrderOpts}
+}
+
+// execPublish and execFill also update account state of owned orders
+func execPublish(typ int, or *simOrderType, origOid int) {
+	if len(execHandlers) == 0 && or.Account == "" {
+		return
+	}
+	er := newExecReport(typ, or)
+	er.OrigOid = origOid
+	accountOnExec(&er)
+	quoteOnExec(&er)
+	for _, fn := range execHandlers {
+		fn(&er)
+	}
+}
+
+func execFill(or *simOrderType, price, vol, tradeNo, liq int) {
+	execFillLegs(or, price, vol, tradeNo, liq, [2]int{})
+}
+
+// execFillLegs is execFill of spread order with leg prices, fee charged
+// on both legs
+func execFillLegs(or *simOrderType, price, vol, tradeNo, liq int, legs [2]int) {
+	if (len(execHandlers) == 0 && or.Account == "") || vol <= 0 {
+		return
+	}
+	mmpOnFill(or.oid, or.bBuy, vol)
+	er := newExecReport(ExecFill, or)
+	er.LastPrice, er.LastQty, er.TradeNo = price, vol, tradeNo
+	er.Liquidity = liq
+	if sp, ok := spreads[or.Symbol]; ok {
+		er.LegPrices = legs
+		er.Fee = tradeFee(or.Account, sp.Front, liq, legs[0], vol) +
+			tradeFee(or.Account, sp.Back, liq, legs[1], vol)
+	} else {
+		er.Fee = tradeFee(or.Account, or.Symbol, liq, price, vol)
+	}
+	accountOnExec(&er)
+	quoteOnExec(&er)
+	for _, fn := range execHandlers {
+		fn(&er)
+	}
+}
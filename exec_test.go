@@ -0,0 +1,80 @@
+package auction
+
+import (
+	"testing"
+)
+
+func TestExecReport(t *testing.T) {
+	instr := "cu1912"
+	defer ExecUnsubscribeAll()
+	cleanupOrderBook(instr)
+	MarketStart(false)
+	var ers []ExecReport
+	ExecSubscribe(func(er *ExecReport) {
+		ers = append(ers, *er)
+	})
+	bid := SendOrder(instr, true, 10, 42000)
+	ask := SendOrder(instr, false, 4, 42000)
+	want := []ExecReport{
+		{ExecType: ExecNew, Oid: bid, Symbol: instr, IsBuy: true, Price: 42000, Qty: 10},
+		{ExecType: ExecNew, Oid: ask, Symbol: instr, Price: 42000, Qty: 4},
+		{ExecType: ExecFill, Oid: bid, Symbol: instr, IsBuy: true, Price: 42000,
+			Qty: 10, Filled: 4, LastPrice: 42000, LastQty: 4, TradeNo: tradeNo,
+			Liquidity: LiqMaker},
+		{ExecType: ExecFill, Oid: ask, Symbol: instr, Price: 42000, Qty: 4,
+			Filled: 4, LastPrice: 42000, LastQty: 4, TradeNo: tradeNo,
+			Liquidity: LiqTaker},
+	}
+	if len(ers) != len(want) {
+		t.Fatalf("exec reports %v, want %v", ers, want)
+	}
+	for i := range want {
+		if ers[i] != want[i] {
+			t.Errorf("exec report %d %+v, want %+v", i, ers[i], want[i])
+		}
+	}
+	if ers[3].Leaves() != 0 || ers[2].Leaves() != 6 {
+		t.Errorf("leaves %d/%d, want 6/0", ers[2].Leaves(), ers[3].Leaves())
+	}
+	// reduce in place, same oid
+	ers = nil
+	if oid, err := ReplaceOrder(bid, 8, 42000); err != nil || oid != bid {
+		t.Errorf("ReplaceOrder %d %v, want %d", oid, err, bid)
+	}
+	if len(ers) != 1 || ers[0].ExecType != ExecReplaced || ers[0].Qty != 8 ||
+		ers[0].OrigOid != bid {
+		t.Errorf("reduce exec reports %+v", ers)
+	}
+	// price change, left volume in new order
+	ers = nil
+	oid, err := ReplaceOrder(bid, 9, 42100)
+	if err != nil || oid == bid {
+		t.Errorf("ReplaceOrder %d %v", oid, err)
+	}
+	if len(ers) != 1 || ers[0].Oid != oid || ers[0].OrigOid != bid ||
+		ers[0].Qty != 5 || ers[0].Price != 42100 {
+		t.Errorf("replace exec reports %+v", ers)
+	}
+	if _, err := ReplaceOrder(oid, 0, 42100); err == nil {
+		t.Error("ReplaceOrder below filled should fail")
+	}
+	// no room for replacement, original order kept
+	ers = nil
+	saved := orderNo
+	orderNo = maxOrders
+	if v, err := ReplaceOrder(oid, 9, 42200); err != errOrderFull || v != 0 {
+		t.Errorf("ReplaceOrder at capacity %d %v", v, err)
+	}
+	orderNo = saved
+	if len(ers) != 0 || openVol(instr, oid) != 5 {
+		t.Errorf("order %d after failed replace %+v", oid, ers)
+	}
+	ers = nil
+	if err := CancelOrder(oid); err != nil {
+		t.Error("CancelOrder", err)
+	}
+	if len(ers) != 1 || ers[0].ExecType != ExecCanceled || ers[0].Leaves() != 0 {
+		t.Errorf("cancel exec reports %+v", ers)
+	}
+	MarketStop()
+}
@@ -0,0 +1,209 @@
+package auction
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// time in force of order, zero value GTC live until canceled
+const (
+	TifGTC = iota
+	TifDay
+	TifGTD
+)
+
+var (
+	errExpireTime = errors.New("GTD order require expire time after now")
+	errDarkOpts   = errors.New("dark order can't be pegged or post-only")
+)
+
+// OrderOpts is optional attributes of order
+type OrderOpts struct {
+	Tif int
+	// ExpireTime of GTD order, rounded up to second
+	ExpireTime time.Time
+	// PostOnly reject or reprice, zero for normal order
+	PostOnly int
+	// Peg type and offset of pegged order, PegLimit is price of order
+	// sent, zero for no cap
+	Peg       int
+	PegOffset int
+	PegLimit  int
+	// Dark order rest in midpoint dark book, price is optional limit,
+	// MinQty minimum quantity of each execution
+	Dark   bool
+	MinQty int
+}
+
+// slots of GTD timer wheel, one second per slot
+const wheelSlots = 256
+
+// expiryWheel hash GTD orders by expire second, slot swept when clock
+// pass its second, orders expire later keep in slot for next round
+type expiryWheel struct {
+	slots [wheelSlots][]int
+	// last second swept
+	tick int64
+	n    int
+}
+
+var gtdWheel expiryWheel
+
+func expireSec(t time.Time) int64 {
+	sec := t.Unix()
+	if t.Nanosecond() != 0 {
+		sec++
+	}
+	return sec
+}
+
+func (w *expiryWheel) reset() {
+	*w = expiryWheel{}
+}
+
+func (w *expiryWheel) add(or *simOrderType) {
+	if w.n == 0 {
+		w.tick = simClock().Unix()
+	}
+	sec := expireSec(or.ExpireTime)
+	if sec <= w.tick {
+		sec = w.tick + 1
+	}
+	w.slots[sec%wheelSlots] = append(w.slots[sec%wheelSlots], or.oid)
+	w.n++
+}
+
+// advance sweep slots up to now, return number of orders expired
+func (w *expiryWheel) advance(now time.Time) int {
+	end := now.Unix()
+	if w.n == 0 || end <= w.tick {
+		if w.n == 0 {
+			w.tick = end
+		}
+		return 0
+	}
+	last := end
+	if last-w.tick > wheelSlots {
+		last = w.tick + wheelSlots
+	}
+	cnt := 0
+	for s := w.tick + 1; s <= last; s++ {
+		slot := w.slots[s%wheelSlots]
+		keep := slot[:0]
+		for _, oid := range slot {
+			or := simOrders[oid-1]
+			if or.Tif == TifGTD && expireSec(or.ExpireTime) > end {
+				keep = append(keep, oid)
+				continue
+			}
+			w.n--
+			// order filled, canceled or replaced not in orderBook
+			if or.Tif == TifGTD && expireOrder(or) {
+				cnt++
+			}
+		}
+		w.slots[s%wheelSlots] = keep
+	}
+	w.tick = end
+	return cnt
+}
+
+func expireOrder(or *simOrderType) bool {
+	v := simRemoveOrder(or)
+	if v == nil {
+		return false
+	}
+	execPublish(ExecExpired, v, 0)
+	bookChanged(or.Symbol)
+	return true
+}
+
+// ExpireOrders expire GTD orders with expire time passed by engine clock,
+// called periodically by host, also before new orders while any GTD order
+// waiting
+func ExpireOrders() int {
+	return gtdWheel.advance(simClock())
+}
+
+// ExpireDayOrders expire all DAY orders at session end, called by
+// MarketStop
+func ExpireDayOrders() int {
+	var syms []string
+	for sym := range simOrderBook {
+		syms = append(syms, sym)
+	}
+	sort.Strings(syms)
+	var oids []int
+	for _, sym := range syms {
+		orB := simOrderBook[sym]
+		for _, isBuy := range []bool{true, false} {
+			orB.walk(isBuy, func(v *simOrderType) bool {
+				if v.Tif == TifDay {
+					oids = append(oids, v.oid)
+				}
+				return true
+			})
+		}
+	}
+	for _, sym := range sortedDarkSymbols() {
+		for _, v := range darkOrders(sym) {
+			if v.Tif == TifDay {
+				oids = append(oids, v.oid)
+			}
+		}
+	}
+	cnt := 0
+	for _, oid := range oids {
+		if expireOrder(simOrders[oid-1]) {
+			cnt++
+		}
+	}
+	return cnt
+}
+
+// SendOrderOpts send order with opts, ow nil for anonymous order, return
+// oid zero with nil error if rejected by trading state, prc is limit
+// cap of pegged order
+func SendOrderOpts(ow *Owner, sym string, bBuy bool, qty, prc int, opts OrderOpts) (int, error) {
+	if opts.Tif == TifGTD && !opts.ExpireTime.After(simClock()) {
+		return 0, errExpireTime
+	}
+	if opts.Dark && (opts.Peg != 0 || opts.PostOnly != 0) {
+		return 0, errDarkOpts
+	}
+	if _, ok := spreads[sym]; ok && (opts.Dark || opts.Peg != 0 || opts.PostOnly != 0) {
+		return 0, errSpreadOpts
+	}
+	if opts.Peg != 0 {
+		opts.PegLimit = prc
+		var ok bool
+		if prc, ok = pegPrice(sym, bBuy, &opts); !ok {
+			return 0, errPegPrice
+		}
+	}
+	var key clOrdKey
+	var rOwner Owner
+	if ow != nil {
+		if ow.Account == "" || ow.ClOrdID == "" {
+			return 0, errClOrdID
+		}
+		key = clOrdKey{ow.Account, ow.ClOrdID}
+		if _, ok := clOrdIDs[key]; ok {
+			return 0, errDupClOrdID
+		}
+		rOwner = *ow
+	}
+	if err := symbolAccept(sym); err == errHalted {
+		return 0, err
+	}
+	ro := RiskOrder{Owner: rOwner, Symbol: sym, IsBuy: bBuy, Qty: qty, Price: prc}
+	if err := checkRisk(&ro); err != nil {
+		return 0, err
+	}
+	oid := sendOrder(sym, bBuy, qty, prc, 0, ow, &opts)
+	if oid != 0 && ow != nil {
+		clOrdIDs[key] = oid
+	}
+	return oid, nil
+}
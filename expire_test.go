@@ -0,0 +1,121 @@
+package auction
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExpireOrders(t *testing.T) {
+	instr := "cu1912"
+	now := time.Date(2019, 8, 1, 9, 0, 0, 0, time.UTC)
+	SetClock(func() time.Time { return now })
+	defer SetClock(nil)
+	defer ExecUnsubscribeAll()
+	cleanupOrderBook(instr)
+	MarketStart(false)
+	var expired []int
+	ExecSubscribe(func(er *ExecReport) {
+		if er.ExecType == ExecExpired {
+			if er.Leaves() != 0 {
+				t.Error("expired order leaves", er.Qty-er.Filled)
+			}
+			expired = append(expired, er.Oid)
+		}
+	})
+	gtd := func(d time.Duration) OrderOpts {
+		return OrderOpts{Tif: TifGTD, ExpireTime: now.Add(d)}
+	}
+	if _, err := SendOrderOpts(nil, instr, true, 1, 40000, gtd(0)); err != errExpireTime {
+		t.Error("GTD expire time not after now", err)
+	}
+	b1, _ := SendOrderOpts(nil, instr, true, 2, 40000, gtd(1500*time.Millisecond))
+	b2, _ := SendOrderOpts(nil, instr, true, 2, 40100, gtd(5*time.Second))
+	// beyond one round of wheel
+	b3, _ := SendOrderOpts(nil, instr, true, 1, 39000, gtd(300*time.Second))
+	// GTD order fully filled never expire
+	a1, _ := SendOrderOpts(&Owner{Account: "EXP1", ClOrdID: "e1"}, instr, false,
+		1, 40100, gtd(time.Second))
+	if openVol(instr, b2) != 1 || openVol(instr, a1) != 0 {
+		t.Errorf("GTD order not matched %d/%d", openVol(instr, b2), openVol(instr, a1))
+	}
+
+	now = now.Add(time.Second)
+	if n := ExpireOrders(); n != 0 {
+		t.Errorf("%d orders expired before expire time", n)
+	}
+	// expire time 1.5s rounded up to 2s
+	now = now.Add(time.Second)
+	if n := ExpireOrders(); n != 1 || len(expired) != 1 || expired[0] != b1 {
+		t.Errorf("expire %d, expired %v", n, expired)
+	}
+	// replaced order keep expire time
+	b4, err := ReplaceOrder(b2, 2, 40200)
+	if err != nil || b4 == b2 {
+		t.Fatal("ReplaceOrder", err)
+	}
+	// expired before matching new order
+	now = now.Add(3 * time.Second)
+	SendOrder(instr, false, 1, 40200)
+	if len(expired) != 2 || expired[1] != b4 {
+		t.Errorf("replaced order not expired %v", expired)
+	}
+	if bids, asks := OrderBookLen(instr); bids != 1 || asks != 1 {
+		t.Errorf("orderBook %d/%d", bids, asks)
+	}
+	now = now.Add(200 * time.Second)
+	if n := ExpireOrders(); n != 0 || openVol(instr, b3) != 1 {
+		t.Errorf("order expired in previous round of wheel, %d", n)
+	}
+	now = now.Add(100 * time.Second)
+	if n := ExpireOrders(); n != 1 || openVol(instr, b3) != 0 {
+		t.Errorf("order not expired after rounds of wheel, %d", n)
+	}
+	// wheel idle while orders entered without GTD orders, new GTD order
+	// expire at own time by order entry
+	now = now.Add(1000 * time.Second)
+	b5 := SendOrder(instr, true, 1, 39000)
+	if _, err := ReplaceOrder(b5, 2, 39100); err != nil {
+		t.Error("ReplaceOrder", err)
+	}
+	b6, _ := SendOrderOpts(nil, instr, true, 1, 39200, gtd(2*time.Second))
+	now = now.Add(time.Second)
+	SendOrder(instr, true, 1, 38000)
+	if openVol(instr, b6) != 1 {
+		t.Error("GTD order expired before expire time after idle wheel")
+	}
+	now = now.Add(time.Second)
+	SendOrder(instr, true, 1, 38000)
+	if openVol(instr, b6) != 0 || expired[len(expired)-1] != b6 {
+		t.Errorf("GTD order not expired after idle wheel %v", expired)
+	}
+	MarketStop()
+}
+
+func TestExpireDayOrders(t *testing.T) {
+	instr := "cu1912"
+	defer ExecUnsubscribeAll()
+	cleanupOrderBook(instr)
+	cleanupOrderBook("cu1911")
+	MarketStart(false)
+	var expired []int
+	ExecSubscribe(func(er *ExecReport) {
+		if er.ExecType == ExecExpired {
+			expired = append(expired, er.Oid)
+		}
+	})
+	day := OrderOpts{Tif: TifDay}
+	d1, _ := SendOrderOpts(nil, instr, true, 2, 40000, day)
+	d2, _ := SendOrderOpts(&Owner{Account: "EXP2", ClOrdID: "d1"}, "cu1911",
+		false, 3, 41000, day)
+	g1 := SendOrder(instr, true, 1, 39900)
+	MarketStop()
+	if len(expired) != 2 || expired[0] != d2 || expired[1] != d1 {
+		t.Errorf("expired %v, want [%d %d]", expired, d2, d1)
+	}
+	if openVol(instr, g1) != 1 {
+		t.Error("GTC order expired at session end")
+	}
+	if n := len(getAccount("EXP2").orders); n != 0 {
+		t.Errorf("EXP2 open orders %d after expire", n)
+	}
+}
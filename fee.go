@@ -0,0 +1,91 @@
+package auction
+
+import (
+	"sort"
+)
+
+// FeeRate is fee of one fill, PerLot per qty plus Bps basis points of
+// notional, negative for rebate
+type FeeRate struct {
+	PerLot int
+	Bps    int
+}
+
+// FeeTier apply to accounts traded MinVolume or more in the session
+type FeeTier struct {
+	MinVolume int
+	Maker     FeeRate
+	Taker     FeeRate
+	Auction   FeeRate
+}
+
+// FeeSchedule is fee tiers of a symbol
+type FeeSchedule struct {
+	Tiers []FeeTier
+}
+
+// fee schedules by symbol, empty symbol for symbols without schedule
+var feeSchedules = map[string]*FeeSchedule{}
+
+// SetFeeSchedule set fee schedule of sym, empty sym for default schedule
+// of all symbols, nil remove schedule
+func SetFeeSchedule(sym string, fs *FeeSchedule) {
+	if fs == nil {
+		delete(feeSchedules, sym)
+		return
+	}
+	res := FeeSchedule{Tiers: append([]FeeTier{}, fs.Tiers...)}
+	sort.Slice(res.Tiers, func(i, j int) bool {
+		return res.Tiers[i].MinVolume < res.Tiers[j].MinVolume
+	})
+	feeSchedules[sym] = &res
+}
+
+func (fr FeeRate) fee(price, qty int) int {
+	return fr.PerLot*qty + price*qty*fr.Bps/10000
+}
+
+// tier return fee tier of volume, nil if no tier apply
+func (fs *FeeSchedule) tier(volume int) *FeeTier {
+	var res *FeeTier
+	for i := range fs.Tiers {
+		if fs.Tiers[i].MinVolume > volume {
+			break
+		}
+		res = &fs.Tiers[i]
+	}
+	return res
+}
+
+// tradeFee return fee of fill, tier by volume of account before fill
+func tradeFee(account, sym string, liq, price, qty int) int {
+	fs, ok := feeSchedules[sym]
+	if !ok {
+		if fs, ok = feeSchedules[""]; !ok {
+			return 0
+		}
+	}
+	var volume int
+	if acc, ok := accounts[account]; ok && account != "" {
+		volume = acc.volume
+	}
+	tier := fs.tier(volume)
+	if tier == nil {
+		return 0
+	}
+	switch liq {
+	case LiqMaker:
+		return tier.Maker.fee(price, qty)
+	case LiqTaker:
+		return tier.Taker.fee(price, qty)
+	}
+	return tier.Auction.fee(price, qty)
+}
+
+// AccountFees return fees charged and volume traded of account
+func AccountFees(account string) (fees, volume int) {
+	if acc, ok := accounts[account]; ok {
+		return acc.fees, acc.volume
+	}
+	return 0, 0
+}
@@ -0,0 +1,78 @@
+package auction
+
+import (
+	"testing"
+)
+
+func TestTradeFee(t *testing.T) {
+	instr := "cu1912"
+	defer ExecUnsubscribeAll()
+	defer SetFeeSchedule(instr, nil)
+	defer SetFeeSchedule("", nil)
+	cleanupOrderBook(instr)
+	cleanupOrderBook("cu1911")
+	MarketStart(false)
+	SetFeeSchedule(instr, &FeeSchedule{Tiers: []FeeTier{
+		{MinVolume: 10, Maker: FeeRate{Bps: -2}, Taker: FeeRate{PerLot: 1}},
+		{Maker: FeeRate{Bps: -1}, Taker: FeeRate{PerLot: 2, Bps: 2},
+			Auction: FeeRate{PerLot: 1}},
+	}})
+	SetFeeSchedule("", &FeeSchedule{Tiers: []FeeTier{{Taker: FeeRate{PerLot: 5}}}})
+	fees := map[string][]int{}
+	ExecSubscribe(func(er *ExecReport) {
+		if er.ExecType == ExecFill {
+			fees[er.Account] = append(fees[er.Account], er.Liquidity, er.Fee)
+		}
+	})
+	ow := func(acc, id string) Owner {
+		return Owner{Account: acc, ClOrdID: id}
+	}
+	sendOwner(t, ow("FEE1", "f1"), instr, true, 10, 50000)
+	sendOwner(t, ow("FEE2", "f2"), instr, false, 4, 50000)
+	sendOwner(t, ow("FEE2", "f3"), instr, false, 6, 50000)
+	// volume 10 reach second tier
+	sendOwner(t, ow("FEE2", "f4"), instr, false, 5, 50100)
+	sendOwner(t, ow("FEE1", "f5"), instr, true, 5, 50100)
+	want := map[string][]int{
+		"FEE1": {LiqMaker, -20, LiqMaker, -30, LiqTaker, 5},
+		"FEE2": {LiqTaker, 48, LiqTaker, 72, LiqMaker, -50},
+	}
+	for acc, w := range want {
+		if len(fees[acc]) != len(w) {
+			t.Errorf("%s fees %v, want %v", acc, fees[acc], w)
+			continue
+		}
+		for i := range w {
+			if fees[acc][i] != w[i] {
+				t.Errorf("%s fees %v, want %v", acc, fees[acc], w)
+				break
+			}
+		}
+	}
+	if fee, vol := AccountFees("FEE1"); fee != -45 || vol != 15 {
+		t.Errorf("FEE1 fees %d volume %d", fee, vol)
+	}
+	if fee, vol := AccountFees("FEE2"); fee != 70 || vol != 15 {
+		t.Errorf("FEE2 fees %d volume %d", fee, vol)
+	}
+
+	// default schedule of symbols without schedule
+	SendOrder("cu1911", true, 3, 42000)
+	sendOwner(t, ow("FEE4", "f6"), "cu1911", false, 3, 42000)
+	if fee, _ := AccountFees("FEE4"); fee != 15 {
+		t.Errorf("default schedule fee %d, want 15", fee)
+	}
+
+	// auction fee on uncross
+	simState = StatePreAuction
+	sendOwner(t, ow("FEE3", "f7"), instr, true, 2, 50000)
+	SendOrder(instr, false, 3, 49900)
+	if _, vol, _ := Uncross(instr, 50000); vol != 2 {
+		t.Errorf("Uncross volume %d", vol)
+	}
+	if fee, _ := AccountFees("FEE3"); fee != 2 || len(fees["FEE3"]) != 2 ||
+		fees["FEE3"][0] != LiqAuction {
+		t.Errorf("auction fee %d, exec fees %v", fee, fees["FEE3"])
+	}
+	MarketStop()
+}
@@ -0,0 +1,247 @@
+package auction
+
+import (
+	"errors"
+	"sort"
+)
+
+// incremental market data actions
+const (
+	MdNewLevel = iota + 1
+	MdChangeLevel
+	MdDeleteLevel
+	MdTrade
+)
+
+var (
+	errMdGap    = errors.New("market data sequence gap")
+	errMdSymbol = errors.New("market data symbol mismatch")
+)
+
+// MdUpdate is one incremental book change or trade, sequenced per symbol
+// Volume is total open volume of the level after change, or trade volume
+// for MdTrade, IsBuy is aggressor side for MdTrade
+type MdUpdate struct {
+	Seq    uint64
+	Symbol string
+	Action int
+	IsBuy  bool
+	Price  int
+	Volume int
+	// trade number for MdTrade
+	TradeNo int
+	// MdTrade of call auction uncross
+	Auction bool
+	// MdTrade of midpoint dark book
+	Dark bool
+	// MdTrade of implied spread match, on spread and both legs
+	Implied bool
+	// MdTrade of negotiated block trade, off orderBook
+	Block bool
+}
+
+// lastPrice check MdTrade set last price and bars, negotiated block
+// trade only count in session volume
+func (md *MdUpdate) lastPrice() bool {
+	return md.Action == MdTrade && !md.Block
+}
+
+type PriceLevel struct {
+	Price  int
+	Volume int
+}
+
+type MdHandler func(md *MdUpdate)
+
+type mdSub struct {
+	id int
+	fn MdHandler
+}
+
+var (
+	mdHandlers []mdSub
+	mdSubNo    int
+)
+
+// last sequence number published per symbol, survive orderBook cleanup
+var mdSeqs = map[string]uint64{}
+
+// MdSubscribe register handler for incremental updates of all symbols,
+// return id for MdUnsubscribe
+func MdSubscribe(fn MdHandler) int {
+	mdSubNo++
+	mdHandlers = append(mdHandlers, mdSub{id: mdSubNo, fn: fn})
+	return mdSubNo
+}
+
+// MdUnsubscribe drop handler id, safe inside handler
+func MdUnsubscribe(id int) {
+	res := make([]mdSub, 0, len(mdHandlers))
+	for _, sub := range mdHandlers {
+		if sub.id != id {
+			res = append(res, sub)
+		}
+	}
+	mdHandlers = res
+}
+
+// MdUnsubscribeAll drop all registered handlers
+func MdUnsubscribeAll() {
+	mdHandlers = nil
+}
+
+func mdPublish(md *MdUpdate) {
+	seq := mdSeqs[md.Symbol] + 1
+	mdSeqs[md.Symbol] = seq
+	md.Seq = seq
+	for _, sub := range mdHandlers {
+		sub.fn(md)
+	}
+	tickerOnMd(md)
+}
+
+func mdTrade(sym string, isBuy bool, price, vol, tradeNo int) {
+	if vol <= 0 {
+		return
+	}
+	md := MdUpdate{Symbol: sym, Action: MdTrade, IsBuy: isBuy, Price: price,
+		Volume: vol, TradeNo: tradeNo}
+	mdPublish(&md)
+}
+
+func mdAuctionTrade(sym string, price, vol, tradeNo int) {
+	md := MdUpdate{Symbol: sym, Action: MdTrade, Price: price, Volume: vol,
+		TradeNo: tradeNo, Auction: true}
+	mdPublish(&md)
+}
+
+// sortLevels return price levels best first
+func sortLevels(levels map[int]int, isBuy bool) []PriceLevel {
+	var res []PriceLevel
+	for price, vol := range levels {
+		res = append(res, PriceLevel{Price: price, Volume: vol})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if isBuy {
+			// market order with zero price is best bid
+			if res[i].Price == 0 || res[j].Price == 0 {
+				return res[i].Price == 0
+			}
+			return res[i].Price > res[j].Price
+		}
+		return res[i].Price < res[j].Price
+	})
+	return res
+}
+
+// MdSnapshot return price levels of sym and last sequence number published
+// incrementals with Seq great than seq apply to the snapshot
+func MdSnapshot(sym string) (seq uint64, bids, asks []PriceLevel) {
+	seq = mdSeqs[sym]
+	if orB, ok := simOrderBook[sym]; ok {
+		bids = sortLevels(orB.bidLevels, true)
+		asks = sortLevels(orB.askLevels, false)
+	}
+	return
+}
+
+// MdBook is price level book built from incremental updates
+//
+// recovery: on gap, Apply return errMdGap and buffer following updates,
+// after Reset with snapshot, buffered updates newer than snapshot replayed
+type MdBook struct {
+	Symbol    string
+	seq       uint64
+	stale     bool
+	pending   []MdUpdate
+	bids      map[int]int
+	asks      map[int]int
+	LastPrice int
+	Volume    int
+}
+
+func NewMdBook(sym string) *MdBook {
+	return &MdBook{Symbol: sym, bids: map[int]int{}, asks: map[int]int{}}
+}
+
+func (b *MdBook) Seq() uint64 {
+	return b.seq
+}
+
+// Stale return true if gap detected and snapshot is required
+func (b *MdBook) Stale() bool {
+	return b.stale
+}
+
+func (b *MdBook) Apply(md *MdUpdate) error {
+	if md.Symbol != b.Symbol {
+		return errMdSymbol
+	}
+	if b.stale {
+		b.pending = append(b.pending, *md)
+		return nil
+	}
+	if md.Seq <= b.seq {
+		// duplicate
+		return nil
+	}
+	if md.Seq != b.seq+1 {
+		log.Warningf("%s md gap, expect %d got %d", b.Symbol, b.seq+1, md.Seq)
+		b.stale = true
+		b.pending = append(b.pending[:0], *md)
+		return errMdGap
+	}
+	b.apply(md)
+	return nil
+}
+
+func (b *MdBook) apply(md *MdUpdate) {
+	b.seq = md.Seq
+	levels := b.asks
+	if md.IsBuy {
+		levels = b.bids
+	}
+	switch md.Action {
+	case MdNewLevel, MdChangeLevel:
+		levels[md.Price] = md.Volume
+	case MdDeleteLevel:
+		delete(levels, md.Price)
+	case MdTrade:
+		if md.lastPrice() {
+			b.LastPrice = md.Price
+		}
+		b.Volume += md.Volume
+	}
+}
+
+// Reset load snapshot then replay buffered updates
+func (b *MdBook) Reset(seq uint64, bids, asks []PriceLevel) error {
+	b.seq = seq
+	b.stale = false
+	b.bids = map[int]int{}
+	b.asks = map[int]int{}
+	for _, lv := range bids {
+		b.bids[lv.Price] = lv.Volume
+	}
+	for _, lv := range asks {
+		b.asks[lv.Price] = lv.Volume
+	}
+	pending := b.pending
+	b.pending = nil
+	for i := range pending {
+		if err := b.Apply(&pending[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Recover reset MdBook with current engine snapshot
+func (b *MdBook) Recover() error {
+	seq, bids, asks := MdSnapshot(b.Symbol)
+	return b.Reset(seq, bids, asks)
+}
+
+func (b *MdBook) Levels() (bids, asks []PriceLevel) {
+	return sortLevels(b.bids, true), sortLevels(b.asks, false)
+}
@@ -0,0 +1,121 @@
+package auction
+
+import (
+	"reflect"
+	"testing"
+)
+
+func checkMdBook(t *testing.T, b *MdBook) {
+	t.Helper()
+	seq, bids, asks := MdSnapshot(b.Symbol)
+	gBids, gAsks := b.Levels()
+	if b.Seq() != seq {
+		t.Errorf("%s MdBook seq %d, want %d", b.Symbol, b.Seq(), seq)
+	}
+	if !reflect.DeepEqual(gBids, bids) {
+		t.Errorf("%s MdBook bids %v, want %v", b.Symbol, gBids, bids)
+	}
+	if !reflect.DeepEqual(gAsks, asks) {
+		t.Errorf("%s MdBook asks %v, want %v", b.Symbol, gAsks, asks)
+	}
+}
+
+func TestMdIncremental(t *testing.T) {
+	instr := "cu1912"
+	defer MdUnsubscribeAll()
+	cleanupOrderBook(instr)
+	MarketStart(false)
+	book := NewMdBook(instr)
+	book.Recover()
+	var actions []int
+	MdSubscribe(func(md *MdUpdate) {
+		if md.Symbol != instr {
+			return
+		}
+		actions = append(actions, md.Action)
+		if err := book.Apply(md); err != nil {
+			t.Error("Apply", err)
+		}
+	})
+	oid := SendOrder(instr, true, 10, 42000)
+	SendOrder(instr, true, 20, 42000)
+	SendOrder(instr, false, 5, 43000)
+	want := []int{MdNewLevel, MdChangeLevel, MdNewLevel}
+	if !reflect.DeepEqual(actions, want) {
+		t.Errorf("actions %v, want %v", actions, want)
+	}
+	actions = nil
+	// cross bid level, fill 30 and rest 5
+	SendOrder(instr, false, 35, 42000)
+	want = []int{MdTrade, MdChangeLevel, MdTrade, MdDeleteLevel, MdNewLevel}
+	if !reflect.DeepEqual(actions, want) {
+		t.Errorf("actions %v, want %v", actions, want)
+	}
+	if book.LastPrice != 42000 || book.Volume != 30 {
+		t.Errorf("last/volume %d/%d, want 42000/30", book.LastPrice, book.Volume)
+	}
+	if err := CancelOrder(oid); err == nil {
+		t.Error("cancel filled order should fail")
+	}
+	actions = nil
+	oid = SendOrder(instr, true, 8, 41000)
+	if err := CancelOrder(oid); err != nil {
+		t.Error("CancelOrder", err)
+	}
+	want = []int{MdNewLevel, MdDeleteLevel}
+	if !reflect.DeepEqual(actions, want) {
+		t.Errorf("actions %v, want %v", actions, want)
+	}
+	checkMdBook(t, book)
+	MarketStop()
+}
+
+func TestMdRecovery(t *testing.T) {
+	instr := "cu1912"
+	defer MdUnsubscribeAll()
+	cleanupOrderBook(instr)
+	MarketStart(false)
+	book := NewMdBook(instr)
+	book.Recover()
+	drop := false
+	gaps := 0
+	MdSubscribe(func(md *MdUpdate) {
+		if md.Symbol != instr {
+			return
+		}
+		if drop {
+			drop = false
+			return
+		}
+		if err := book.Apply(md); err == errMdGap {
+			gaps++
+		}
+	})
+	for _, or := range orders1 {
+		SendOrder(instr, or.bBuy, or.qty, or.prc)
+	}
+	checkMdBook(t, book)
+	// lose one update
+	drop = true
+	SendOrder(instr, true, 10, 40000)
+	SendOrder(instr, false, 10, 47000)
+	SendOrder(instr, true, 10, 40000)
+	if gaps != 1 || !book.Stale() {
+		t.Errorf("gaps %d stale %v, want gap detected", gaps, book.Stale())
+	}
+	// snapshot plus buffered incrementals
+	seq, bids, asks := MdSnapshot(instr)
+	SendOrder(instr, false, 15, 46000)
+	if err := book.Reset(seq, bids, asks); err != nil {
+		t.Error("Reset", err)
+	}
+	if book.Stale() {
+		t.Error("MdBook stale after Reset")
+	}
+	checkMdBook(t, book)
+	SendOrder(instr, true, 30, 46000)
+	checkMdBook(t, book)
+	cleanupOrderBook(instr)
+	checkMdBook(t, book)
+	MarketStop()
+}
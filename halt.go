@@ -0,0 +1,120 @@
+package auction
+
+import (
+	"errors"
+	"sort"
+)
+
+// halt policies, new orders of halted symbol rejected or queued in
+// orderBook without matching until reopening auction
+const (
+	HaltReject = iota + 1
+	HaltQueue
+)
+
+var (
+	errHalted    = errors.New("symbol halted")
+	errNotHalted = errors.New("symbol not halted")
+)
+
+type symbolHalt struct {
+	policy int
+	// StateHalted, StateCallAuction while reopening
+	state int
+}
+
+var haltedSymbols = map[string]*symbolHalt{}
+
+type SymbolStateHandler func(sym string, state int)
+
+var symbolStateHandlers []SymbolStateHandler
+
+// SymbolStateSubscribe register handler for state change of single symbol
+func SymbolStateSubscribe(fn SymbolStateHandler) {
+	symbolStateHandlers = append(symbolStateHandlers, fn)
+}
+
+func SymbolStateUnsubscribeAll() {
+	symbolStateHandlers = nil
+}
+
+func symbolStatePublish(sym string, state int) {
+	for _, fn := range symbolStateHandlers {
+		fn(sym, state)
+	}
+}
+
+// SymbolState return trading state of sym, global state unless sym halted
+// while global state is trading or pre auction
+func SymbolState(sym string) int {
+	if simState == StateCallAuction || simState == StateStop {
+		return simState
+	}
+	if h, ok := haltedSymbols[sym]; ok {
+		return h.state
+	}
+	return simState
+}
+
+// symbolAccept return error if new order of sym rejected by state
+func symbolAccept(sym string) error {
+	switch SymbolState(sym) {
+	case StateCallAuction, StateStop:
+		return errState
+	case StateHalted:
+		if haltedSymbols[sym].policy == HaltReject {
+			return errHalted
+		}
+	}
+	return nil
+}
+
+// resetHalts drop halts of previous session, symbols follow global state
+func resetHalts() {
+	syms := make([]string, 0, len(haltedSymbols))
+	for sym := range haltedSymbols {
+		syms = append(syms, sym)
+	}
+	sort.Strings(syms)
+	haltedSymbols = map[string]*symbolHalt{}
+	for _, sym := range syms {
+		symbolStatePublish(sym, SymbolState(sym))
+	}
+}
+
+// HaltSymbol stop matching of sym, cancel still allowed, policy decide
+// new orders rejected or queued
+func HaltSymbol(sym string, policy int) error {
+	if policy != HaltReject && policy != HaltQueue {
+		policy = HaltReject
+	}
+	if h, ok := haltedSymbols[sym]; ok {
+		h.policy = policy
+		return nil
+	}
+	haltedSymbols[sym] = &symbolHalt{policy: policy, state: StateHalted}
+	symbolStatePublish(sym, StateHalted)
+	return nil
+}
+
+// ResumeSymbol reopen sym with call auction at MatchCross price, pclose
+// zero for last trade price, no auction if global state not trading
+func ResumeSymbol(sym string, pclose int) (last int, maxVol, volRemain int, err error) {
+	h, ok := haltedSymbols[sym]
+	if !ok {
+		return 0, 0, 0, errNotHalted
+	}
+	if simState == StateTrading {
+		h.state = StateCallAuction
+		symbolStatePublish(sym, StateCallAuction)
+		if pclose == 0 {
+			tk, _ := GetTicker(sym)
+			pclose = tk.LastPrice
+		}
+		last, maxVol, volRemain = Uncross(sym, pclose)
+	}
+	delete(haltedSymbols, sym)
+	symbolStatePublish(sym, SymbolState(sym))
+	darkMatch(sym, true)
+	return
+}
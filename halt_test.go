@@ -0,0 +1,121 @@
+package auction
+
+import (
+	"testing"
+)
+
+func TestHaltSymbol(t *testing.T) {
+	instr := "cu1912"
+	defer SymbolStateUnsubscribeAll()
+	cleanupOrderBook(instr)
+	cleanupOrderBook("cu1911")
+	MarketStart(false)
+	var states []int
+	SymbolStateSubscribe(func(sym string, state int) {
+		if sym == instr {
+			states = append(states, state)
+		}
+	})
+	bid := SendOrder(instr, true, 5, 42000)
+	HaltSymbol(instr, HaltReject)
+	if SymbolState(instr) != StateHalted || SymbolState("cu1911") != StateTrading {
+		t.Errorf("symbol state %d/%d", SymbolState(instr), SymbolState("cu1911"))
+	}
+	if oid := SendOrder(instr, false, 5, 42000); oid != 0 {
+		t.Error("order of halted symbol accepted")
+	}
+	if _, err := SendOrderOwner(Owner{Account: "HALT1", ClOrdID: "h1"}, instr,
+		false, 5, 42000); err != errHalted {
+		t.Errorf("SendOrderOwner error %v", err)
+	}
+	if _, err := ReplaceOrder(bid, 5, 42100); err != errHalted {
+		t.Errorf("ReplaceOrder error %v", err)
+	}
+	// other symbols keep trading
+	SendOrder("cu1911", true, 1, 42000)
+	SendOrder("cu1911", false, 1, 42000)
+	if bids, _ := OrderBookLen("cu1911"); bids != 0 {
+		t.Error("cu1911 not matched")
+	}
+
+	// queued orders cross in reopening auction
+	HaltSymbol(instr, HaltQueue)
+	if oid := SendOrder(instr, false, 3, 41900); oid == 0 {
+		t.Error("order not queued")
+	}
+	if bids, asks := OrderBookLen(instr); bids != 1 || asks != 1 {
+		t.Errorf("queued orderBook %d/%d", bids, asks)
+	}
+	if err := CancelOrder(bid); err != nil {
+		t.Error("CancelOrder of halted symbol", err)
+	}
+	SendOrder(instr, true, 3, 42000)
+	last, vol, _, err := ResumeSymbol(instr, 0)
+	if err != nil || last != 42000 || vol != 3 {
+		t.Errorf("ResumeSymbol %d/%d %v", last, vol, err)
+	}
+	want := []int{StateHalted, StateCallAuction, StateTrading}
+	if len(states) != len(want) {
+		t.Fatalf("symbol states %v, want %v", states, want)
+	}
+	for i := range want {
+		if states[i] != want[i] {
+			t.Errorf("symbol states %v, want %v", states, want)
+		}
+	}
+	if _, _, _, err := ResumeSymbol(instr, 0); err != errNotHalted {
+		t.Error("ResumeSymbol not halted", err)
+	}
+	SendOrder(instr, false, 1, 41000)
+	SendOrder(instr, true, 1, 41000)
+	if bids, asks := OrderBookLen(instr); bids+asks != 0 {
+		t.Errorf("not matched after resume %d/%d", bids, asks)
+	}
+
+	// equal volume at same price end MatchCross
+	HaltSymbol(instr, HaltQueue)
+	SendOrder(instr, true, 2, 41500)
+	SendOrder(instr, false, 2, 41500)
+	if last, vol, _, _ := ResumeSymbol(instr, 41000); last != 41500 || vol != 2 {
+		t.Errorf("reopen at same price %d/%d", last, vol)
+	}
+
+	// no reopening auction in pre auction
+	simState = StatePreAuction
+	HaltSymbol(instr, HaltQueue)
+	SendOrder(instr, true, 2, 43000)
+	if _, vol, _, _ := ResumeSymbol(instr, 0); vol != 0 ||
+		SymbolState(instr) != StatePreAuction {
+		t.Errorf("resume in pre auction volume %d state %d", vol, SymbolState(instr))
+	}
+
+	// halt of ITCH replica, dropped by next session
+	book := NewItchBook()
+	feed := NewItchFeed(func(seq uint64, msg []byte) {
+		if err := book.Apply(seq, msg); err != nil {
+			t.Errorf("Apply seq %d: %v", seq, err)
+		}
+	})
+	defer func() {
+		feed.Stop()
+		MboUnsubscribeAll()
+		MdUnsubscribeAll()
+		StateUnsubscribeAll()
+	}()
+	MarketStart(false)
+	HaltSymbol(instr, HaltReject)
+	if book.SymbolState(instr) != StateHalted || book.SymbolState("cu1911") != StateTrading {
+		t.Errorf("ITCH symbol state %d/%d", book.SymbolState(instr),
+			book.SymbolState("cu1911"))
+	}
+	MarketStop()
+	MarketStart(false)
+	if SymbolState(instr) != StateTrading || book.SymbolState(instr) != StateTrading {
+		t.Errorf("symbol state %d, ITCH %d after MarketStart", SymbolState(instr),
+			book.SymbolState(instr))
+	}
+	if oid := SendOrder(instr, true, 1, 40000); oid == 0 {
+		t.Error("order rejected after MarketStart")
+	}
+	MarketStop()
+}
@@ -0,0 +1,511 @@
+package auction
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ITCH like message types, all integers big endian, symbol left justified
+// and space padded, every message start with type and timestamp of
+// nanoseconds since midnight
+const (
+	ItchState     = 'S'
+	ItchAddOrder  = 'A'
+	ItchExecuted  = 'E'
+	ItchCancel    = 'X'
+	ItchDelete    = 'D'
+	ItchTrade     = 'P'
+	ItchCross     = 'Q'
+	ItchImbalance = 'I'
+	// trading state of single symbol, halt and resume
+	ItchTradingAction = 'H'
+)
+
+const itchSymbolLen = 8
+
+// message lengths include type and timestamp
+const (
+	itchHdrLen       = 1 + 8
+	itchStateLen     = itchHdrLen + 1
+	itchAddOrderLen  = itchHdrLen + 8 + 1 + 4 + itchSymbolLen + 4
+	itchExecutedLen  = itchHdrLen + 8 + 4 + 8 + 4
+	itchCancelLen    = itchHdrLen + 8 + 4
+	itchDeleteLen    = itchHdrLen + 8
+	itchTradeLen     = itchHdrLen + 1 + 4 + itchSymbolLen + 4 + 8
+	itchCrossLen     = itchHdrLen + 4 + itchSymbolLen + 4 + 8
+	itchImbalanceLen = itchHdrLen + itchSymbolLen + 4 + 4 + 1 + 4
+	itchActionLen    = itchHdrLen + itchSymbolLen + 1
+)
+
+var (
+	errItchLength = errors.New("wrong ITCH message length")
+	errItchGap    = errors.New("ITCH sequence gap")
+	errItchOrder  = errors.New("ITCH unknown order")
+)
+
+// ItchMsg is decoded ITCH message, fields used depend on Type
+// Qty is added/executed/canceled volume, Price is execution price for
+// ItchExecuted and indicative price for ItchImbalance
+type ItchMsg struct {
+	Type      byte
+	Timestamp int64
+	Symbol    string
+	Oid       int
+	IsBuy     bool
+	Qty       int
+	Price     int
+	MatchNo   int
+	State     int
+	Paired    int
+	Imbalance int
+}
+
+func itchSide(isBuy bool) byte {
+	if isBuy {
+		return 'B'
+	}
+	return 'S'
+}
+
+func itchTimestamp() int64 {
+	now := simClock()
+	y, m, d := now.Date()
+	return now.Sub(time.Date(y, m, d, 0, 0, 0, 0, now.Location())).Nanoseconds()
+}
+
+type itchBuf struct {
+	b   []byte
+	off int
+}
+
+func (buf *itchBuf) u8(v byte) {
+	buf.b[buf.off] = v
+	buf.off++
+}
+
+func (buf *itchBuf) u32(v int) {
+	binary.BigEndian.PutUint32(buf.b[buf.off:], uint32(v))
+	buf.off += 4
+}
+
+func (buf *itchBuf) u64(v int64) {
+	binary.BigEndian.PutUint64(buf.b[buf.off:], uint64(v))
+	buf.off += 8
+}
+
+func (buf *itchBuf) symbol(s string) {
+	copy(buf.b[buf.off:buf.off+itchSymbolLen], "        ")
+	copy(buf.b[buf.off:buf.off+itchSymbolLen], s)
+	buf.off += itchSymbolLen
+}
+
+func (buf *itchBuf) getU8() byte {
+	v := buf.b[buf.off]
+	buf.off++
+	return v
+}
+
+func (buf *itchBuf) getU32() int {
+	v := binary.BigEndian.Uint32(buf.b[buf.off:])
+	buf.off += 4
+	return int(v)
+}
+
+func (buf *itchBuf) getU64() int64 {
+	v := binary.BigEndian.Uint64(buf.b[buf.off:])
+	buf.off += 8
+	return int64(v)
+}
+
+func (buf *itchBuf) getSymbol() string {
+	s := string(bytes.TrimRight(buf.b[buf.off:buf.off+itchSymbolLen], " "))
+	buf.off += itchSymbolLen
+	return s
+}
+
+func itchLen(typ byte) int {
+	switch typ {
+	case ItchState:
+		return itchStateLen
+	case ItchAddOrder:
+		return itchAddOrderLen
+	case ItchExecuted:
+		return itchExecutedLen
+	case ItchCancel:
+		return itchCancelLen
+	case ItchDelete:
+		return itchDeleteLen
+	case ItchTrade:
+		return itchTradeLen
+	case ItchCross:
+		return itchCrossLen
+	case ItchImbalance:
+		return itchImbalanceLen
+	case ItchTradingAction:
+		return itchActionLen
+	}
+	return 0
+}
+
+// Encode return binary form of ITCH message, nil for unknown Type
+func (m *ItchMsg) Encode() []byte {
+	n := itchLen(m.Type)
+	if n == 0 {
+		return nil
+	}
+	w := &itchBuf{b: make([]byte, n)}
+	w.u8(m.Type)
+	w.u64(m.Timestamp)
+	switch m.Type {
+	case ItchState:
+		w.u8(byte(m.State))
+	case ItchAddOrder:
+		w.u64(int64(m.Oid))
+		w.u8(itchSide(m.IsBuy))
+		w.u32(m.Qty)
+		w.symbol(m.Symbol)
+		w.u32(m.Price)
+	case ItchExecuted:
+		w.u64(int64(m.Oid))
+		w.u32(m.Qty)
+		w.u64(int64(m.MatchNo))
+		w.u32(m.Price)
+	case ItchCancel:
+		w.u64(int64(m.Oid))
+		w.u32(m.Qty)
+	case ItchDelete:
+		w.u64(int64(m.Oid))
+	case ItchTrade:
+		w.u8(itchSide(m.IsBuy))
+		w.u32(m.Qty)
+		w.symbol(m.Symbol)
+		w.u32(m.Price)
+		w.u64(int64(m.MatchNo))
+	case ItchCross:
+		w.u32(m.Qty)
+		w.symbol(m.Symbol)
+		w.u32(m.Price)
+		w.u64(int64(m.MatchNo))
+	case ItchImbalance:
+		w.symbol(m.Symbol)
+		w.u32(m.Paired)
+		w.u32(m.Imbalance)
+		w.u8(itchSide(m.IsBuy))
+		w.u32(m.Price)
+	case ItchTradingAction:
+		w.symbol(m.Symbol)
+		w.u8(byte(m.State))
+	}
+	return w.b
+}
+
+// DecodeItch parse one ITCH message
+func DecodeItch(b []byte) (*ItchMsg, error) {
+	if len(b) == 0 || itchLen(b[0]) != len(b) {
+		return nil, errItchLength
+	}
+	r := &itchBuf{b: b}
+	m := &ItchMsg{Type: r.getU8(), Timestamp: r.getU64()}
+	switch m.Type {
+	case ItchState:
+		m.State = int(r.getU8())
+	case ItchAddOrder:
+		m.Oid = int(r.getU64())
+		m.IsBuy = r.getU8() == 'B'
+		m.Qty = r.getU32()
+		m.Symbol = r.getSymbol()
+		m.Price = r.getU32()
+	case ItchExecuted:
+		m.Oid = int(r.getU64())
+		m.Qty = r.getU32()
+		m.MatchNo = int(r.getU64())
+		m.Price = r.getU32()
+	case ItchCancel:
+		m.Oid = int(r.getU64())
+		m.Qty = r.getU32()
+	case ItchDelete:
+		m.Oid = int(r.getU64())
+	case ItchTrade:
+		m.IsBuy = r.getU8() == 'B'
+		m.Qty = r.getU32()
+		m.Symbol = r.getSymbol()
+		m.Price = r.getU32()
+		m.MatchNo = int(r.getU64())
+	case ItchCross:
+		m.Qty = r.getU32()
+		m.Symbol = r.getSymbol()
+		m.Price = r.getU32()
+		m.MatchNo = int(r.getU64())
+	case ItchImbalance:
+		m.Symbol = r.getSymbol()
+		m.Paired = r.getU32()
+		m.Imbalance = r.getU32()
+		m.IsBuy = r.getU8() == 'B'
+		m.Price = r.getU32()
+	case ItchTradingAction:
+		m.Symbol = r.getSymbol()
+		m.State = int(r.getU8())
+	}
+	return m, nil
+}
+
+// ItchHandler receive encoded message with session wide sequence number
+type ItchHandler func(seq uint64, msg []byte)
+
+// ItchFeed encode order by order events, trades and state changes of all
+// symbols into one sequenced ITCH stream
+// ItchTrade/ItchCross are trade reports, book volume is only changed by
+// ItchExecuted
+type ItchFeed struct {
+	seq     uint64
+	handler ItchHandler
+	stopped bool
+}
+
+func NewItchFeed(fn ItchHandler) *ItchFeed {
+	f := &ItchFeed{handler: fn}
+	MboSubscribe(f.onMbo)
+	MdSubscribe(f.onMd)
+	StateSubscribe(f.onState)
+	SymbolStateSubscribe(f.onSymbolState)
+	return f
+}
+
+// Stop detach ItchFeed
+func (f *ItchFeed) Stop() {
+	f.stopped = true
+}
+
+// Seq return sequence number of last published message
+func (f *ItchFeed) Seq() uint64 {
+	return f.seq
+}
+
+func (f *ItchFeed) publish(m *ItchMsg) {
+	if f.stopped {
+		return
+	}
+	m.Timestamp = itchTimestamp()
+	f.seq++
+	if f.handler != nil {
+		f.handler(f.seq, m.Encode())
+	}
+}
+
+func (f *ItchFeed) onMbo(mbo *MboUpdate) {
+	m := ItchMsg{Oid: mbo.Oid, Qty: mbo.Volume}
+	switch mbo.Action {
+	case MboAdd:
+		m.Type = ItchAddOrder
+		m.Symbol = mbo.Symbol
+		m.IsBuy = mbo.IsBuy
+		m.Price = mbo.Price
+	case MboExecuted:
+		m.Type = ItchExecuted
+		m.Price = mbo.ExecPrice
+		m.MatchNo = mbo.TradeNo
+	case MboReduced:
+		m.Type = ItchCancel
+	case MboDeleted:
+		m.Type = ItchDelete
+	default:
+		return
+	}
+	f.publish(&m)
+}
+
+func (f *ItchFeed) onMd(md *MdUpdate) {
+	if md.Action != MdTrade {
+		return
+	}
+	m := ItchMsg{Type: ItchTrade, Symbol: md.Symbol, IsBuy: md.IsBuy,
+		Qty: md.Volume, Price: md.Price, MatchNo: md.TradeNo}
+	if md.Auction {
+		m.Type = ItchCross
+	}
+	f.publish(&m)
+}
+
+func (f *ItchFeed) onState(state int) {
+	f.publish(&ItchMsg{Type: ItchState, State: state})
+}
+
+func (f *ItchFeed) onSymbolState(sym string, state int) {
+	f.publish(&ItchMsg{Type: ItchTradingAction, Symbol: sym, State: state})
+}
+
+// Imbalance publish indicative uncross price, paired and imbalance volume
+// of sym, called during call auction
+func (f *ItchFeed) Imbalance(sym string, pclose int) {
+	last, paired, _ := MatchCross(sym, pclose)
+	m := ItchMsg{Type: ItchImbalance, Symbol: sym, Price: last, Paired: paired}
+	if orB, ok := simOrderBook[sym]; ok && paired > 0 {
+		var bidVol, askVol int
+		for p, v := range orB.bidLevels {
+			if p == 0 || p >= last {
+				bidVol += v
+			}
+		}
+		for p, v := range orB.askLevels {
+			if p <= last {
+				askVol += v
+			}
+		}
+		if bidVol > askVol {
+			m.IsBuy = true
+			m.Imbalance = bidVol - paired
+		} else {
+			m.Imbalance = askVol - paired
+		}
+	}
+	f.publish(&m)
+}
+
+// ItchOrder is open order rebuilt from ITCH stream
+type ItchOrder struct {
+	Oid    int
+	Symbol string
+	IsBuy  bool
+	Price  int
+	Qty    int
+	// seq of add message, order join back of price level on add
+	prio uint64
+}
+
+// ItchBook rebuild orderBooks of all symbols from ITCH stream
+type ItchBook struct {
+	seq    uint64
+	state  int
+	orders map[int]*ItchOrder
+	// halted or reopening symbols
+	symStates map[string]int
+}
+
+func NewItchBook() *ItchBook {
+	return &ItchBook{orders: map[int]*ItchOrder{}, symStates: map[string]int{}}
+}
+
+// Seq return sequence number of last applied message
+func (b *ItchBook) Seq() uint64 {
+	return b.seq
+}
+
+// State return last trading state
+func (b *ItchBook) State() int {
+	return b.state
+}
+
+// SymbolState return trading state of sym, same rule as engine SymbolState
+func (b *ItchBook) SymbolState(sym string) int {
+	if b.state == StateCallAuction || b.state == StateStop {
+		return b.state
+	}
+	if st, ok := b.symStates[sym]; ok {
+		return st
+	}
+	return b.state
+}
+
+// Apply message of seq, duplicate ignored, return errItchGap if messages
+// missed, then retransmission should be requested from Seq()+1
+func (b *ItchBook) Apply(seq uint64, msg []byte) error {
+	if seq <= b.seq {
+		return nil
+	}
+	if seq != b.seq+1 {
+		return errItchGap
+	}
+	m, err := DecodeItch(msg)
+	if err != nil {
+		return err
+	}
+	b.seq = seq
+	switch m.Type {
+	case ItchState:
+		b.state = m.State
+	case ItchTradingAction:
+		if m.State == StateHalted || m.State == StateCallAuction {
+			b.symStates[m.Symbol] = m.State
+		} else {
+			delete(b.symStates, m.Symbol)
+		}
+	case ItchAddOrder:
+		b.orders[m.Oid] = &ItchOrder{Oid: m.Oid, Symbol: m.Symbol,
+			IsBuy: m.IsBuy, Price: m.Price, Qty: m.Qty, prio: seq}
+	case ItchExecuted, ItchCancel, ItchDelete:
+		or, ok := b.orders[m.Oid]
+		if !ok {
+			return errItchOrder
+		}
+		if m.Type == ItchDelete {
+			or.Qty = 0
+		} else {
+			or.Qty -= m.Qty
+		}
+		if or.Qty <= 0 {
+			delete(b.orders, m.Oid)
+		}
+	}
+	return nil
+}
+
+// Orders return open orders of sym in orderBook priority
+func (b *ItchBook) Orders(sym string) (bids, asks []ItchOrder) {
+	for _, or := range b.orders {
+		if or.Symbol != sym {
+			continue
+		}
+		if or.IsBuy {
+			bids = append(bids, *or)
+		} else {
+			asks = append(asks, *or)
+		}
+	}
+	sort.Slice(bids, func(i, j int) bool {
+		a, b := &bids[i], &bids[j]
+		if a.Price == b.Price {
+			return a.prio < b.prio
+		}
+		if a.Price == 0 || b.Price == 0 {
+			return a.Price == 0
+		}
+		return a.Price > b.Price
+	})
+	sort.Slice(asks, func(i, j int) bool {
+		a, b := &asks[i], &asks[j]
+		if a.Price == b.Price {
+			return a.prio < b.prio
+		}
+		return a.Price < b.Price
+	})
+	return
+}
+
+// Verify compare rebuilt orderBook of sym with engine BuildOrBk
+func (b *ItchBook) Verify(sym string) error {
+	bids, asks := b.Orders(sym)
+	obids, oasks := BuildOrBk(sym)
+	check := func(side string, mine []ItchOrder, orders []*simOrderType) error {
+		if len(mine) != len(orders) {
+			return fmt.Errorf("%s %s orders %d, orderBook %d", sym, side,
+				len(mine), len(orders))
+		}
+		for i, v := range orders {
+			or := &mine[i]
+			if or.Oid != v.oid || or.Price != v.price || or.Qty != v.Qty-v.Filled {
+				return fmt.Errorf("%s %s order %d: %d %d@%d, orderBook %d %d@%d",
+					sym, side, i, or.Oid, or.Qty, or.Price, v.oid,
+					v.Qty-v.Filled, v.price)
+			}
+		}
+		return nil
+	}
+	if err := check("bid", bids, obids); err != nil {
+		return err
+	}
+	return check("ask", asks, oasks)
+}
@@ -0,0 +1,113 @@
+package auction
+
+import (
+	"testing"
+)
+
+func TestItchCodec(t *testing.T) {
+	msgs := []ItchMsg{
+		{Type: ItchState, Timestamp: 1, State: StateTrading},
+		{Type: ItchAddOrder, Timestamp: 2, Oid: 3, Symbol: "cu1912", IsBuy: true,
+			Qty: 10, Price: 42000},
+		{Type: ItchExecuted, Timestamp: 3, Oid: 3, Qty: 4, Price: 42000, MatchNo: 5},
+		{Type: ItchCancel, Timestamp: 4, Oid: 3, Qty: 2},
+		{Type: ItchDelete, Timestamp: 5, Oid: 3},
+		{Type: ItchTrade, Timestamp: 6, Symbol: "cu1912", Qty: 4, Price: 42000,
+			MatchNo: 5},
+		{Type: ItchCross, Timestamp: 7, Symbol: "cu1912", Qty: 75, Price: 43900,
+			MatchNo: 6},
+		{Type: ItchImbalance, Timestamp: 8, Symbol: "cu1912", Paired: 75,
+			Imbalance: 20, IsBuy: true, Price: 43900},
+		{Type: ItchTradingAction, Timestamp: 9, Symbol: "cu1912", State: StateHalted},
+	}
+	for _, m := range msgs {
+		got, err := DecodeItch(m.Encode())
+		if err != nil || *got != m {
+			t.Errorf("DecodeItch %+v %v, want %+v", got, err, m)
+		}
+	}
+	if _, err := DecodeItch([]byte{ItchDelete, 0}); err != errItchLength {
+		t.Errorf("short message error %v", err)
+	}
+	book := NewItchBook()
+	if err := book.Apply(2, msgs[0].Encode()); err != errItchGap {
+		t.Errorf("Apply with gap %v", err)
+	}
+}
+
+func TestItchFeed(t *testing.T) {
+	instr := "cu1912"
+	cleanupOrderBook(instr)
+	simState = StatePreAuction
+	book := NewItchBook()
+	var msgs []*ItchMsg
+	feed := NewItchFeed(func(seq uint64, msg []byte) {
+		if err := book.Apply(seq, msg); err != nil {
+			t.Errorf("Apply seq %d: %v", seq, err)
+		}
+		m, _ := DecodeItch(msg)
+		msgs = append(msgs, m)
+	})
+	defer func() {
+		feed.Stop()
+		MboUnsubscribeAll()
+		MdUnsubscribeAll()
+		StateUnsubscribeAll()
+	}()
+	verify := func(step string) {
+		t.Helper()
+		if err := book.Verify(instr); err != nil {
+			t.Errorf("%s: %v", step, err)
+		}
+	}
+	buildOrBook(func() (res []orderArgs) {
+		for _, or := range orders1 {
+			or.sym = instr
+			res = append(res, or)
+		}
+		return
+	}())
+	verify("call auction")
+	msgs = nil
+	feed.Imbalance(instr, 40000)
+	if len(msgs) != 1 || msgs[0].Type != ItchImbalance || msgs[0].Paired != 75 ||
+		msgs[0].Price != 43900 {
+		t.Errorf("imbalance %+v", msgs)
+	}
+	msgs = nil
+	Uncross(instr, 40000)
+	verify("uncross")
+	var cross *ItchMsg
+	for _, m := range msgs {
+		if m.Type == ItchCross {
+			cross = m
+		}
+	}
+	if cross == nil || cross.Qty != 75 || cross.Price != 43900 {
+		t.Errorf("cross trade %+v", cross)
+	}
+	MarketStart(false)
+	if book.State() != StateTrading {
+		t.Errorf("state %d, want %d", book.State(), StateTrading)
+	}
+	oid := SendOrder(instr, false, 10, 43800)
+	verify("continuous trading")
+	SendOrder(instr, true, 30, 41000)
+	SendOrder(instr, false, 5, 44000)
+	if err := ReduceOrder(oid, 8); err != nil && err != errReduceOrder {
+		t.Error("ReduceOrder", err)
+	}
+	verify("reduce")
+	bids, _ := BuildOrBk(instr)
+	if len(bids) > 0 {
+		if _, err := ReplaceOrder(bids[0].oid, bids[0].Qty, bids[0].price-100); err != nil {
+			t.Error("ReplaceOrder", err)
+		}
+		CancelOrder(bids[len(bids)-1].oid)
+	}
+	verify("replace and cancel")
+	if book.Seq() != feed.Seq() {
+		t.Errorf("book seq %d, feed seq %d", book.Seq(), feed.Seq())
+	}
+	MarketStop()
+}
@@ -0,0 +1,145 @@
+package auction
+
+// matching algorithms of continuous trading at best price level
+const (
+	MatchFIFO = iota
+	MatchProRata
+)
+
+// MatchAlgo configure allocation of incoming order at a price level,
+// steps in order: TopOrder, FifoPct of volume by time priority, pro-rata
+// by open volume rounded down with allocation below MinAlloc zeroed,
+// remainder by time priority
+type MatchAlgo struct {
+	Algo int
+	// TopOrder earliest order of level filled first
+	TopOrder bool
+	MinAlloc int
+	// FifoPct percent of volume allocated FIFO before pro-rata, hybrid
+	FifoPct int
+}
+
+// algorithms by symbol, FIFO if not set
+var matchAlgos = map[string]*MatchAlgo{}
+
+// allocation of marginal price level in call auction uncross by symbol,
+// time priority if not set
+var auctionAlgos = map[string]*MatchAlgo{}
+
+// SetMatchAlgo set matching algorithm of sym, nil or MatchFIFO restore
+// price time priority
+func SetMatchAlgo(sym string, ma *MatchAlgo) {
+	if ma == nil || ma.Algo == MatchFIFO {
+		delete(matchAlgos, sym)
+		return
+	}
+	cp := *ma
+	matchAlgos[sym] = &cp
+}
+
+// GetMatchAlgo return matching algorithm of sym
+func GetMatchAlgo(sym string) MatchAlgo {
+	if ma, ok := matchAlgos[sym]; ok {
+		return *ma
+	}
+	return MatchAlgo{}
+}
+
+// SetAuctionAlgo set allocation of marginal price level of sym in
+// Uncross, price discovery of MatchCross unchanged, nil or MatchFIFO
+// restore time priority
+func SetAuctionAlgo(sym string, ma *MatchAlgo) {
+	if ma == nil || ma.Algo == MatchFIFO {
+		delete(auctionAlgos, sym)
+		return
+	}
+	cp := *ma
+	auctionAlgos[sym] = &cp
+}
+
+// GetAuctionAlgo return allocation of marginal price level of sym
+func GetAuctionAlgo(sym string) MatchAlgo {
+	if ma, ok := auctionAlgos[sym]; ok {
+		return *ma
+	}
+	return MatchAlgo{}
+}
+
+// allocate split vol among open volumes leaves in time priority
+func (ma *MatchAlgo) allocate(leaves []int, vol int) []int {
+	alloc := make([]int, len(leaves))
+	total := 0
+	for _, q := range leaves {
+		total += q
+	}
+	if vol >= total {
+		copy(alloc, leaves)
+		return alloc
+	}
+	rest := vol
+	give := func(i, q int) {
+		if open := leaves[i] - alloc[i]; q > open {
+			q = open
+		}
+		alloc[i] += q
+		rest -= q
+	}
+	fifo := func(q int) {
+		for i := range leaves {
+			if q <= 0 || rest <= 0 {
+				return
+			}
+			before := rest
+			give(i, q)
+			q -= before - rest
+		}
+	}
+	if ma.TopOrder && len(leaves) > 0 {
+		give(0, rest)
+	}
+	if ma.FifoPct > 0 {
+		fifo(rest * ma.FifoPct / 100)
+	}
+	open := 0
+	for i := range leaves {
+		open += leaves[i] - alloc[i]
+	}
+	if base := rest; base > 0 && open > 0 {
+		for i := range leaves {
+			q := base * (leaves[i] - alloc[i]) / open
+			if q < ma.MinAlloc {
+				continue
+			}
+			give(i, q)
+		}
+	}
+	fifo(rest)
+	return alloc
+}
+
+// levelOrders return copies of orders at price of side in time priority
+func levelOrders(orB *orderBook, isBuy bool, price int) []simOrderType {
+	var res []simOrderType
+	orB.walk(isBuy, func(v *simOrderType) bool {
+		if v.price != price {
+			return false
+		}
+		res = append(res, *v)
+		return true
+	})
+	return res
+}
+
+// levelSelfTrade apply self trade prevention to orders of level at price
+// before allocation, return true if incoming order canceled
+func levelSelfTrade(orB *orderBook, order *simOrderType, isBuy bool, price int) bool {
+	for _, v := range levelOrders(orB, isBuy, price) {
+		if !selfTrade(order, &v) {
+			continue
+		}
+		if preventSelfTrade(orB, order, orB.find(&v)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,148 @@
+package auction
+
+import (
+	"testing"
+)
+
+func TestMatchAllocate(t *testing.T) {
+	tests := []struct {
+		ma     MatchAlgo
+		leaves []int
+		vol    int
+		want   []int
+	}{
+		{MatchAlgo{}, []int{10, 20, 30, 40}, 50, []int{5, 10, 15, 20}},
+		{MatchAlgo{}, []int{10, 20}, 40, []int{10, 20}},
+		// rounding down, remainder by time priority
+		{MatchAlgo{}, []int{1, 1, 1}, 2, []int{1, 1, 0}},
+		{MatchAlgo{}, []int{3, 5, 7}, 10, []int{3, 3, 4}},
+		{MatchAlgo{}, []int{7, 5, 3}, 10, []int{5, 3, 2}},
+		// allocation below minimum zeroed
+		{MatchAlgo{MinAlloc: 2}, []int{1, 10, 10, 1}, 12, []int{1, 6, 5, 0}},
+		{MatchAlgo{MinAlloc: 3}, []int{10, 2, 10}, 10, []int{6, 0, 4}},
+		{MatchAlgo{TopOrder: true}, []int{5, 10, 10}, 15, []int{5, 5, 5}},
+		{MatchAlgo{TopOrder: true}, []int{20, 10}, 15, []int{15, 0}},
+		{MatchAlgo{FifoPct: 40}, []int{10, 10, 10}, 10, []int{6, 2, 2}},
+		{MatchAlgo{FifoPct: 100}, []int{3, 10}, 5, []int{3, 2}},
+	}
+	for i, tt := range tests {
+		got := tt.ma.allocate(tt.leaves, tt.vol)
+		for j := range got {
+			if got[j] != tt.want[j] {
+				t.Errorf("case %d allocate %v, want %v", i, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestProRataMatch(t *testing.T) {
+	instr := "cu1912"
+	defer SetMatchAlgo(instr, nil)
+	cleanupOrderBook(instr)
+	MarketStart(false)
+	SetMatchAlgo(instr, &MatchAlgo{Algo: MatchProRata, MinAlloc: 1})
+	if ma := GetMatchAlgo(instr); ma.Algo != MatchProRata || ma.MinAlloc != 1 {
+		t.Errorf("GetMatchAlgo %+v", ma)
+	}
+	a1 := SendOrder(instr, false, 10, 50000)
+	a2 := SendOrder(instr, false, 30, 50000)
+	a3 := SendOrder(instr, false, 10, 50100)
+	SendOrder(instr, true, 20, 50000)
+	if openVol(instr, a1) != 5 || openVol(instr, a2) != 15 {
+		t.Errorf("pro-rata open %d/%d", openVol(instr, a1), openVol(instr, a2))
+	}
+	// sweep level then next level
+	b1 := SendOrder(instr, true, 24, 50100)
+	if openVol(instr, b1) != 0 || openVol(instr, a3) != 6 {
+		t.Errorf("sweep open %d/%d", openVol(instr, b1), openVol(instr, a3))
+	}
+	if bids, asks := OrderBookLen(instr); bids != 0 || asks != 1 {
+		t.Errorf("orderBook %d/%d", bids, asks)
+	}
+
+	// order of same account behind level head, incoming canceled by STP
+	defer StpUnsubscribeAll()
+	var evs []StpEvent
+	StpSubscribe(func(ev *StpEvent) {
+		evs = append(evs, *ev)
+	})
+	b2 := SendOrder(instr, true, 10, 49900)
+	s1 := sendOwner(t, Owner{Account: "PRO1", ClOrdID: "s1"}, instr, true, 10, 49900)
+	s2 := sendOwner(t, Owner{Account: "PRO1", ClOrdID: "s2"}, instr, false, 4, 49900)
+	if len(evs) != 1 || evs[0].Oid != s2 || evs[0].RestingOid != s1 ||
+		openVol(instr, s1) != 10 || openVol(instr, b2) != 10 || openVol(instr, s2) != 0 {
+		t.Errorf("self trade events %+v, open %d/%d", evs, openVol(instr, s1),
+			openVol(instr, b2))
+	}
+
+	// resting self order canceled, level allocated to others
+	SetStpMode(StpCancelResting)
+	defer SetStpMode(StpCancelIncoming)
+	b3 := SendOrder(instr, true, 10, 49900)
+	s3 := sendOwner(t, Owner{Account: "PRO1", ClOrdID: "s3"}, instr, false, 4, 49900)
+	if len(evs) != 2 || evs[1].RestingOid != s1 || openVol(instr, s1) != 0 ||
+		openVol(instr, s3) != 0 || openVol(instr, b2) != 8 || openVol(instr, b3) != 8 {
+		t.Errorf("cancel resting events %+v, open %d/%d/%d", evs, openVol(instr, s1),
+			openVol(instr, b2), openVol(instr, b3))
+	}
+	if err := verifySimOrderBook(instr); err != nil {
+		t.Error("verifySimOrderBook", err)
+	}
+	SetStpMode(StpCancelIncoming)
+
+	// FIFO restored
+	SetMatchAlgo(instr, &MatchAlgo{Algo: MatchFIFO})
+	SendOrder(instr, false, 4, 49900)
+	if openVol(instr, b2) != 4 || openVol(instr, b3) != 8 {
+		t.Errorf("FIFO open %d/%d", openVol(instr, b2), openVol(instr, b3))
+	}
+	MarketStop()
+}
+
+func TestAuctionProRata(t *testing.T) {
+	instr := "cu1912"
+	defer SetAuctionAlgo(instr, nil)
+	cleanupOrderBook(instr)
+	MarketStart(false)
+	simState = StatePreAuction
+	SetAuctionAlgo(instr, &MatchAlgo{Algo: MatchProRata})
+	if ma := GetAuctionAlgo(instr); ma.Algo != MatchProRata {
+		t.Errorf("GetAuctionAlgo %+v", ma)
+	}
+	b1 := SendOrder(instr, true, 10, 50100)
+	b2 := SendOrder(instr, true, 10, 50000)
+	b3 := SendOrder(instr, true, 30, 50000)
+	a1 := SendOrder(instr, false, 17, 50000)
+	a2 := SendOrder(instr, false, 13, 49900)
+	last, vol, _ := Uncross(instr, 50000)
+	if last != 50000 || vol != 30 {
+		t.Fatalf("Uncross %d/%d", last, vol)
+	}
+	// better priced b1 filled first, 20 left for marginal level
+	if openVol(instr, b1) != 0 || openVol(instr, b2) != 5 || openVol(instr, b3) != 15 {
+		t.Errorf("marginal level open %d/%d/%d", openVol(instr, b1),
+			openVol(instr, b2), openVol(instr, b3))
+	}
+	if openVol(instr, a1) != 0 || openVol(instr, a2) != 0 {
+		t.Error("sell side not filled")
+	}
+	if bids, asks := OrderBookLen(instr); bids != 2 || asks != 0 {
+		t.Errorf("orderBook %d/%d", bids, asks)
+	}
+
+	// lot rounding, remainder by time priority
+	cleanupOrderBook(instr)
+	b4 := SendOrder(instr, true, 1, 50000)
+	b5 := SendOrder(instr, true, 1, 50000)
+	b6 := SendOrder(instr, true, 1, 50000)
+	SendOrder(instr, false, 2, 50000)
+	if _, vol, _ := Uncross(instr, 50000); vol != 2 {
+		t.Errorf("Uncross volume %d", vol)
+	}
+	if openVol(instr, b4) != 0 || openVol(instr, b5) != 0 || openVol(instr, b6) != 1 {
+		t.Errorf("rounding open %d/%d/%d", openVol(instr, b4), openVol(instr, b5),
+			openVol(instr, b6))
+	}
+	MarketStop()
+}
@@ -0,0 +1,54 @@
+package auction
+
+// market by order actions
+const (
+	MboAdd = iota + 1
+	MboExecuted
+	MboReduced
+	MboDeleted
+)
+
+// MboUpdate is order by order book event, sequenced per symbol
+// Volume is displayed qty for MboAdd, executed/reduced/deleted volume others
+// an order executed to zero is removed from book without MboDeleted.
+// MboAdd join back of price level, repriced order is MboDeleted then MboAdd
+type MboUpdate struct {
+	Seq       uint64
+	Symbol    string
+	Action    int
+	Oid       int
+	IsBuy     bool
+	Price     int
+	Volume    int
+	ExecPrice int
+	TradeNo   int
+}
+
+type MboHandler func(mbo *MboUpdate)
+
+var mboHandlers []MboHandler
+var mboSeqs = map[string]uint64{}
+
+// MboSubscribe register handler for order by order events of all symbols
+func MboSubscribe(fn MboHandler) {
+	mboHandlers = append(mboHandlers, fn)
+}
+
+func MboUnsubscribeAll() {
+	mboHandlers = nil
+}
+
+func mboPublish(mbo *MboUpdate) {
+	seq := mboSeqs[mbo.Symbol] + 1
+	mboSeqs[mbo.Symbol] = seq
+	mbo.Seq = seq
+	for _, fn := range mboHandlers {
+		fn(mbo)
+	}
+}
+
+func (orBook *orderBook) publishMbo(action int, or *simOrderType, vol int) {
+	mbo := MboUpdate{Symbol: orBook.sym, Action: action, Oid: or.oid,
+		IsBuy: or.bBuy, Price: or.price, Volume: vol}
+	mboPublish(&mbo)
+}
@@ -0,0 +1,142 @@
+package auction
+
+import (
+	"reflect"
+	"testing"
+)
+
+type mboOrder struct {
+	oid   int
+	price int
+	vol   int
+}
+
+// mboBook rebuild orders per side in priority sequence from MboUpdate
+type mboBook struct {
+	seq  uint64
+	bids []mboOrder
+	asks []mboOrder
+}
+
+func (b *mboBook) side(isBuy bool) *[]mboOrder {
+	if isBuy {
+		return &b.bids
+	}
+	return &b.asks
+}
+
+func (b *mboBook) apply(t *testing.T, mbo *MboUpdate) {
+	if mbo.Seq != b.seq+1 {
+		t.Errorf("mbo seq %d, want %d", mbo.Seq, b.seq+1)
+	}
+	b.seq = mbo.Seq
+	orders := b.side(mbo.IsBuy)
+	if mbo.Action == MboAdd {
+		// add join back of price level
+		or := mboOrder{oid: mbo.Oid, price: mbo.Price, vol: mbo.Volume}
+		i := 0
+		for ; i < len(*orders); i++ {
+			o := (*orders)[i]
+			if (mbo.IsBuy && o.price < or.price) || (!mbo.IsBuy && o.price > or.price) {
+				break
+			}
+		}
+		*orders = append(*orders, mboOrder{})
+		copy((*orders)[i+1:], (*orders)[i:])
+		(*orders)[i] = or
+		return
+	}
+	for i := range *orders {
+		if (*orders)[i].oid != mbo.Oid {
+			continue
+		}
+		if mbo.Action == MboExecuted && i != 0 {
+			t.Errorf("oid %d executed out of priority", mbo.Oid)
+		}
+		(*orders)[i].vol -= mbo.Volume
+		if mbo.Action == MboDeleted || (*orders)[i].vol <= 0 {
+			*orders = append((*orders)[:i], (*orders)[i+1:]...)
+		}
+		return
+	}
+	t.Errorf("mbo action %d for unknown oid %d", mbo.Action, mbo.Oid)
+}
+
+func engineMboOrders(sym string) (bids, asks []mboOrder) {
+	b, a := BuildOrBk(sym)
+	for _, v := range b {
+		bids = append(bids, mboOrder{v.oid, v.price, v.Qty - v.Filled})
+	}
+	for _, v := range a {
+		asks = append(asks, mboOrder{v.oid, v.price, v.Qty - v.Filled})
+	}
+	return
+}
+
+func TestMboFeed(t *testing.T) {
+	instr := "cu1912"
+	defer MboUnsubscribeAll()
+	cleanupOrderBook(instr)
+	MarketStart(false)
+	book := mboBook{seq: mboSeqs[instr]}
+	var execs []MboUpdate
+	MboSubscribe(func(mbo *MboUpdate) {
+		if mbo.Symbol != instr {
+			return
+		}
+		book.apply(t, mbo)
+		if mbo.Action == MboExecuted {
+			execs = append(execs, *mbo)
+		}
+	})
+	var oids []int
+	for _, or := range orders1 {
+		oids = append(oids, SendOrder(instr, or.bBuy, or.qty, or.prc))
+	}
+	if err := ReduceOrder(oids[6], 12); err != nil {
+		t.Error("ReduceOrder", err)
+	}
+	if err := ReduceOrder(oids[6], 20); err == nil {
+		t.Error("ReduceOrder increase qty should fail")
+	}
+	if err := CancelOrder(oids[2]); err != nil {
+		t.Error("CancelOrder", err)
+	}
+	bids, asks := engineMboOrders(instr)
+	if !reflect.DeepEqual(book.bids, bids) {
+		t.Errorf("mbo bids %v, want %v", book.bids, bids)
+	}
+	if !reflect.DeepEqual(book.asks, asks) {
+		t.Errorf("mbo asks %v, want %v", book.asks, asks)
+	}
+	// resting side of deals1, same trade no for each pair of deals
+	if len(execs) != len(deals1)/2 {
+		t.Fatalf("executed %d, want %d", len(execs), len(deals1)/2)
+	}
+	for i, ex := range execs {
+		dd := deals1[i*2]
+		if ex.Oid != oids[dd.oid-1] || ex.ExecPrice != dd.price || ex.Volume != dd.vol {
+			t.Errorf("executed %d: %+v, want %+v", i, ex, dd)
+		}
+		if i > 0 && ex.TradeNo != execs[i-1].TradeNo+1 {
+			t.Errorf("executed %d trade no %d not in sequence", i, ex.TradeNo)
+		}
+	}
+	// auction uncross executions in priority
+	MarketStop()
+	simState = StatePreAuction
+	SendOrder(instr, true, 10, 47000)
+	SendOrder(instr, false, 10, 41000)
+	last, vol, _ := MatchCross(instr, 0)
+	MatchOrder(instr, true, last, vol)
+	MatchOrder(instr, false, last, vol)
+	bids, asks = engineMboOrders(instr)
+	if !reflect.DeepEqual(book.bids, bids) || !reflect.DeepEqual(book.asks, asks) {
+		t.Errorf("mbo book %v/%v, want %v/%v", book.bids, book.asks, bids, asks)
+	}
+	cleanupOrderBook(instr)
+	if len(book.bids) != 0 || len(book.asks) != 0 {
+		t.Errorf("mbo book not empty after cleanup: %v/%v", book.bids, book.asks)
+	}
+	simState = StateStop
+}
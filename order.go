@@ -10,6 +10,11 @@ type simOrderType struct {
 	Qty         int
 	Filled      int
 	PriceFilled int
+	// time priority, renewed when pegged order repriced
+	seq int
+	// participant of order, empty for anonymous order
+	Owner
+	OrderOpts
 }
 
 func (or *simOrderType) Dir() string {
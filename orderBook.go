@@ -1,13 +1,17 @@
 package auction
 
 type orderBook struct {
+	sym          string
 	bids, asks   *Tree
 	bidIt, askIt *Iterator
+	// open volume per price level, for market data feed
+	bidLevels map[int]int
+	askLevels map[int]int
 }
 
 func bidCompare(a, b *simOrderType) int {
 	if a.price == b.price {
-		return a.oid - b.oid
+		return a.seq - b.seq
 	}
 	if a.price == 0 {
 		return -1
@@ -21,7 +25,7 @@ func bidCompare(a, b *simOrderType) int {
 
 func askCompare(a, b *simOrderType) int {
 	if a.price == b.price {
-		return a.oid - b.oid
+		return a.seq - b.seq
 	}
 	// high price, low priority
 	return int(a.price) - int(b.price)
@@ -45,9 +49,30 @@ func (orBook *orderBook) insert(or *simOrderType) {
 	} else {
 		orBook.asks.Insert(or)
 	}
+	orBook.updateLevel(or.bBuy, or.price, or.Qty-or.Filled)
+	orBook.publishMbo(MboAdd, or, or.Qty-or.Filled)
 }
 
-func (orBook *orderBook) delete(or *simOrderType) {
+// delete remove order from orderBook, return removed order or nil
+// order in orderBook may be a copy, use it for open volume
+func (orBook *orderBook) delete(or *simOrderType) *simOrderType {
+	tree := orBook.asks
+	if or.bBuy {
+		tree = orBook.bids
+	}
+	v := tree.Find(or)
+	if v == nil {
+		return nil
+	}
+	orBook.updateLevel(v.bBuy, v.price, v.Filled-v.Qty)
+	orBook.publishMbo(MboDeleted, v, v.Qty-v.Filled)
+	res := *v
+	tree.Delete(v)
+	return &res
+}
+
+// remove executed order from orderBook, nothing published
+func (orBook *orderBook) remove(or *simOrderType) {
 	if or.bBuy {
 		orBook.bids.Delete(or)
 	} else {
@@ -55,6 +80,73 @@ func (orBook *orderBook) delete(or *simOrderType) {
 	}
 }
 
+// find return order in orderBook with same key
+func (orBook *orderBook) find(or *simOrderType) *simOrderType {
+	if or.bBuy {
+		return orBook.bids.Find(or)
+	}
+	return orBook.asks.Find(or)
+}
+
+// fill account executed volume of resting order, Filled already updated
+func (orBook *orderBook) fill(or *simOrderType, price, vol, tradeNo int) {
+	orBook.updateLevel(or.bBuy, or.price, -vol)
+	mbo := MboUpdate{Symbol: orBook.sym, Action: MboExecuted, Oid: or.oid,
+		IsBuy: or.bBuy, Price: or.price, Volume: vol, ExecPrice: price,
+		TradeNo: tradeNo}
+	mboPublish(&mbo)
+}
+
+// reduce lower order quantity to qty and keep priority, return order
+// in orderBook or nil
+func (orBook *orderBook) reduce(or *simOrderType, qty int) *simOrderType {
+	v := orBook.find(or)
+	if v == nil || qty >= v.Qty || qty <= v.Filled {
+		return nil
+	}
+	vol := v.Qty - qty
+	v.Qty = qty
+	orBook.updateLevel(v.bBuy, v.price, -vol)
+	orBook.publishMbo(MboReduced, v, vol)
+	return v
+}
+
+// clear remove all orders, publish deletes
+func (orBook *orderBook) clear() {
+	for _, isBuy := range []bool{true, false} {
+		for v := orBook.First(isBuy); v != nil; v = orBook.Get(isBuy) {
+			orBook.RemoveFirst(isBuy)
+		}
+	}
+}
+
+// updateLevel add delta volume to price level, publish level change
+func (orBook *orderBook) updateLevel(isBuy bool, price, delta int) {
+	if delta == 0 {
+		return
+	}
+	levels := orBook.askLevels
+	if isBuy {
+		levels = orBook.bidLevels
+	}
+	old := levels[price]
+	vol := old + delta
+	md := MdUpdate{Symbol: orBook.sym, IsBuy: isBuy, Price: price, Volume: vol}
+	switch {
+	case vol <= 0:
+		delete(levels, price)
+		md.Action = MdDeleteLevel
+		md.Volume = 0
+	case old == 0:
+		levels[price] = vol
+		md.Action = MdNewLevel
+	default:
+		levels[price] = vol
+		md.Action = MdChangeLevel
+	}
+	mdPublish(&md)
+}
+
 func (orB *orderBook) First(isBuy bool) *simOrderType {
 	if isBuy {
 		return orB.getBestBid()
@@ -63,6 +155,11 @@ func (orB *orderBook) First(isBuy bool) *simOrderType {
 }
 
 func (orB *orderBook) RemoveFirst(isBuy bool) {
+	// executed to zero imply removed, delete only published for open volume
+	if v := orB.Get(isBuy); v != nil && v.Qty > v.Filled {
+		orB.updateLevel(isBuy, v.price, v.Filled-v.Qty)
+		orB.publishMbo(MboDeleted, v, v.Qty-v.Filled)
+	}
 	if isBuy {
 		orB.bidIt.RemoveFirst()
 	} else {
@@ -147,11 +244,18 @@ func (orB *orderBook) curAsk() *simOrderType {
 	return nil
 }
 
-func NewOrderBook() *orderBook {
+func NewOrderBook(sym string) *orderBook {
 	var orBook orderBook
-	orBook.bids = NewTree(bidCompare)
+	orBook.sym = sym
+	if _, ok := spreads[sym]; ok {
+		orBook.bids = NewTree(spreadBidCompare)
+	} else {
+		orBook.bids = NewTree(bidCompare)
+	}
 	orBook.asks = NewTree(askCompare)
 	orBook.bidIt = nil
 	orBook.askIt = nil
+	orBook.bidLevels = map[int]int{}
+	orBook.askLevels = map[int]int{}
 	return &orBook
 }
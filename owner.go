@@ -0,0 +1,97 @@
+package auction
+
+import (
+	"errors"
+)
+
+var (
+	errClOrdID    = errors.New("account and ClOrdID required")
+	errDupClOrdID = errors.New("duplicate ClOrdID")
+	errNotOwner   = errors.New("order not owned by account")
+)
+
+// Owner identify participant of an order, ClOrdID is unique per account
+// within a session, orders of same account or StpGroup never match
+type Owner struct {
+	Account  string
+	Trader   string
+	ClOrdID  string
+	StpGroup string
+}
+
+type clOrdKey struct {
+	account string
+	clOrdID string
+}
+
+// oid of (account, ClOrdID), reset with order numbers by MarketStart
+var clOrdIDs = map[clOrdKey]int{}
+
+// SendOrderOwner send order of ow, return oid zero with nil error if
+// rejected by trading state, error if symbol halted or rejected by risk
+// checks
+func SendOrderOwner(ow Owner, sym string, bBuy bool, qty, prc int) (int, error) {
+	return SendOrderOpts(&ow, sym, bBuy, qty, prc, OrderOpts{})
+}
+
+// LookupOrder return oid of order with ClOrdID of account, ClOrdID of a
+// replaced order still refer to the order replaced
+func LookupOrder(account, clOrdID string) (int, bool) {
+	oid, ok := clOrdIDs[clOrdKey{account, clOrdID}]
+	return oid, ok
+}
+
+// OrderOwner return owner of order oid
+func OrderOwner(oid int) (Owner, error) {
+	if oid <= 0 || oid > orderNo {
+		return Owner{}, errNoOrder
+	}
+	return simOrders[oid-1].Owner, nil
+}
+
+func checkOwner(account string, oid int) error {
+	ow, err := OrderOwner(oid)
+	if err != nil {
+		return err
+	}
+	if ow.Account != account {
+		return errNotOwner
+	}
+	return nil
+}
+
+// CancelOrderOwner cancel order oid of account
+func CancelOrderOwner(account string, oid int) error {
+	if err := checkOwner(account, oid); err != nil {
+		return err
+	}
+	return CancelOrder(oid)
+}
+
+// ReduceOrderOwner lower quantity of order oid of account, as ReduceOrder
+func ReduceOrderOwner(account string, oid, qty int) error {
+	if err := checkOwner(account, oid); err != nil {
+		return err
+	}
+	return ReduceOrder(oid, qty)
+}
+
+// ReplaceOrderOwner amend order oid of account as ReplaceOrder, clOrdID
+// identify the order after replace
+func ReplaceOrderOwner(account string, oid int, clOrdID string, qty, price int) (int, error) {
+	if err := checkOwner(account, oid); err != nil {
+		return 0, err
+	}
+	if clOrdID == "" {
+		return 0, errClOrdID
+	}
+	key := clOrdKey{account, clOrdID}
+	if _, ok := clOrdIDs[key]; ok {
+		return 0, errDupClOrdID
+	}
+	newOid, err := replaceOrder(oid, qty, price, clOrdID)
+	if err == nil && newOid != 0 {
+		clOrdIDs[key] = newOid
+	}
+	return newOid, err
+}
@@ -0,0 +1,87 @@
+package auction
+
+import (
+	"testing"
+)
+
+func TestOrderOwner(t *testing.T) {
+	instr := "cu1912"
+	defer ExecUnsubscribeAll()
+	cleanupOrderBook(instr)
+	MarketStart(false)
+	var ers []ExecReport
+	ExecSubscribe(func(er *ExecReport) {
+		ers = append(ers, *er)
+	})
+	ow := Owner{Account: "ACC1", Trader: "T1", ClOrdID: "c1"}
+	oid, err := SendOrderOwner(ow, instr, true, 10, 42000)
+	if err != nil || oid == 0 {
+		t.Fatal("SendOrderOwner", oid, err)
+	}
+	if len(ers) != 1 || ers[0].Owner != ow {
+		t.Errorf("exec report owner %+v", ers)
+	}
+	if _, err := SendOrderOwner(ow, instr, true, 1, 42000); err != errDupClOrdID {
+		t.Errorf("duplicate ClOrdID error %v", err)
+	}
+	// same ClOrdID of other account accepted
+	ow2 := Owner{Account: "ACC2", ClOrdID: "c1"}
+	oid2, err := SendOrderOwner(ow2, instr, true, 5, 41000)
+	if err != nil || oid2 == 0 {
+		t.Error("SendOrderOwner ACC2", err)
+	}
+	if _, err := SendOrderOwner(Owner{Account: "ACC1"}, instr, true, 1, 1); err != errClOrdID {
+		t.Errorf("missing ClOrdID error %v", err)
+	}
+	if v, ok := LookupOrder("ACC1", "c1"); !ok || v != oid {
+		t.Errorf("LookupOrder ACC1 c1: %d %v, want %d", v, ok, oid)
+	}
+	if v, ok := LookupOrder("ACC2", "c1"); !ok || v != oid2 {
+		t.Errorf("LookupOrder ACC2 c1: %d %v, want %d", v, ok, oid2)
+	}
+	// ownership checked on cancel and amend
+	if err := CancelOrderOwner("ACC2", oid); err != errNotOwner {
+		t.Errorf("cancel of other account %v", err)
+	}
+	if _, err := ReplaceOrderOwner("ACC2", oid, "c2", 8, 42000); err != errNotOwner {
+		t.Errorf("replace of other account %v", err)
+	}
+	if err := ReduceOrderOwner("ACC2", oid, 8); err != errNotOwner {
+		t.Errorf("reduce of other account %v", err)
+	}
+	// reduce in place keep oid, new ClOrdID refer to it
+	ers = nil
+	if v, err := ReplaceOrderOwner("ACC1", oid, "c2", 8, 42000); err != nil || v != oid {
+		t.Errorf("ReplaceOrderOwner %d %v, want %d", v, err, oid)
+	}
+	if len(ers) != 1 || ers[0].ClOrdID != "c2" || ers[0].Account != "ACC1" {
+		t.Errorf("reduce exec reports %+v", ers)
+	}
+	if _, err := ReplaceOrderOwner("ACC1", oid, "c2", 7, 42000); err != errDupClOrdID {
+		t.Errorf("replace with used ClOrdID %v", err)
+	}
+	// price change, new oid with owner of original order
+	ers = nil
+	newOid, err := ReplaceOrderOwner("ACC1", oid, "c3", 8, 42100)
+	if err != nil || newOid == oid {
+		t.Errorf("ReplaceOrderOwner %d %v", newOid, err)
+	}
+	want := Owner{Account: "ACC1", Trader: "T1", ClOrdID: "c3"}
+	if len(ers) != 1 || ers[0].Owner != want || ers[0].OrigOid != oid {
+		t.Errorf("replace exec reports %+v", ers)
+	}
+	if v, ok := LookupOrder("ACC1", "c3"); !ok || v != newOid {
+		t.Errorf("LookupOrder c3 %d %v, want %d", v, ok, newOid)
+	}
+	if ow, err := OrderOwner(newOid); err != nil || ow != want {
+		t.Errorf("OrderOwner %+v %v", ow, err)
+	}
+	if err := CancelOrderOwner("ACC1", newOid); err != nil {
+		t.Error("CancelOrderOwner", err)
+	}
+	// anonymous order has no owner
+	if _, err := OrderOwner(SendOrder(instr, false, 1, 45000)); err != nil {
+		t.Error("OrderOwner anonymous", err)
+	}
+	MarketStop()
+}
@@ -0,0 +1,125 @@
+package auction
+
+import (
+	"errors"
+)
+
+// peg types, price follow best non pegged price of orderBook
+// primary peg same side, market peg opposite side, midpoint mid of BBO
+const (
+	PegPrimary = iota + 1
+	PegMidpoint
+	PegMarket
+)
+
+var errPegPrice = errors.New("no reference price for pegged order")
+
+// pegged oids by symbol, orders left orderBook dropped while repricing
+var pegOrders = map[string][]int{}
+
+// bestNonPeg return best price of side not from pegged orders, zero if
+// none
+func bestNonPeg(orB *orderBook, isBuy bool) (price int) {
+	orB.walk(isBuy, func(v *simOrderType) bool {
+		if v.Peg == 0 {
+			price = v.price
+			return false
+		}
+		return true
+	})
+	return price
+}
+
+// pegPrice return price of pegged order, PegOffset more aggressive if
+// positive, rounded to tick away from market and capped by PegLimit
+func pegPrice(sym string, isBuy bool, opts *OrderOpts) (int, bool) {
+	orB, ok := simOrderBook[sym]
+	if !ok {
+		return 0, false
+	}
+	var ref int
+	switch opts.Peg {
+	case PegPrimary:
+		ref = bestNonPeg(orB, isBuy)
+	case PegMarket:
+		ref = bestNonPeg(orB, !isBuy)
+	case PegMidpoint:
+		bid, ask := bestNonPeg(orB, true), bestNonPeg(orB, false)
+		if bid == 0 || ask == 0 {
+			return 0, false
+		}
+		ref = (bid + ask) / 2
+		if !isBuy {
+			ref = (bid + ask + 1) / 2
+		}
+	}
+	if ref == 0 {
+		return 0, false
+	}
+	tick := TickSize(sym)
+	prc := ref - opts.PegOffset
+	if isBuy {
+		prc = ref + opts.PegOffset
+		prc -= prc % tick
+		if opts.PegLimit > 0 && prc > opts.PegLimit {
+			prc = opts.PegLimit
+		}
+	} else {
+		if r := prc % tick; r != 0 {
+			prc += tick - r
+		}
+		if opts.PegLimit > 0 && prc < opts.PegLimit {
+			prc = opts.PegLimit
+		}
+	}
+	if prc <= 0 {
+		return 0, false
+	}
+	return prc, true
+}
+
+// repegOrders reprice pegged orders of sym after orderBook changed,
+// order lose time priority only if price moved. Reference price ignore
+// pegged orders, so all moved orders leave orderBook before any re-enter
+// and no trade between stale prices, repeat until stable as re-entered
+// orders may trade and move BBO
+func repegOrders(sym string) {
+	oids := pegOrders[sym]
+	if len(oids) == 0 {
+		return
+	}
+	orB := simOrderBook[sym]
+	for pass := 0; pass <= len(oids); pass++ {
+		var moved []*simOrderType
+		live := oids[:0]
+		for _, oid := range oids {
+			or := simOrders[oid-1]
+			v := orB.find(or)
+			if v == nil {
+				continue
+			}
+			live = append(live, oid)
+			prc, ok := pegPrice(sym, or.bBuy, &or.OrderOpts)
+			if !ok || prc == v.price {
+				continue
+			}
+			v = orB.delete(v)
+			seqNo++
+			v.price, or.price = prc, prc
+			v.seq, or.seq = seqNo, seqNo
+			moved = append(moved, v)
+		}
+		oids = live
+		if len(moved) == 0 {
+			break
+		}
+		for _, v := range moved {
+			execPublish(ExecReplaced, v, v.oid)
+			if SymbolState(sym) == StateTrading && tryMatchOrderBook(v) {
+				continue
+			}
+			orB.insert(v)
+		}
+	}
+	pegOrders[sym] = oids
+}
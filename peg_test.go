@@ -0,0 +1,123 @@
+package auction
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPeggedOrders(t *testing.T) {
+	instr := "cu1912"
+	defer ExecUnsubscribeAll()
+	cleanupOrderBook(instr)
+	cleanupOrderBook("cu1911")
+	MarketStart(false)
+	repriced := map[int]int{}
+	ExecSubscribe(func(er *ExecReport) {
+		if er.ExecType == ExecReplaced && er.OrigOid == er.Oid {
+			repriced[er.Oid]++
+		}
+	})
+	if _, err := SendOrderOpts(nil, "cu1911", false, 1, 0,
+		OrderOpts{Peg: PegPrimary}); err != errPegPrice {
+		t.Error("pegged order without reference price", err)
+	}
+	b1 := SendOrder(instr, true, 1, 100)
+	SendOrder(instr, false, 1, 111)
+	peg := func(bBuy bool, qty, limit int, opts OrderOpts) int {
+		t.Helper()
+		oid, err := SendOrderOpts(nil, instr, bBuy, qty, limit, opts)
+		if err != nil || oid == 0 {
+			t.Fatal("SendOrderOpts", err)
+		}
+		return oid
+	}
+	price := func(oid int) int {
+		return simOrders[oid-1].price
+	}
+	p1 := peg(true, 1, 0, OrderOpts{Peg: PegPrimary})
+	p2 := peg(false, 1, 0, OrderOpts{Peg: PegMarket, PegOffset: -6})
+	p3 := peg(true, 1, 0, OrderOpts{Peg: PegMidpoint})
+	p4 := peg(true, 1, 103, OrderOpts{Peg: PegPrimary, PegOffset: 5})
+	if price(p1) != 100 || price(p2) != 106 || price(p3) != 105 || price(p4) != 103 {
+		t.Errorf("pegged prices %d/%d/%d/%d", price(p1), price(p2), price(p3),
+			price(p4))
+	}
+
+	// better bid move pegs, capped peg keep price and priority
+	b2 := SendOrder(instr, true, 1, 101)
+	if price(p1) != 101 || price(p2) != 107 || price(p3) != 106 || price(p4) != 103 {
+		t.Errorf("repegged prices %d/%d/%d/%d", price(p1), price(p2), price(p3),
+			price(p4))
+	}
+	if repriced[p1] != 1 || repriced[p4] != 0 {
+		t.Errorf("repriced %v", repriced)
+	}
+
+	// repriced p1 queue behind b2 at 101, back to 100 after b2 filled
+	SendOrder(instr, false, 3, 101)
+	if openVol(instr, p3) != 0 || openVol(instr, p4) != 0 || openVol(instr, b2) != 0 {
+		t.Error("pegged orders not filled by price time priority")
+	}
+	if openVol(instr, p1) != 1 || price(p1) != 100 || price(p2) != 106 {
+		t.Errorf("after fill p1 %d at %d, p2 at %d", openVol(instr, p1), price(p1),
+			price(p2))
+	}
+
+	// cancel of reference order
+	CancelOrder(b1)
+	if price(p1) != 100 || repriced[p1] != 2 {
+		t.Errorf("p1 at %d without reference, repriced %d", price(p1), repriced[p1])
+	}
+	if len(pegOrders[instr]) != 2 {
+		t.Errorf("pegged oids %v", pegOrders[instr])
+	}
+	MarketStop()
+}
+
+func TestRepegFeeds(t *testing.T) {
+	instr := "cu1913"
+	cleanupOrderBook(instr)
+	MarketStart(false)
+	itch := NewItchBook()
+	feed := NewItchFeed(func(seq uint64, msg []byte) {
+		if err := itch.Apply(seq, msg); err != nil {
+			t.Errorf("Apply seq %d: %v", seq, err)
+		}
+	})
+	mbo := mboBook{seq: mboSeqs[instr]}
+	MboSubscribe(func(m *MboUpdate) {
+		if m.Symbol == instr {
+			mbo.apply(t, m)
+		}
+	})
+	defer func() {
+		feed.Stop()
+		MboUnsubscribeAll()
+		MdUnsubscribeAll()
+		StateUnsubscribeAll()
+	}()
+	SendOrder(instr, true, 1, 100)
+	SendOrder(instr, false, 1, 111)
+	p1, err := SendOrderOpts(nil, instr, true, 1, 0, OrderOpts{Peg: PegPrimary})
+	if err != nil || p1 == 0 {
+		t.Fatal("SendOrderOpts", err)
+	}
+	// p1 repriced to 101 behind b2, older oid but later priority than b2
+	b2 := SendOrder(instr, true, 1, 101)
+	b3 := SendOrder(instr, true, 1, 101)
+	bids, _ := BuildOrBk(instr)
+	if len(bids) < 3 || bids[0].oid != b2 || bids[1].oid != p1 || bids[2].oid != b3 {
+		t.Fatalf("bids not in time priority %v", bids)
+	}
+	if err := verifySimOrderBook(instr); err != nil {
+		t.Error("verifySimOrderBook", err)
+	}
+	if err := itch.Verify(instr); err != nil {
+		t.Error("ITCH replica", err)
+	}
+	ebids, easks := engineMboOrders(instr)
+	if !reflect.DeepEqual(mbo.bids, ebids) || !reflect.DeepEqual(mbo.asks, easks) {
+		t.Errorf("MBO replica %v/%v, want %v/%v", mbo.bids, mbo.asks, ebids, easks)
+	}
+	MarketStop()
+}
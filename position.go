@@ -0,0 +1,149 @@
+package auction
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// Position is net position of account in symbol, updated on every fill
+// Cost is open price times qty of net position, AvgPrice is Cost per qty
+// Unrealized is marked to LastPrice, AvgPrice if symbol not traded
+type Position struct {
+	Account    string
+	Symbol     string
+	Net        int
+	Cost       int
+	AvgPrice   int
+	LastPrice  int
+	Realized   int
+	Unrealized int
+	BuyQty     int
+	SellQty    int
+}
+
+func (acc *accountState) position(sym string) *Position {
+	pos, ok := acc.positions[sym]
+	if !ok {
+		pos = &Position{Account: acc.account, Symbol: sym}
+		acc.positions[sym] = pos
+	}
+	return pos
+}
+
+// fill update position with executed volume, open cost of closed volume
+// pro rata of net position
+func (pos *Position) fill(isBuy bool, price, qty int) {
+	sign := 1
+	if isBuy {
+		pos.BuyQty += qty
+	} else {
+		pos.SellQty += qty
+		sign = -1
+	}
+	if pos.Net*sign < 0 {
+		closed := qty
+		if closed > abs(pos.Net) {
+			closed = abs(pos.Net)
+		}
+		cost := pos.Cost * closed / abs(pos.Net)
+		// long closed by sell, short closed by buy
+		pos.Realized -= sign * (price*closed - cost)
+		pos.Cost -= cost
+		pos.Net += sign * closed
+		qty -= closed
+	}
+	pos.Cost += price * qty
+	pos.Net += sign * qty
+}
+
+// mark return copy of position marked to last trade price
+func (pos *Position) mark() Position {
+	res := *pos
+	if res.Net == 0 {
+		res.AvgPrice = 0
+	} else {
+		res.AvgPrice = res.Cost / abs(res.Net)
+	}
+	tk, _ := GetTicker(res.Symbol)
+	res.LastPrice = tk.LastPrice
+	if res.LastPrice == 0 {
+		res.LastPrice = res.AvgPrice
+	}
+	if res.Net > 0 {
+		res.Unrealized = res.LastPrice*res.Net - res.Cost
+	} else if res.Net < 0 {
+		res.Unrealized = res.Cost + res.LastPrice*res.Net
+	}
+	return res
+}
+
+// GetPosition return position of account in sym marked to last price
+func GetPosition(account, sym string) (Position, bool) {
+	if acc, ok := accounts[account]; ok {
+		if pos, ok := acc.positions[sym]; ok {
+			return pos.mark(), true
+		}
+	}
+	return Position{Account: account, Symbol: sym}, false
+}
+
+// Positions return positions of account ordered by symbol, positions of
+// all accounts if account empty
+func Positions(account string) []Position {
+	var res []Position
+	for name, acc := range accounts {
+		if account != "" && name != account {
+			continue
+		}
+		for _, pos := range acc.positions {
+			res = append(res, pos.mark())
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Account != res[j].Account {
+			return res[i].Account < res[j].Account
+		}
+		return res[i].Symbol < res[j].Symbol
+	})
+	return res
+}
+
+// ResetPositions start new trading day, realized P&L, traded volume and
+// fees cleared, open positions carried at cost
+func ResetPositions() {
+	for _, acc := range accounts {
+		acc.fees, acc.volume = 0, 0
+		for sym, pos := range acc.positions {
+			if pos.Net == 0 {
+				delete(acc.positions, sym)
+				continue
+			}
+			pos.Realized, pos.BuyQty, pos.SellQty = 0, 0, 0
+		}
+	}
+}
+
+var positionHeader = []string{"account", "symbol", "net", "avgPrice",
+	"lastPrice", "realized", "unrealized", "buyQty", "sellQty"}
+
+// WritePositionReport write end of day CSV of all positions
+func WritePositionReport(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(positionHeader); err != nil {
+		return err
+	}
+	for _, pos := range Positions("") {
+		rec := []string{pos.Account, pos.Symbol}
+		for _, v := range []int{pos.Net, pos.AvgPrice, pos.LastPrice,
+			pos.Realized, pos.Unrealized, pos.BuyQty, pos.SellQty} {
+			rec = append(rec, strconv.Itoa(v))
+		}
+		if err := cw.Write(rec); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,78 @@
+package auction
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestPosition(t *testing.T) {
+	instr := "cu1912"
+	cleanupOrderBook(instr)
+	MarketStart(false)
+	ow := func(id string) Owner {
+		return Owner{Account: "POS1", ClOrdID: id}
+	}
+	sendOwner(t, ow("p1"), instr, true, 10, 100)
+	SendOrder(instr, false, 10, 100)
+	SendOrder(instr, true, 4, 110)
+	sendOwner(t, ow("p2"), instr, false, 4, 110)
+	// close long 6, open short 4 at 120
+	SendOrder(instr, true, 10, 120)
+	sendOwner(t, ow("p3"), instr, false, 10, 120)
+	pos, ok := GetPosition("POS1", instr)
+	want := Position{Account: "POS1", Symbol: instr, Net: -4, Cost: 480,
+		AvgPrice: 120, LastPrice: 120, Realized: 160, BuyQty: 10, SellQty: 14}
+	if !ok || pos != want {
+		t.Errorf("position %+v, want %+v", pos, want)
+	}
+	// marked to last trade of other participants
+	SendOrder(instr, true, 1, 115)
+	SendOrder(instr, false, 1, 115)
+	if pos, _ = GetPosition("POS1", instr); pos.LastPrice != 115 || pos.Unrealized != 20 {
+		t.Errorf("unrealized %d at %d, want 20", pos.Unrealized, pos.LastPrice)
+	}
+	if _, ok := GetPosition("POS1", "cu1911"); ok {
+		t.Error("position of symbol not traded")
+	}
+
+	// auction uncross fills update positions
+	simState = StatePreAuction
+	sendOwner(t, Owner{Account: "POS2", ClOrdID: "a1"}, instr, true, 5, 130)
+	SendOrder(instr, false, 5, 125)
+	if _, vol, _ := Uncross(instr, 100); vol != 5 {
+		t.Errorf("Uncross volume %d", vol)
+	}
+	pos, _ = GetPosition("POS2", instr)
+	if pos.Net != 5 || pos.AvgPrice != pos.LastPrice || pos.Unrealized != 0 {
+		t.Errorf("auction position %+v", pos)
+	}
+	ps := Positions("")
+	if len(ps) < 2 || ps[0].Account > ps[1].Account {
+		t.Errorf("Positions %+v", ps)
+	}
+	var buf bytes.Buffer
+	if err := WritePositionReport(&buf); err != nil {
+		t.Fatal("WritePositionReport", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != len(ps)+1 || !strings.HasPrefix(lines[0], "account,symbol,net") {
+		t.Errorf("position report\n%s", buf.String())
+	}
+	wantLine := "POS1," + instr + ",-4,120,"
+	found := false
+	for _, l := range lines {
+		if strings.HasPrefix(l, wantLine) && strings.HasSuffix(l, ",160,-20,10,14") {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("report missing %s\n%s", wantLine, buf.String())
+	}
+	ResetPositions()
+	if pos, _ = GetPosition("POS1", instr); pos.Net != -4 || pos.Realized != 0 ||
+		pos.SellQty != 0 {
+		t.Errorf("position after reset %+v", pos)
+	}
+	MarketStop()
+}
@@ -0,0 +1,61 @@
+package auction
+
+// post-only order crossing best opposite price in continuous trading is
+// canceled or repriced one tick away from best opposite price
+const (
+	PostOnlyReject = iota + 1
+	PostOnlyReprice
+)
+
+// tick sizes by symbol, "" for default, 1 if not set
+var tickSizes = map[string]int{}
+
+// SetTickSize set price tick of sym, "" for default, tick zero remove
+func SetTickSize(sym string, tick int) {
+	if tick <= 0 {
+		delete(tickSizes, sym)
+		return
+	}
+	tickSizes[sym] = tick
+}
+
+// TickSize return price tick of sym
+func TickSize(sym string) int {
+	if tick, ok := tickSizes[sym]; ok {
+		return tick
+	}
+	if tick, ok := tickSizes[""]; ok {
+		return tick
+	}
+	return 1
+}
+
+// postOnly check post-only order before matching, return true if order
+// canceled
+func postOnly(orB *orderBook, order *simOrderType) bool {
+	v := orB.First(!order.bBuy)
+	if v == nil {
+		return false
+	}
+	tick := TickSize(order.Symbol)
+	var prc int
+	if order.bBuy {
+		if v.price > order.price {
+			return false
+		}
+		prc = v.price - tick
+	} else {
+		if v.price < order.price {
+			return false
+		}
+		prc = v.price + tick
+	}
+	if order.PostOnly == PostOnlyReject || prc <= 0 {
+		execPublish(ExecCanceled, order, 0)
+		return true
+	}
+	order.price = prc
+	// price changed in place
+	execPublish(ExecReplaced, order, order.oid)
+	return false
+}
@@ -0,0 +1,86 @@
+package auction
+
+import (
+	"testing"
+)
+
+func TestTickSize(t *testing.T) {
+	defer SetTickSize("", 0)
+	defer SetTickSize("cu1912", 0)
+	if tick := TickSize("cu1912"); tick != 1 {
+		t.Errorf("tick %d without tick sizes", tick)
+	}
+	SetTickSize("", 5)
+	SetTickSize("cu1912", 10)
+	if TickSize("cu1912") != 10 || TickSize("cu1911") != 5 {
+		t.Errorf("tick sizes %d/%d", TickSize("cu1912"), TickSize("cu1911"))
+	}
+}
+
+func TestPostOnly(t *testing.T) {
+	instr := "cu1912"
+	defer ExecUnsubscribeAll()
+	defer SetTickSize(instr, 0)
+	cleanupOrderBook(instr)
+	MarketStart(false)
+	SetTickSize(instr, 10)
+	var reports []ExecReport
+	ExecSubscribe(func(er *ExecReport) {
+		reports = append(reports, *er)
+	})
+	SendOrder(instr, true, 2, 42000)
+	SendOrder(instr, false, 2, 42100)
+
+	// not crossing, rest at own price
+	p1, _ := SendOrderOpts(nil, instr, true, 1, 42050,
+		OrderOpts{PostOnly: PostOnlyReject})
+	if openVol(instr, p1) != 1 {
+		t.Error("passive post-only order not in orderBook")
+	}
+	reports = nil
+	p2, _ := SendOrderOpts(nil, instr, true, 1, 42100,
+		OrderOpts{PostOnly: PostOnlyReject})
+	if openVol(instr, p2) != 0 || len(reports) != 2 ||
+		reports[1].ExecType != ExecCanceled {
+		t.Errorf("crossing post-only not rejected %+v", reports)
+	}
+
+	// reprice one tick away from best opposite price
+	reports = nil
+	p3, _ := SendOrderOpts(&Owner{Account: "POST1", ClOrdID: "p3"}, instr, true,
+		3, 42200, OrderOpts{PostOnly: PostOnlyReprice})
+	if len(reports) != 2 || reports[1].ExecType != ExecReplaced ||
+		reports[1].OrigOid != p3 || reports[1].Price != 42090 {
+		t.Errorf("buy reprice reports %+v", reports)
+	}
+	if openVol(instr, p3) != 3 || getBestPrice(instr, true) != 42090 {
+		t.Errorf("repriced buy %d at %d", openVol(instr, p3), getBestPrice(instr, true))
+	}
+	if acc := getAccount("POST1"); acc.buyNotional != 3*42090 {
+		t.Errorf("account buy notional %d", acc.buyNotional)
+	}
+	p4, _ := SendOrderOpts(nil, instr, false, 1, 41000,
+		OrderOpts{PostOnly: PostOnlyReprice})
+	if openVol(instr, p4) != 1 || getBestPrice(instr, false) != 42100 {
+		t.Errorf("repriced sell %d best ask %d", openVol(instr, p4),
+			getBestPrice(instr, false))
+	}
+	if bids, asks := OrderBookLen(instr); bids != 3 || asks != 2 {
+		t.Errorf("orderBook %d/%d", bids, asks)
+	}
+
+	// replaced post-only order keep flag
+	p5, err := ReplaceOrder(p1, 1, 42150)
+	if err != nil || openVol(instr, p5) != 0 {
+		t.Error("replaced post-only order crossed", err)
+	}
+
+	// queued in pre auction without post-only check
+	simState = StatePreAuction
+	p6, _ := SendOrderOpts(nil, instr, true, 1, 42200,
+		OrderOpts{PostOnly: PostOnlyReject})
+	if openVol(instr, p6) != 1 {
+		t.Error("post-only order rejected in pre auction")
+	}
+	MarketStop()
+}
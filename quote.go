@@ -0,0 +1,385 @@
+package auction
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+var (
+	errQuoteEntry = errors.New("quote symbol, quote id, prices or qty invalid")
+	errMMPTripped = errors.New("market maker protection tripped")
+)
+
+// QuoteEntry is two-sided quote of one symbol in MassQuote, zero qty pull
+// side. Spread quote prices may be zero or negative
+type QuoteEntry struct {
+	Symbol   string
+	QuoteID  string
+	BidPrice int
+	BidQty   int
+	AskPrice int
+	AskQty   int
+}
+
+// QuoteAck is orders of accepted quote entry, zero oid for side not quoted
+// or filled on entry
+type QuoteAck struct {
+	Symbol  string
+	QuoteID string
+	BidOid  int
+	AskOid  int
+}
+
+// MMProtection pull all quotes of maker once fill volume or absolute net
+// delta of quote fills within Window reach limit, zero limit not checked
+type MMProtection struct {
+	Window      time.Duration
+	VolumeLimit int
+	DeltaLimit  int
+}
+
+// MMPEvent is protection trip of Account, Pulled is number of quote
+// orders canceled
+type MMPEvent struct {
+	Account string
+	Volume  int
+	Delta   int
+	Pulled  int
+}
+
+type MMPHandler func(ev *MMPEvent)
+
+// mmQuote is current quote of maker in symbol
+type mmQuote struct {
+	quoteID string
+	bidOid  int
+	askOid  int
+}
+
+type mmpFill struct {
+	t     time.Time
+	qty   int
+	delta int
+}
+
+// mmState is quotes and protection state of market maker
+type mmState struct {
+	quotes  map[string]*mmQuote
+	mmp     MMProtection
+	fills   []mmpFill
+	tripped bool
+}
+
+var (
+	mmStates = map[string]*mmState{}
+	// account of open quote orders
+	quoteOids   = map[int]string{}
+	mmpPending  []MMPEvent
+	mmpHandlers []MMPHandler
+)
+
+func getMMState(account string) *mmState {
+	mm, ok := mmStates[account]
+	if !ok {
+		mm = &mmState{quotes: map[string]*mmQuote{}}
+		mmStates[account] = mm
+	}
+	return mm
+}
+
+// MMPSubscribe register handler for market maker protection trips
+func MMPSubscribe(fn MMPHandler) {
+	mmpHandlers = append(mmpHandlers, fn)
+}
+
+func MMPUnsubscribeAll() {
+	mmpHandlers = nil
+}
+
+// SetMMP set market maker protection of account, zero limits disable
+func SetMMP(account string, p MMProtection) {
+	mm := getMMState(account)
+	mm.mmp = p
+	mm.fills = nil
+}
+
+// GetMMP return market maker protection of account
+func GetMMP(account string) MMProtection {
+	if mm, ok := mmStates[account]; ok {
+		return mm.mmp
+	}
+	return MMProtection{}
+}
+
+// ResetMMP accept quotes of account again after protection tripped
+func ResetMMP(account string) {
+	if mm, ok := mmStates[account]; ok {
+		mm.tripped = false
+		mm.fills = nil
+	}
+}
+
+// MMPTripped check quotes of account pulled by protection until ResetMMP
+func MMPTripped(account string) bool {
+	mm, ok := mmStates[account]
+	return ok && mm.tripped
+}
+
+// validQuote check entry prices and quantities, bid below ask
+func validQuote(q *QuoteEntry) bool {
+	if q.Symbol == "" || q.QuoteID == "" || q.BidQty < 0 || q.AskQty < 0 {
+		return false
+	}
+	_, spread := spreads[q.Symbol]
+	if !spread && ((q.BidQty > 0 && q.BidPrice <= 0) ||
+		(q.AskQty > 0 && q.AskPrice <= 0)) {
+		return false
+	}
+	return q.BidQty == 0 || q.AskQty == 0 || q.BidPrice < q.AskPrice
+}
+
+// quoteSide return open quote order oid kept if unchanged, zero if canceled
+func quoteSide(oid, price, qty int) int {
+	if oid == 0 {
+		return 0
+	}
+	or := simOrders[oid-1]
+	if orB, ok := simOrderBook[or.Symbol]; ok {
+		if v := orB.find(or); v != nil && v.price == price && v.Qty-v.Filled == qty {
+			return oid
+		}
+	}
+	removeQuote(oid)
+	return 0
+}
+
+// removeQuote cancel open quote order oid without trading state check,
+// return true if canceled
+func removeQuote(oid int) bool {
+	delete(quoteOids, oid)
+	if oid == 0 {
+		return false
+	}
+	v := simRemoveOrder(simOrders[oid-1])
+	if v == nil {
+		return false
+	}
+	execPublish(ExecCanceled, v, 0)
+	return true
+}
+
+// MassQuote replace quotes of account per symbol, all entries validated
+// and risk checked as one request before any change. Old orders of both
+// sides leave book before new ones enter, side unchanged in price and open
+// volume keep priority. New bid enter before new ask and either may trade
+// on entry, bid below ask so never with each other. Protection tripped by
+// such a fill pull all quotes, remaining sides and entries not entered and
+// acked without orders. Quote orders are day orders of account without
+// ClOrdID
+func MassQuote(account string, entries []QuoteEntry) ([]QuoteAck, error) {
+	if account == "" {
+		return nil, errClOrdID
+	}
+	mm := getMMState(account)
+	if mm.tripped {
+		return nil, errMMPTripped
+	}
+	ow := Owner{Account: account}
+	var ros []RiskOrder
+	for i := range entries {
+		q := &entries[i]
+		if !validQuote(q) {
+			return nil, errQuoteEntry
+		}
+		if err := symbolAccept(q.Symbol); err != nil {
+			return nil, err
+		}
+		old := mm.quotes[q.Symbol]
+		if old == nil {
+			old = &mmQuote{}
+		}
+		ros = append(ros,
+			RiskOrder{Owner: ow, Symbol: q.Symbol, IsBuy: true, Qty: q.BidQty,
+				Price: q.BidPrice, ReplaceOid: old.bidOid},
+			RiskOrder{Owner: ow, Symbol: q.Symbol, IsBuy: false, Qty: q.AskQty,
+				Price: q.AskPrice, ReplaceOid: old.askOid})
+	}
+	if err := checkRisks(ros); err != nil {
+		return nil, err
+	}
+	acks := make([]QuoteAck, len(entries))
+	opts := OrderOpts{Tif: TifDay}
+	for i := range entries {
+		q := &entries[i]
+		acks[i] = QuoteAck{Symbol: q.Symbol, QuoteID: q.QuoteID}
+		if mm.tripped {
+			continue
+		}
+		cur, ok := mm.quotes[q.Symbol]
+		if !ok {
+			cur = &mmQuote{}
+			mm.quotes[q.Symbol] = cur
+		}
+		cur.quoteID = q.QuoteID
+		cur.bidOid = quoteSide(cur.bidOid, q.BidPrice, q.BidQty)
+		cur.askOid = quoteSide(cur.askOid, q.AskPrice, q.AskQty)
+		for _, side := range []struct {
+			oid   *int
+			bBuy  bool
+			price int
+			qty   int
+		}{{&cur.bidOid, true, q.BidPrice, q.BidQty},
+			{&cur.askOid, false, q.AskPrice, q.AskQty}} {
+			if *side.oid != 0 || side.qty == 0 || mm.tripped {
+				continue
+			}
+			oid := sendOrder(q.Symbol, side.bBuy, side.qty, side.price, 0, &ow, &opts)
+			if oid == 0 {
+				continue
+			}
+			// filled on entry not resting quote
+			if or := simOrders[oid-1]; or.Filled < or.Qty {
+				quoteOids[oid] = account
+				*side.oid = oid
+			}
+		}
+		if mm.tripped {
+			// tripped by fills on entry, orders entered after pull as well
+			removeQuote(cur.bidOid)
+			removeQuote(cur.askOid)
+		} else {
+			acks[i].BidOid, acks[i].AskOid = cur.bidOid, cur.askOid
+		}
+		bookChanged(q.Symbol)
+	}
+	return acks, nil
+}
+
+// CancelQuotes pull quotes of account in sym, all symbols if empty, return
+// number of orders canceled. Allowed in any trading state, protection
+// trip may come from auction uncross
+func CancelQuotes(account, sym string) int {
+	mm, ok := mmStates[account]
+	if !ok {
+		return 0
+	}
+	var syms []string
+	for s := range mm.quotes {
+		if sym == "" || s == sym {
+			syms = append(syms, s)
+		}
+	}
+	sort.Strings(syms)
+	n := 0
+	for _, s := range syms {
+		q := mm.quotes[s]
+		for _, oid := range []int{q.bidOid, q.askOid} {
+			if removeQuote(oid) {
+				n++
+			}
+		}
+		delete(mm.quotes, s)
+		bookChanged(s)
+	}
+	return n
+}
+
+// GetQuote return quote id and open bid/ask oid of account in sym
+func GetQuote(account, sym string) (QuoteAck, bool) {
+	mm, ok := mmStates[account]
+	if !ok {
+		return QuoteAck{}, false
+	}
+	q, ok := mm.quotes[sym]
+	if !ok {
+		return QuoteAck{}, false
+	}
+	return QuoteAck{Symbol: sym, QuoteID: q.quoteID, BidOid: q.bidOid,
+		AskOid: q.askOid}, true
+}
+
+// quoteOnExec drop quote order left orderBook by fill, expiry, cancel or
+// replace not through MassQuote
+func quoteOnExec(er *ExecReport) {
+	oid := er.Oid
+	if er.ExecType == ExecReplaced && er.OrigOid != er.Oid {
+		oid = er.OrigOid
+	} else if er.Leaves() > 0 {
+		return
+	}
+	account, ok := quoteOids[oid]
+	if !ok {
+		return
+	}
+	delete(quoteOids, oid)
+	if q, ok := mmStates[account].quotes[er.Symbol]; ok {
+		if q.bidOid == oid {
+			q.bidOid = 0
+		}
+		if q.askOid == oid {
+			q.askOid = 0
+		}
+	}
+}
+
+// mmpOnFill account fill of resting quote order in protection window,
+// tripped maker queued for pull after current match
+func mmpOnFill(oid int, isBuy bool, qty int) {
+	account, ok := quoteOids[oid]
+	if !ok {
+		return
+	}
+	mm := mmStates[account]
+	if mm.tripped || (mm.mmp.VolumeLimit <= 0 && mm.mmp.DeltaLimit <= 0) {
+		return
+	}
+	now := simClock()
+	fills := mm.fills[:0]
+	for _, f := range mm.fills {
+		if now.Sub(f.t) < mm.mmp.Window {
+			fills = append(fills, f)
+		}
+	}
+	delta := qty
+	if !isBuy {
+		delta = -qty
+	}
+	mm.fills = append(fills, mmpFill{t: now, qty: qty, delta: delta})
+	vol, net := 0, 0
+	for _, f := range mm.fills {
+		vol += f.qty
+		net += f.delta
+	}
+	if (mm.mmp.VolumeLimit > 0 && vol >= mm.mmp.VolumeLimit) ||
+		(mm.mmp.DeltaLimit > 0 && abs(net) >= mm.mmp.DeltaLimit) {
+		mm.tripped = true
+		log.Warningf("MMP tripped %s volume %d delta %d", account, vol, net)
+		mmpPending = append(mmpPending, MMPEvent{Account: account, Volume: vol,
+			Delta: net})
+	}
+}
+
+// mmpPull cancel quotes of tripped makers, called after match completed
+// as orderBook can't change while matching
+func mmpPull() {
+	for len(mmpPending) > 0 {
+		ev := mmpPending[0]
+		mmpPending = mmpPending[1:]
+		ev.Pulled = CancelQuotes(ev.Account, "")
+		log.Infof("MMP pulled %d quote orders of %s", ev.Pulled, ev.Account)
+		for _, fn := range mmpHandlers {
+			fn(&ev)
+		}
+	}
+}
+
+// resetQuotes drop quotes of all makers, protection settings kept
+func resetQuotes() {
+	quoteOids = map[int]string{}
+	mmpPending = nil
+	for _, mm := range mmStates {
+		mm.quotes = map[string]*mmQuote{}
+		mm.fills = nil
+	}
+}
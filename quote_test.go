@@ -0,0 +1,143 @@
+package auction
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMassQuote(t *testing.T) {
+	instr := "cu1912"
+	now := time.Date(2019, 8, 1, 10, 0, 0, 0, time.Local)
+	SetClock(func() time.Time { return now })
+	defer SetClock(nil)
+	defer MMPUnsubscribeAll()
+	cleanupOrderBook(instr)
+	MarketStart(false)
+	mm := "MMQ1"
+	quote := func(id string, bid, bidQty, ask, askQty int) QuoteAck {
+		t.Helper()
+		acks, err := MassQuote(mm, []QuoteEntry{{Symbol: instr, QuoteID: id,
+			BidPrice: bid, BidQty: bidQty, AskPrice: ask, AskQty: askQty}})
+		if err != nil || len(acks) != 1 {
+			t.Fatal("MassQuote", err)
+		}
+		return acks[0]
+	}
+	if _, err := MassQuote("", nil); err != errClOrdID {
+		t.Error("MassQuote without account", err)
+	}
+	if _, err := MassQuote(mm, []QuoteEntry{{Symbol: instr, QuoteID: "q0",
+		BidPrice: 50100, BidQty: 1, AskPrice: 50100, AskQty: 1}}); err != errQuoteEntry {
+		t.Error("crossed quote", err)
+	}
+	a1 := quote("q1", 49900, 10, 50100, 10)
+	if a1.BidOid == 0 || a1.AskOid == 0 {
+		t.Fatalf("quote ack %+v", a1)
+	}
+	// unchanged bid keep order and priority
+	a2 := quote("q2", 49900, 10, 50090, 5)
+	if a2.BidOid != a1.BidOid || a2.AskOid == a1.AskOid || openVol(instr, a1.AskOid) != 0 {
+		t.Errorf("replaced quote %+v", a2)
+	}
+	if bids, asks := OrderBookLen(instr); bids != 1 || asks != 1 {
+		t.Errorf("orderBook %d/%d", bids, asks)
+	}
+	if q, _ := GetQuote(mm, instr); q.QuoteID != "q2" {
+		t.Errorf("GetQuote %+v", q)
+	}
+
+	// volume in window pull all quotes
+	var events []MMPEvent
+	MMPSubscribe(func(ev *MMPEvent) {
+		events = append(events, *ev)
+	})
+	SetMMP(mm, MMProtection{Window: time.Second, VolumeLimit: 8})
+	SendOrder(instr, false, 3, 49900)
+	now = now.Add(2 * time.Second)
+	SendOrder(instr, false, 4, 49900)
+	if MMPTripped(mm) {
+		t.Error("MMP tripped by fills out of window")
+	}
+	SendOrder(instr, true, 4, 50090)
+	if !MMPTripped(mm) || len(events) != 1 || events[0].Volume != 8 ||
+		events[0].Pulled != 2 {
+		t.Errorf("MMP events %+v", events)
+	}
+	if bids, asks := OrderBookLen(instr); bids != 0 || asks != 0 {
+		t.Errorf("orderBook after MMP %d/%d", bids, asks)
+	}
+	if _, err := MassQuote(mm, []QuoteEntry{{Symbol: instr, QuoteID: "q3",
+		BidPrice: 49900, BidQty: 1}}); err != errMMPTripped {
+		t.Error("quote after MMP trip", err)
+	}
+
+	// net delta
+	ResetMMP(mm)
+	SetMMP(mm, MMProtection{Window: time.Second, DeltaLimit: 5})
+	quote("q4", 49900, 10, 50100, 10)
+	SendOrder(instr, false, 3, 49900)
+	SendOrder(instr, true, 2, 50100)
+	SendOrder(instr, false, 3, 49900)
+	if MMPTripped(mm) {
+		t.Error("MMP tripped below delta")
+	}
+	SendOrder(instr, false, 1, 49900)
+	if !MMPTripped(mm) || len(events) != 2 || events[1].Delta != 5 {
+		t.Errorf("delta MMP events %+v", events)
+	}
+	ResetMMP(mm)
+	SetMMP(mm, MMProtection{})
+	quote("q5", 49800, 1, 50200, 1)
+	if n := CancelQuotes(mm, instr); n != 2 {
+		t.Errorf("CancelQuotes %d", n)
+	}
+
+	// quote order left orderBook by fill or expiry no longer tracked
+	a6 := quote("q6", 49700, 2, 50300, 1)
+	SendOrder(instr, false, 2, 49700)
+	if _, ok := quoteOids[a6.BidOid]; ok {
+		t.Errorf("filled quote order %d tracked", a6.BidOid)
+	}
+	if q, _ := GetQuote(mm, instr); q.BidOid != 0 || q.AskOid != a6.AskOid {
+		t.Errorf("GetQuote after fill %+v", q)
+	}
+	MarketStop()
+	if len(quoteOids) != 0 {
+		t.Errorf("expired quote orders tracked %v", quoteOids)
+	}
+}
+
+func TestMassQuoteRisk(t *testing.T) {
+	defer ReloadRiskLimits(nil)
+	cleanupOrderBook("cu1920")
+	cleanupOrderBook("cu1921")
+	MarketStart(false)
+	mm := "MMQ2"
+	// each bid within credit limit, both together exceed
+	SetRiskLimits(mm, RiskLimits{CreditLimit: 600000, MaxOpenOrders: 4})
+	entries := []QuoteEntry{
+		{Symbol: "cu1920", QuoteID: "r1", BidPrice: 50000, BidQty: 10,
+			AskPrice: 50100, AskQty: 10},
+		{Symbol: "cu1921", QuoteID: "r1", BidPrice: 50000, BidQty: 10,
+			AskPrice: 50100, AskQty: 10},
+	}
+	_, err := MassQuote(mm, entries)
+	expectRisk(t, err, "credit limit")
+	if bids, asks := OrderBookLen("cu1920"); bids != 0 || asks != 0 {
+		t.Errorf("orderBook %d/%d after rejected mass quote", bids, asks)
+	}
+	// replaced quote orders not counted with new ones
+	entries[1].BidQty = 0
+	if _, err := MassQuote(mm, entries); err != nil {
+		t.Fatal("MassQuote", err)
+	}
+	entries[0].BidQty, entries[1].BidPrice, entries[1].BidQty = 0, 49000, 12
+	if _, err := MassQuote(mm, entries); err != nil {
+		t.Error("MassQuote moving bid to other symbol", err)
+	}
+	if n := len(getAccount(mm).orders); n != 3 {
+		t.Errorf("open quote orders %d, want 3", n)
+	}
+	CancelQuotes(mm, "")
+	MarketStop()
+}
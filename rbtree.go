@@ -40,7 +40,10 @@ func (t *Tree) Len() int {
 }
 
 func (t *Tree) Find(key *simOrderType) *simOrderType {
-	return *t.tree.Find(key)
+	if v := t.tree.Find(key); v != nil {
+		return *v
+	}
+	return nil
 }
 
 func (t *Tree) Delete(key *simOrderType) bool {
@@ -0,0 +1,326 @@
+package auction
+
+import (
+	"errors"
+	"sort"
+)
+
+// RFQ states
+const (
+	RfqOpen = iota + 1
+	RfqDone
+	RfqCanceled
+)
+
+// RFQ events for requester and market makers
+const (
+	RfqEventNew = iota + 1
+	RfqEventQuote
+	RfqEventTrade
+	RfqEventCanceled
+)
+
+var (
+	errRfqRequest = errors.New("rfq account, symbol and qty required")
+	errRfqClosed  = errors.New("rfq not found or closed")
+	errRfqQuote   = errors.New("quote not found or side not quoted")
+	errRfqSelf    = errors.New("requester can't quote own rfq")
+	errRfqOwner   = errors.New("rfq of other requester")
+	errBlockBand  = errors.New("block price outside band of reference price")
+	errBlockLegs  = errors.New("no reference price of spread legs")
+)
+
+// RfqQuote is two sided quote of market maker for full quantity of RFQ,
+// zero price for side not quoted
+type RfqQuote struct {
+	ID       int
+	Account  string
+	BidPrice int
+	AskPrice int
+}
+
+// Rfq is request for quote of Qty without side, requester accept one quote
+// as block trade
+type Rfq struct {
+	ID        int
+	Symbol    string
+	Qty       int
+	Requester string
+	State     int
+	// latest quote of each market maker in arrival order
+	Quotes []RfqQuote
+}
+
+// BlockTrade is negotiated trade of accepted quote, never in orderBook
+type BlockTrade struct {
+	TradeNo int
+	RfqID   int
+	Symbol  string
+	Price   int
+	Qty     int
+	Buyer   string
+	Seller  string
+}
+
+// RfqEvent is RFQ change, Quote of RfqEventQuote, Trade of RfqEventTrade
+type RfqEvent struct {
+	Type  int
+	Rfq   Rfq
+	Quote RfqQuote
+	Trade BlockTrade
+}
+
+type RfqHandler func(ev *RfqEvent)
+
+var (
+	rfqHandlers []RfqHandler
+	rfqs        = map[int]*Rfq{}
+	rfqNo       int
+	rfqQuoteNo  int
+	// block price band in basis points of last price by symbol, "" default
+	blockBands = map[string]int{}
+)
+
+// RfqSubscribe register handler for RFQ events of all symbols
+func RfqSubscribe(fn RfqHandler) {
+	rfqHandlers = append(rfqHandlers, fn)
+}
+
+func RfqUnsubscribeAll() {
+	rfqHandlers = nil
+}
+
+func rfqPublish(ev *RfqEvent) {
+	ev.Rfq.Quotes = append([]RfqQuote{}, ev.Rfq.Quotes...)
+	for _, fn := range rfqHandlers {
+		fn(ev)
+	}
+}
+
+// SetBlockBand set max deviation of block price from last price of sym in
+// basis points, "" for default, zero remove band
+func SetBlockBand(sym string, bps int) {
+	if bps <= 0 {
+		delete(blockBands, sym)
+		return
+	}
+	blockBands[sym] = bps
+}
+
+// checkBlockBand check price against last trade price or BBO mid of sym,
+// block trades themselves don't move last price. Band not checked before
+// sym has reference price
+func checkBlockBand(sym string, price int) error {
+	bps, ok := blockBands[sym]
+	if !ok {
+		if bps, ok = blockBands[""]; !ok {
+			return nil
+		}
+	}
+	ref := riskRefPrice(sym)
+	if ref != 0 && abs(price-ref)*10000 > bps*ref {
+		return errBlockBand
+	}
+	return nil
+}
+
+// blockFill report fill of block trade side to account, requester is
+// taker and quoting market maker is maker for fee
+func blockFill(bt *BlockTrade, account string, isBuy bool, liq int, legs [2]int) {
+	er := ExecReport{ExecType: ExecFill, Symbol: bt.Symbol, IsBuy: isBuy,
+		Price: bt.Price, Qty: bt.Qty, Filled: bt.Qty, LastPrice: bt.Price,
+		LastQty: bt.Qty, TradeNo: bt.TradeNo, Liquidity: liq, LegPrices: legs,
+		Block: true, Owner: Owner{Account: account}}
+	if sp, ok := spreads[bt.Symbol]; ok {
+		er.Fee = tradeFee(account, sp.Front, liq, legs[0], bt.Qty) +
+			tradeFee(account, sp.Back, liq, legs[1], bt.Qty)
+	} else {
+		er.Fee = tradeFee(account, bt.Symbol, liq, bt.Price, bt.Qty)
+	}
+	accountOnExec(&er)
+	for _, fn := range execHandlers {
+		fn(&er)
+	}
+}
+
+// rfqAccount reject account of kill switch
+func rfqAccount(account string) error {
+	if killedAccounts[account] {
+		return &RiskError{Account: account, Reason: "kill switch active"}
+	}
+	return nil
+}
+
+// RequestQuote open RFQ of qty sym for account, return RFQ id
+func RequestQuote(account, sym string, qty int) (int, error) {
+	if account == "" || sym == "" || qty <= 0 {
+		return 0, errRfqRequest
+	}
+	if err := symbolAccept(sym); err != nil {
+		return 0, err
+	}
+	if err := rfqAccount(account); err != nil {
+		return 0, err
+	}
+	rfqNo++
+	rfq := &Rfq{ID: rfqNo, Symbol: sym, Qty: qty, Requester: account,
+		State: RfqOpen}
+	rfqs[rfq.ID] = rfq
+	rfqPublish(&RfqEvent{Type: RfqEventNew, Rfq: *rfq})
+	return rfq.ID, nil
+}
+
+func openRfq(id int) (*Rfq, error) {
+	rfq, ok := rfqs[id]
+	if !ok || rfq.State != RfqOpen {
+		return nil, errRfqClosed
+	}
+	return rfq, nil
+}
+
+// QuoteRfq quote RFQ id by market maker account, replace earlier quote of
+// account, zero price for side not quoted, return quote id
+func QuoteRfq(id int, account string, bid, ask int) (int, error) {
+	rfq, err := openRfq(id)
+	if err != nil {
+		return 0, err
+	}
+	if account == "" || (bid <= 0 && ask <= 0) || (bid > 0 && ask > 0 && bid > ask) {
+		return 0, errRfqQuote
+	}
+	if account == rfq.Requester {
+		return 0, errRfqSelf
+	}
+	if err := rfqAccount(account); err != nil {
+		return 0, err
+	}
+	rfqQuoteNo++
+	q := RfqQuote{ID: rfqQuoteNo, Account: account, BidPrice: bid, AskPrice: ask}
+	quotes := rfq.Quotes[:0]
+	for _, v := range rfq.Quotes {
+		if v.Account != account {
+			quotes = append(quotes, v)
+		}
+	}
+	rfq.Quotes = append(quotes, q)
+	rfqPublish(&RfqEvent{Type: RfqEventQuote, Rfq: *rfq, Quote: q})
+	return q.ID, nil
+}
+
+// AcceptQuote accept quote of RFQ id by requester, buy at AskPrice or sell
+// at BidPrice of quote, risk checks of requester and maker passed. Block
+// trade reported in trade stream and fill
+// reports of both accounts, RFQ closed. Return trade number
+func AcceptQuote(id int, account string, quoteID int, isBuy bool) (int, error) {
+	rfq, err := openRfq(id)
+	if err != nil {
+		return 0, err
+	}
+	if account != rfq.Requester {
+		return 0, errRfqOwner
+	}
+	var q *RfqQuote
+	for i := range rfq.Quotes {
+		if rfq.Quotes[i].ID == quoteID {
+			q = &rfq.Quotes[i]
+		}
+	}
+	price := 0
+	if q != nil {
+		price = q.BidPrice
+		if isBuy {
+			price = q.AskPrice
+		}
+	}
+	if price <= 0 {
+		return 0, errRfqQuote
+	}
+	if err := symbolAccept(rfq.Symbol); err != nil {
+		return 0, err
+	}
+	// both sides risk checked as orders of full quantity at block price
+	for _, ro := range []RiskOrder{
+		{Owner: Owner{Account: rfq.Requester}, Symbol: rfq.Symbol, IsBuy: isBuy,
+			Qty: rfq.Qty, Price: price},
+		{Owner: Owner{Account: q.Account}, Symbol: rfq.Symbol, IsBuy: !isBuy,
+			Qty: rfq.Qty, Price: price},
+	} {
+		if err := checkRisk(&ro); err != nil {
+			return 0, err
+		}
+	}
+	if err := checkBlockBand(rfq.Symbol, price); err != nil {
+		return 0, err
+	}
+	var legs [2]int
+	if sp, ok := spreads[rfq.Symbol]; ok {
+		if legs, ok = spreadLegPrices(sp, price); !ok {
+			return 0, errBlockLegs
+		}
+	}
+	bt := BlockTrade{TradeNo: nextTradeNo(), RfqID: rfq.ID, Symbol: rfq.Symbol,
+		Price: price, Qty: rfq.Qty, Buyer: q.Account, Seller: rfq.Requester}
+	if isBuy {
+		bt.Buyer, bt.Seller = rfq.Requester, q.Account
+	}
+	rfq.State = RfqDone
+	blockFill(&bt, rfq.Requester, isBuy, LiqTaker, legs)
+	blockFill(&bt, q.Account, !isBuy, LiqMaker, legs)
+	log.Infof("Block trade No:%d %s %d@%d %s/%s", bt.TradeNo, bt.Symbol, bt.Qty,
+		price, bt.Buyer, bt.Seller)
+	// requester is aggressor
+	md := MdUpdate{Symbol: bt.Symbol, Action: MdTrade, IsBuy: isBuy, Price: price,
+		Volume: bt.Qty, TradeNo: bt.TradeNo, Block: true}
+	mdPublish(&md)
+	rfqPublish(&RfqEvent{Type: RfqEventTrade, Rfq: *rfq, Quote: *q, Trade: bt})
+	return bt.TradeNo, nil
+}
+
+// CancelRfq close open RFQ id of requester account without trade
+func CancelRfq(id int, account string) error {
+	rfq, err := openRfq(id)
+	if err != nil {
+		return err
+	}
+	if account != rfq.Requester {
+		return errRfqOwner
+	}
+	cancelRfq(rfq)
+	return nil
+}
+
+func cancelRfq(rfq *Rfq) {
+	rfq.State = RfqCanceled
+	rfqPublish(&RfqEvent{Type: RfqEventCanceled, Rfq: *rfq})
+}
+
+// GetRfq return RFQ id with quotes
+func GetRfq(id int) (Rfq, bool) {
+	rfq, ok := rfqs[id]
+	if !ok {
+		return Rfq{}, false
+	}
+	res := *rfq
+	res.Quotes = append([]RfqQuote{}, rfq.Quotes...)
+	return res, true
+}
+
+// OpenRfqs return ids of open RFQs of sym, all symbols if empty
+func OpenRfqs(sym string) []int {
+	var ids []int
+	for id, rfq := range rfqs {
+		if rfq.State == RfqOpen && (sym == "" || rfq.Symbol == sym) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// cancelOpenRfqs cancel all open RFQs at market stop, closed RFQs dropped
+func cancelOpenRfqs() {
+	for _, id := range OpenRfqs("") {
+		cancelRfq(rfqs[id])
+	}
+	rfqs = map[int]*Rfq{}
+}
@@ -0,0 +1,165 @@
+package auction
+
+import (
+	"testing"
+)
+
+func TestRfqBlockTrade(t *testing.T) {
+	instr := "cu1912"
+	defer MdUnsubscribeAll()
+	defer RfqUnsubscribeAll()
+	defer ExecUnsubscribeAll()
+	defer SetBlockBand(instr, 0)
+	defer SetFeeSchedule(instr, nil)
+	cleanupOrderBook(instr)
+	MarketStart(false)
+	SetBlockBand(instr, 500)
+	SetFeeSchedule(instr, &FeeSchedule{Tiers: []FeeTier{
+		{Maker: FeeRate{PerLot: -1}, Taker: FeeRate{PerLot: 2}}}})
+	var fills []ExecReport
+	ExecSubscribe(func(er *ExecReport) {
+		if er.Block {
+			fills = append(fills, *er)
+		}
+	})
+	SendOrder(instr, true, 1, 50000)
+	SendOrder(instr, false, 1, 50000)
+	var events []int
+	RfqSubscribe(func(ev *RfqEvent) {
+		events = append(events, ev.Type)
+	})
+	var blocks []MdUpdate
+	MdSubscribe(func(md *MdUpdate) {
+		if md.Action == MdTrade && md.Block {
+			blocks = append(blocks, *md)
+		}
+	})
+	if _, err := RequestQuote("", instr, 100); err != errRfqRequest {
+		t.Error("RFQ without account", err)
+	}
+	id, err := RequestQuote("RFQR1", instr, 100)
+	if err != nil {
+		t.Fatal("RequestQuote", err)
+	}
+	if _, err := QuoteRfq(id, "RFQR1", 49900, 50100); err != errRfqSelf {
+		t.Error("quote own RFQ", err)
+	}
+	q1, _ := QuoteRfq(id, "RFQM1", 49900, 50100)
+	q2, _ := QuoteRfq(id, "RFQM2", 49950, 50080)
+	// replace quote of RFQM1
+	q3, err := QuoteRfq(id, "RFQM1", 49800, 53000)
+	if err != nil {
+		t.Fatal("QuoteRfq", err)
+	}
+	if rfq, _ := GetRfq(id); len(rfq.Quotes) != 2 || rfq.Quotes[0].ID != q2 {
+		t.Errorf("RFQ quotes %+v", rfq.Quotes)
+	}
+	if _, err := AcceptQuote(id, "RFQR1", q1, true); err != errRfqQuote {
+		t.Error("accept replaced quote", err)
+	}
+	if _, err := AcceptQuote(id, "RFQR1", q3, true); err != errBlockBand {
+		t.Error("accept outside band", err)
+	}
+	if _, err := AcceptQuote(id, "RFQR2", q2, true); err != errRfqOwner {
+		t.Error("accept by other account", err)
+	}
+	// block trade count in volume, not last price nor bars
+	book := NewMdBook(instr)
+	book.Recover()
+	MdSubscribe(func(md *MdUpdate) {
+		if md.Symbol == instr {
+			book.Apply(md)
+		}
+	})
+	var bars []Bar
+	bb := NewVolumeBars(instr, 1, func(bar *Bar) {
+		bars = append(bars, *bar)
+	})
+	defer bb.Stop()
+	tNo, err := AcceptQuote(id, "RFQR1", q2, true)
+	if err != nil || tNo == 0 {
+		t.Fatal("AcceptQuote", err)
+	}
+	if len(blocks) != 1 || blocks[0].Price != 50080 || blocks[0].Volume != 100 ||
+		blocks[0].TradeNo != tNo {
+		t.Errorf("block trades %+v", blocks)
+	}
+	pr, _ := GetPosition("RFQR1", instr)
+	pm, _ := GetPosition("RFQM2", instr)
+	if pr.Net != 100 || pm.Net != -100 {
+		t.Errorf("block positions %d/%d", pr.Net, pm.Net)
+	}
+	if len(fills) != 2 || fills[0].Account != "RFQR1" || !fills[0].IsBuy ||
+		fills[0].Liquidity != LiqTaker || fills[1].Account != "RFQM2" ||
+		fills[1].Liquidity != LiqMaker || fills[1].TradeNo != tNo {
+		t.Errorf("block fills %+v", fills)
+	}
+	if fee, vol := AccountFees("RFQR1"); fee != 200 || vol != 100 {
+		t.Errorf("requester fees %d volume %d", fee, vol)
+	}
+	if fee, _ := AccountFees("RFQM2"); fee != -100 {
+		t.Errorf("maker fees %d", fee)
+	}
+	if tk, _ := GetTicker(instr); tk.LastPrice != 50000 {
+		t.Errorf("last price %d after block trade", tk.LastPrice)
+	}
+	if book.LastPrice != 0 || book.Volume != 100 || len(bars) != 0 {
+		t.Errorf("MdBook last %d volume %d, bars %+v", book.LastPrice, book.Volume,
+			bars)
+	}
+	if bids, asks := OrderBookLen(instr); bids != 0 || asks != 0 {
+		t.Errorf("orderBook %d/%d", bids, asks)
+	}
+	if _, err := AcceptQuote(id, "RFQR1", q2, true); err != errRfqClosed {
+		t.Error("accept closed RFQ", err)
+	}
+
+	// band skipped without reference price
+	cleanupOrderBook("cu1917")
+	SetBlockBand("cu1917", 500)
+	defer SetBlockBand("cu1917", 0)
+	id, _ = RequestQuote("RFQR1", "cu1917", 10)
+	q4, _ := QuoteRfq(id, "RFQM1", 40000, 40100)
+	if _, err := AcceptQuote(id, "RFQR1", q4, false); err != nil {
+		t.Error("accept without reference price", err)
+	}
+
+	// block exceeding position limit of requester or maker rejected
+	defer ReloadRiskLimits(nil)
+	SetRiskLimits("RFQR3", RiskLimits{MaxPosition: 5})
+	SetRiskLimits("RFQM3", RiskLimits{MaxPosition: 5})
+	id, _ = RequestQuote("RFQR3", "cu1917", 10)
+	q5, _ := QuoteRfq(id, "RFQM1", 40000, 40100)
+	if _, err := AcceptQuote(id, "RFQR3", q5, true); err == nil {
+		t.Error("accept over requester position limit")
+	}
+	q6, _ := QuoteRfq(id, "RFQM3", 40000, 40100)
+	SetRiskLimits("RFQR3", RiskLimits{})
+	if _, err := AcceptQuote(id, "RFQR3", q6, true); err == nil {
+		t.Error("accept over maker position limit")
+	}
+	CancelRfq(id, "RFQR3")
+
+	// open RFQs canceled by market stop
+	RequestQuote("RFQR1", instr, 10)
+	if ids := OpenRfqs(instr); len(ids) != 1 {
+		t.Errorf("open RFQs %v", ids)
+	}
+	MarketStop()
+	want := []int{RfqEventNew, RfqEventQuote, RfqEventQuote, RfqEventQuote,
+		RfqEventTrade, RfqEventNew, RfqEventQuote, RfqEventTrade, RfqEventNew,
+		RfqEventQuote, RfqEventQuote, RfqEventCanceled, RfqEventNew,
+		RfqEventCanceled}
+	if len(events) != len(want) {
+		t.Fatalf("RFQ events %v", events)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Errorf("RFQ events %v", events)
+			break
+		}
+	}
+	if ids := OpenRfqs(""); len(ids) != 0 {
+		t.Errorf("open RFQs after stop %v", ids)
+	}
+}
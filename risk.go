@@ -0,0 +1,324 @@
+package auction
+
+import (
+	"fmt"
+)
+
+// RiskLimits of an account, zero field is no limit
+// MaxNotional is price*qty of one order, CreditLimit is open buy notional
+// MaxPosition is absolute position per symbol include open orders of side
+// PriceCollar is max price deviation in basis points from last trade
+// price, or mid of BBO before first trade
+type RiskLimits struct {
+	MaxOrderQty   int
+	MaxNotional   int
+	MaxOpenOrders int
+	CreditLimit   int
+	MaxPosition   int
+	PriceCollar   int
+}
+
+// RiskError is order rejected by pre-trade risk check
+type RiskError struct {
+	Account string
+	Reason  string
+}
+
+func (e *RiskError) Error() string {
+	if e.Account == "" {
+		return "risk reject: " + e.Reason
+	}
+	return "risk reject " + e.Account + ": " + e.Reason
+}
+
+// RiskOrder is order checked before sent to orderBook, Qty is open volume
+// ReplaceOid non zero for order replacing ReplaceOid
+type RiskOrder struct {
+	Owner
+	Symbol     string
+	IsBuy      bool
+	Qty        int
+	Price      int
+	ReplaceOid int
+}
+
+// RiskCheck return error to reject order, called after RiskLimits check
+type RiskCheck func(ro *RiskOrder) error
+
+var riskChecks []RiskCheck
+
+// riskLimits by account, accounts not present not limited
+var riskLimits = map[string]RiskLimits{}
+
+// RiskRegister add check for all orders, anonymous orders as well
+func RiskRegister(fn RiskCheck) {
+	riskChecks = append(riskChecks, fn)
+}
+
+func RiskUnregisterAll() {
+	riskChecks = nil
+}
+
+// SetRiskLimits set limits of account, effect on next order
+func SetRiskLimits(account string, lim RiskLimits) {
+	riskLimits[account] = lim
+}
+
+// ReloadRiskLimits replace limits of all accounts
+func ReloadRiskLimits(limits map[string]RiskLimits) {
+	res := make(map[string]RiskLimits, len(limits))
+	for acc, lim := range limits {
+		res[acc] = lim
+	}
+	riskLimits = res
+}
+
+// GetRiskLimits return limits of account, false if not limited
+func GetRiskLimits(account string) (RiskLimits, bool) {
+	lim, ok := riskLimits[account]
+	return lim, ok
+}
+
+// openOrder is open order of account tracked from execution reports
+type openOrder struct {
+	sym    string
+	isBuy  bool
+	price  int
+	leaves int
+}
+
+// accountState is open orders and positions of an account
+type accountState struct {
+	account     string
+	orders      map[int]*openOrder
+	buyNotional int
+	openBuy     map[string]int
+	openSell    map[string]int
+	positions   map[string]*Position
+	// fees charged and volume traded
+	fees   int
+	volume int
+}
+
+var accounts = map[string]*accountState{}
+
+func getAccount(account string) *accountState {
+	acc, ok := accounts[account]
+	if !ok {
+		acc = &accountState{account: account, positions: map[string]*Position{}}
+		acc.resetOrders()
+		accounts[account] = acc
+	}
+	return acc
+}
+
+func (acc *accountState) resetOrders() {
+	acc.orders = map[int]*openOrder{}
+	acc.buyNotional = 0
+	acc.openBuy = map[string]int{}
+	acc.openSell = map[string]int{}
+}
+
+// resetOpenOrders drop open orders of all accounts, positions kept
+func resetOpenOrders() {
+	for _, acc := range accounts {
+		acc.resetOrders()
+	}
+}
+
+func (acc *accountState) remove(oid int) {
+	oo, ok := acc.orders[oid]
+	if !ok {
+		return
+	}
+	if oo.isBuy {
+		acc.buyNotional -= oo.price * oo.leaves
+		acc.openBuy[oo.sym] -= oo.leaves
+	} else {
+		acc.openSell[oo.sym] -= oo.leaves
+	}
+	delete(acc.orders, oid)
+}
+
+func (acc *accountState) add(oid int, oo *openOrder) {
+	if oo.isBuy {
+		acc.buyNotional += oo.price * oo.leaves
+		acc.openBuy[oo.sym] += oo.leaves
+	} else {
+		acc.openSell[oo.sym] += oo.leaves
+	}
+	acc.orders[oid] = oo
+}
+
+// accountOnExec track open orders and positions of account
+func accountOnExec(er *ExecReport) {
+	if er.Account == "" {
+		return
+	}
+	acc := getAccount(er.Account)
+	if er.ExecType == ExecReplaced && er.OrigOid != er.Oid {
+		acc.remove(er.OrigOid)
+	}
+	if er.ExecType == ExecFill {
+		if sp, ok := spreads[er.Symbol]; ok {
+			// spread position held in legs
+			acc.position(sp.Front).fill(er.IsBuy, er.LegPrices[0], er.LastQty)
+			acc.position(sp.Back).fill(!er.IsBuy, er.LegPrices[1], er.LastQty)
+		} else {
+			acc.position(er.Symbol).fill(er.IsBuy, er.LastPrice, er.LastQty)
+		}
+		acc.fees += er.Fee
+		acc.volume += er.LastQty
+	}
+	acc.remove(er.Oid)
+	if leaves := er.Leaves(); leaves > 0 {
+		acc.add(er.Oid, &openOrder{sym: er.Symbol, isBuy: er.IsBuy,
+			price: er.Price, leaves: leaves})
+	}
+}
+
+// riskRefPrice return last trade price, mid of BBO or zero
+func riskRefPrice(sym string) int {
+	tk, _ := GetTicker(sym)
+	switch {
+	case tk.LastPrice != 0:
+		return tk.LastPrice
+	case tk.BidPrice != 0 && tk.AskPrice != 0:
+		return (tk.BidPrice + tk.AskPrice) / 2
+	}
+	return 0
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// check return reject reason of ro, empty if passed
+func (lim *RiskLimits) check(ro *RiskOrder) string {
+	if lim.MaxOrderQty > 0 && ro.Qty > lim.MaxOrderQty {
+		return fmt.Sprintf("order qty %d exceed max %d", ro.Qty, lim.MaxOrderQty)
+	}
+	notional := ro.Qty * ro.Price
+	if lim.MaxNotional > 0 && notional > lim.MaxNotional {
+		return fmt.Sprintf("order notional %d exceed max %d", notional,
+			lim.MaxNotional)
+	}
+	acc := getAccount(ro.Account)
+	var old openOrder
+	if oo, ok := acc.orders[ro.ReplaceOid]; ok && ro.ReplaceOid != 0 {
+		old = *oo
+	}
+	open := len(acc.orders)
+	if old.leaves > 0 {
+		open--
+	}
+	if lim.MaxOpenOrders > 0 && open >= lim.MaxOpenOrders {
+		return fmt.Sprintf("open orders %d reach max %d", open, lim.MaxOpenOrders)
+	}
+	if ro.IsBuy && lim.CreditLimit > 0 {
+		credit := acc.buyNotional + notional
+		if old.isBuy {
+			credit -= old.price * old.leaves
+		}
+		if credit > lim.CreditLimit {
+			return fmt.Sprintf("buy notional %d exceed credit limit %d", credit,
+				lim.CreditLimit)
+		}
+	}
+	if lim.MaxPosition > 0 {
+		var net int
+		if p, ok := acc.positions[ro.Symbol]; ok {
+			net = p.Net
+		}
+		pos := net + acc.openBuy[ro.Symbol] + ro.Qty
+		if !ro.IsBuy {
+			pos = net - acc.openSell[ro.Symbol] - ro.Qty
+		}
+		if old.isBuy == ro.IsBuy {
+			if ro.IsBuy {
+				pos -= old.leaves
+			} else {
+				pos += old.leaves
+			}
+		}
+		if abs(pos) > lim.MaxPosition {
+			return fmt.Sprintf("position %d of %s exceed max %d", pos, ro.Symbol,
+				lim.MaxPosition)
+		}
+	}
+	if lim.PriceCollar > 0 && ro.Price != 0 {
+		ref := riskRefPrice(ro.Symbol)
+		if ref > 0 && abs(ro.Price-ref)*10000 > lim.PriceCollar*ref {
+			return fmt.Sprintf("price %d outside collar %d bp of %d", ro.Price,
+				lim.PriceCollar, ref)
+		}
+	}
+	return ""
+}
+
+// checkRisks check orders of one request, each checked with open volume of
+// orders before it in ros added and their ReplaceOid removed. Zero qty order
+// only remove ReplaceOid. Account state unchanged on return
+func checkRisks(ros []RiskOrder) error {
+	type undo struct {
+		acc *accountState
+		oid int
+		// removed order to add back, nil for pending order
+		oo *openOrder
+	}
+	var undos []undo
+	defer func() {
+		for i := len(undos) - 1; i >= 0; i-- {
+			u := undos[i]
+			if u.oo == nil {
+				u.acc.remove(u.oid)
+			} else {
+				u.acc.add(u.oid, u.oo)
+			}
+		}
+	}()
+	for i := range ros {
+		ro := &ros[i]
+		if ro.Qty > 0 {
+			if err := checkRisk(ro); err != nil {
+				return err
+			}
+		}
+		if ro.Account == "" {
+			continue
+		}
+		acc := getAccount(ro.Account)
+		if oo, ok := acc.orders[ro.ReplaceOid]; ok && ro.ReplaceOid != 0 {
+			acc.remove(ro.ReplaceOid)
+			undos = append(undos, undo{acc, ro.ReplaceOid, oo})
+		}
+		if ro.Qty > 0 {
+			// negative oid never used by orders
+			acc.add(-i-1, &openOrder{sym: ro.Symbol, isBuy: ro.IsBuy,
+				price: ro.Price, leaves: ro.Qty})
+			undos = append(undos, undo{acc: acc, oid: -i - 1})
+		}
+	}
+	return nil
+}
+
+// checkRisk run kill switch, RiskLimits of account and registered checks
+func checkRisk(ro *RiskOrder) error {
+	if ro.Account != "" && killedAccounts[ro.Account] {
+		return &RiskError{Account: ro.Account, Reason: "kill switch active"}
+	}
+	if lim, ok := riskLimits[ro.Account]; ok && ro.Account != "" {
+		if reason := lim.check(ro); reason != "" {
+			return &RiskError{Account: ro.Account, Reason: reason}
+		}
+	}
+	for _, fn := range riskChecks {
+		if err := fn(ro); err != nil {
+			return err
+		}
+	}
+	return nil
+}
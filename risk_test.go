@@ -0,0 +1,106 @@
+package auction
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func expectRisk(t *testing.T, err error, reason string) {
+	t.Helper()
+	var re *RiskError
+	if !errors.As(err, &re) || !strings.Contains(re.Reason, reason) {
+		t.Errorf("risk error %v, want reason %q", err, reason)
+	}
+}
+
+func TestRiskLimits(t *testing.T) {
+	instr := "cu1912"
+	defer ReloadRiskLimits(nil)
+	cleanupOrderBook(instr)
+	MarketStart(false)
+	n := 0
+	owner := func(acc string) Owner {
+		n++
+		return Owner{Account: acc, ClOrdID: "risk" + string(rune('a'+n))}
+	}
+	SetRiskLimits("RISK1", RiskLimits{MaxOrderQty: 10, MaxNotional: 420000,
+		MaxOpenOrders: 3, CreditLimit: 800000, MaxPosition: 15})
+	_, err := SendOrderOwner(owner("RISK1"), instr, true, 11, 100)
+	expectRisk(t, err, "order qty")
+	_, err = SendOrderOwner(owner("RISK1"), instr, true, 10, 42001)
+	expectRisk(t, err, "notional")
+	b1 := sendOwner(t, owner("RISK1"), instr, true, 10, 42000)
+	// 420000 open, 800000 credit
+	_, err = SendOrderOwner(owner("RISK1"), instr, true, 10, 40000)
+	expectRisk(t, err, "credit limit")
+	// other account fill 4, position 4 + open 6 + 5 = 15
+	sendOwner(t, owner("RISK2"), instr, false, 4, 42000)
+	if pos := getAccount("RISK1").position(instr).Net; pos != 4 {
+		t.Errorf("position %d, want 4", pos)
+	}
+	sendOwner(t, owner("RISK1"), instr, true, 5, 41000)
+	_, err = SendOrderOwner(owner("RISK1"), instr, true, 1, 41000)
+	expectRisk(t, err, "position")
+	sendOwner(t, owner("RISK1"), instr, false, 1, 43000)
+	_, err = SendOrderOwner(owner("RISK1"), instr, false, 1, 43000)
+	expectRisk(t, err, "open orders")
+	// replace of open order not counted twice
+	b2, err := ReplaceOrderOwner("RISK1", b1, "riskr", 10, 41900)
+	if err != nil || b2 == b1 {
+		t.Error("ReplaceOrderOwner", b2, err)
+	}
+	_, err = ReplaceOrderOwner("RISK1", b2, "riskr2", 7, 41900)
+	expectRisk(t, err, "position")
+	if err := CancelOrder(b1); err == nil {
+		t.Error("replaced order should be canceled")
+	}
+	if acc := getAccount("RISK1"); len(acc.orders) != 3 || acc.openBuy[instr] != 11 {
+		t.Errorf("open orders %d, open buy %d", len(acc.orders), acc.openBuy[instr])
+	}
+
+	// reload at runtime, RISK1 no longer limited
+	ReloadRiskLimits(map[string]RiskLimits{"RISK2": {PriceCollar: 100}})
+	sendOwner(t, owner("RISK1"), instr, true, 11, 100)
+	if lim, ok := GetRiskLimits("RISK2"); !ok || lim.PriceCollar != 100 {
+		t.Errorf("GetRiskLimits %+v %v", lim, ok)
+	}
+	// last trade 42000, collar 1%
+	_, err = SendOrderOwner(owner("RISK2"), instr, false, 1, 42421)
+	expectRisk(t, err, "collar")
+	sendOwner(t, owner("RISK2"), instr, false, 1, 42420)
+	MarketStop()
+}
+
+func TestRiskCheck(t *testing.T) {
+	instr := "cu1912"
+	defer RiskUnregisterAll()
+	cleanupOrderBook(instr)
+	MarketStart(false)
+	errHalt := errors.New("symbol halted")
+	RiskRegister(func(ro *RiskOrder) error {
+		if ro.Symbol == instr && ro.Qty > 100 {
+			return errHalt
+		}
+		return nil
+	})
+	if oid := SendOrder(instr, true, 101, 42000); oid != 0 {
+		t.Error("anonymous order should be rejected")
+	}
+	if _, err := SendOrderOwner(Owner{Account: "RISK3", ClOrdID: "r1"}, instr,
+		true, 101, 42000); err != errHalt {
+		t.Errorf("SendOrderOwner error %v", err)
+	}
+	oid := SendOrder(instr, true, 100, 42000)
+	if oid == 0 {
+		t.Fatal("SendOrder rejected")
+	}
+	// rejected replace leave order untouched
+	if _, err := ReplaceOrder(oid, 101, 42100); err != errHalt {
+		t.Errorf("ReplaceOrder error %v", err)
+	}
+	if v := openVol(instr, oid); v != 100 {
+		t.Errorf("open volume %d after rejected replace", v)
+	}
+	MarketStop()
+}
@@ -0,0 +1,405 @@
+package auction
+
+import (
+	"errors"
+	"sort"
+)
+
+var (
+	errSpreadSymbol = errors.New("invalid spread symbol or legs")
+	errSpreadOpts   = errors.New("spread order can't be dark, pegged or post-only")
+)
+
+// Spread is calendar spread of two outright symbols, buy spread buy Front
+// and sell Back in equal quantity. Spread price is Front minus Back, may
+// be zero or negative
+type Spread struct {
+	Symbol string
+	Front  string
+	Back   string
+}
+
+var spreads = map[string]*Spread{}
+
+// DefineSpread define sym as spread of outright legs front and back,
+// orderBook of sym must be empty, legs can't be spreads
+func DefineSpread(sym, front, back string) error {
+	if sym == "" || front == "" || back == "" || front == back || sym == front ||
+		sym == back {
+		return errSpreadSymbol
+	}
+	if _, ok := spreads[front]; ok {
+		return errSpreadSymbol
+	}
+	if _, ok := spreads[back]; ok {
+		return errSpreadSymbol
+	}
+	for _, sp := range spreads {
+		if sp.Front == sym || sp.Back == sym {
+			return errSpreadSymbol
+		}
+	}
+	if orB, ok := simOrderBook[sym]; ok {
+		if bids, asks := orB.bookLen(); bids+asks > 0 {
+			return errSpreadSymbol
+		}
+		// rebuilt with spread price order
+		orB.cleanup()
+		delete(simOrderBook, sym)
+	}
+	spreads[sym] = &Spread{Symbol: sym, Front: front, Back: back}
+	return nil
+}
+
+// GetSpread return legs of spread sym
+func GetSpread(sym string) (Spread, bool) {
+	if sp, ok := spreads[sym]; ok {
+		return *sp, true
+	}
+	return Spread{}, false
+}
+
+// legSpreads return spreads with leg sym in symbol order
+func legSpreads(sym string) []*Spread {
+	var res []*Spread
+	for _, sp := range spreads {
+		if sp.Front == sym || sp.Back == sym {
+			res = append(res, sp)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Symbol < res[j].Symbol })
+	return res
+}
+
+// spreadBidCompare is bidCompare without zero price first, zero is valid
+// spread price
+func spreadBidCompare(a, b *simOrderType) int {
+	if a.price == b.price {
+		return a.seq - b.seq
+	}
+	return b.price - a.price
+}
+
+// spreadCross check price cross limit of order side bBuy
+func spreadCross(bBuy bool, limit, price int) bool {
+	if bBuy {
+		return price <= limit
+	}
+	return price >= limit
+}
+
+// impliedIn return top orders of legs trading against spread order side
+// bBuy and implied spread price, nil if any leg empty or not trading.
+// Buy spread lift front ask and hit back bid
+func impliedIn(sp *Spread, bBuy bool) (front, back *simOrderType, price int) {
+	fB, ok := simOrderBook[sp.Front]
+	bB, ok2 := simOrderBook[sp.Back]
+	if !ok || !ok2 || SymbolState(sp.Front) != StateTrading ||
+		SymbolState(sp.Back) != StateTrading {
+		return nil, nil, 0
+	}
+	front, back = fB.First(!bBuy), bB.First(bBuy)
+	if front == nil || back == nil {
+		return nil, nil, 0
+	}
+	return front, back, front.price - back.price
+}
+
+// legRefPrice return reference price of risk checks, one side of BBO if
+// only one side quoted, zero if none
+func legRefPrice(sym string) int {
+	if ref := riskRefPrice(sym); ref != 0 {
+		return ref
+	}
+	tk, _ := GetTicker(sym)
+	if tk.BidPrice != 0 {
+		return tk.BidPrice
+	}
+	return tk.AskPrice
+}
+
+// spreadLegPrices price legs of spread trade at price, back leg at
+// reference price of back month, derived from front month if back month
+// not traded nor quoted. false if neither leg has reference price
+func spreadLegPrices(sp *Spread, price int) ([2]int, bool) {
+	back := legRefPrice(sp.Back)
+	if back == 0 {
+		back = legRefPrice(sp.Front) - price
+	}
+	if back <= 0 || back+price <= 0 {
+		return [2]int{}, false
+	}
+	return [2]int{back + price, back}, true
+}
+
+// spreadFill account fill of spread order, or is resting copy or incoming
+func spreadFill(or *simOrderType, price, qty, tNo, liq int, legs [2]int) {
+	or.Filled += qty
+	or.PriceFilled = price
+	pushDeal(or.oid, price, qty)
+	execFillLegs(or, price, qty, tNo, liq, legs)
+}
+
+// matchSpread match incoming spread order against spread orderBook and
+// implied price of legs, better price first, spread orders first at same
+// price. Resting orders trade at own price, order legs never checked for
+// self trade prevention, implied price skipped instead
+func matchSpread(order *simOrderType) (filled bool) {
+	sp := spreads[order.Symbol]
+	orB, ok := simOrderBook[sp.Symbol]
+	if !ok {
+		orB = NewOrderBook(sp.Symbol)
+		simOrderBook[sp.Symbol] = orB
+	}
+	implied := false
+	for order.Filled < order.Qty {
+		v := orB.First(!order.bBuy)
+		if v != nil && !spreadCross(order.bBuy, order.price, v.price) {
+			v = nil
+		}
+		front, back, iPrice := impliedIn(sp, order.bBuy)
+		if front != nil && (!spreadCross(order.bBuy, order.price, iPrice) ||
+			selfTrade(order, front) || selfTrade(order, back)) {
+			front = nil
+		}
+		if v != nil && (front == nil || spreadCross(order.bBuy, iPrice, v.price)) {
+			if selfTrade(order, v) {
+				if preventSelfTrade(orB, order, v) {
+					return true
+				}
+				continue
+			}
+			price := v.price
+			qty := v.Qty - v.Filled
+			if leaves := order.Qty - order.Filled; leaves < qty {
+				qty = leaves
+			}
+			legs, ok := spreadLegPrices(sp, price)
+			if !ok {
+				// positions of legs can't be booked
+				log.Warningf("spread %s no leg reference price, oid %d canceled",
+					sp.Symbol, order.oid)
+				execPublish(ExecCanceled, order, 0)
+				return true
+			}
+			tNo := nextTradeNo()
+			spreadFill(v, price, qty, tNo, LiqMaker, legs)
+			mdTrade(sp.Symbol, order.bBuy, price, qty, tNo)
+			orB.fill(v, price, qty, tNo)
+			if v.Filled >= v.Qty {
+				orB.RemoveFirst(v.bBuy)
+			}
+			spreadFill(order, price, qty, tNo, LiqTaker, legs)
+			continue
+		}
+		if front == nil {
+			break
+		}
+		impliedFill(sp, nil, order, front, back)
+		implied = true
+	}
+	if implied {
+		bookChanged(sp.Front)
+		bookChanged(sp.Back)
+	}
+	return order.Filled >= order.Qty
+}
+
+// impliedFill execute spread order or against top orders of legs front and
+// back, trade on each leg at resting leg price and spread trade at price
+// difference, all of same quantity. Newest order of three is taker.
+// orB is spread orderBook of resting or, nil for incoming order
+func impliedFill(sp *Spread, orB *orderBook, or, front, back *simOrderType) {
+	qty := or.Qty - or.Filled
+	for _, v := range []*simOrderType{front, back} {
+		if leaves := v.Qty - v.Filled; leaves < qty {
+			qty = leaves
+		}
+	}
+	taker := or
+	for _, v := range []*simOrderType{front, back} {
+		if v.seq > taker.seq {
+			taker = v
+		}
+	}
+	liq := func(v *simOrderType) int {
+		if v == taker {
+			return LiqTaker
+		}
+		return LiqMaker
+	}
+	// aggressor side of trade with v, implied side unless v is taker
+	aggr := func(v *simOrderType) bool {
+		if v == taker {
+			return v.bBuy
+		}
+		return !v.bBuy
+	}
+	legs := [2]int{front.price, back.price}
+	orLiq, orAggr := liq(or), aggr(or)
+	for i, leg := range []string{sp.Front, sp.Back} {
+		v := front
+		if i == 1 {
+			v = back
+		}
+		legB := simOrderBook[leg]
+		tNo := nextTradeNo()
+		v.Filled += qty
+		v.PriceFilled = v.price
+		pushDeal(v.oid, v.price, qty)
+		execFill(v, v.price, qty, tNo, liq(v))
+		md := MdUpdate{Symbol: leg, Action: MdTrade, IsBuy: aggr(v),
+			Price: v.price, Volume: qty, TradeNo: tNo, Implied: true}
+		mdPublish(&md)
+		legB.fill(v, v.price, qty, tNo)
+		if v.Filled >= v.Qty {
+			legB.RemoveFirst(v.bBuy)
+		}
+	}
+	price := legs[0] - legs[1]
+	tNo := nextTradeNo()
+	spreadFill(or, price, qty, tNo, orLiq, legs)
+	md := MdUpdate{Symbol: sp.Symbol, Action: MdTrade, IsBuy: orAggr,
+		Price: price, Volume: qty, TradeNo: tNo, Implied: true}
+	mdPublish(&md)
+	if orB != nil {
+		orB.fill(or, price, qty, tNo)
+		if or.Filled >= or.Qty {
+			orB.RemoveFirst(or.bBuy)
+		}
+	}
+}
+
+// impliedMatch match resting spread orders crossed by implied price after
+// orderBook of leg sym changed, return other legs changed by fills
+func impliedMatch(sym string) []string {
+	var changed []string
+	for _, sp := range legSpreads(sym) {
+		orB, ok := simOrderBook[sp.Symbol]
+		if !ok || SymbolState(sp.Symbol) != StateTrading {
+			continue
+		}
+		matched := false
+		for _, bBuy := range []bool{true, false} {
+			for v := orB.First(bBuy); v != nil; v = orB.First(bBuy) {
+				front, back, price := impliedIn(sp, bBuy)
+				if front == nil || !spreadCross(bBuy, v.price, price) ||
+					selfTrade(v, front) || selfTrade(v, back) {
+					break
+				}
+				impliedFill(sp, orB, v, front, back)
+				matched = true
+			}
+		}
+		if !matched {
+			continue
+		}
+		other := sp.Front
+		if other == sym {
+			other = sp.Back
+		}
+		changed = append(changed, other)
+	}
+	return changed
+}
+
+// ImpliedQuote is implied-out price of outright Symbol from Spread orderBook
+// and other leg, zero volume for side without implied price
+type ImpliedQuote struct {
+	Symbol    string
+	Spread    string
+	BidPrice  int
+	BidVolume int
+	AskPrice  int
+	AskVolume int
+}
+
+type ImpliedHandler func(q *ImpliedQuote)
+
+var impliedHandlers []ImpliedHandler
+
+// last published implied-out quote by leg and spread
+var impliedQuotes = map[[2]string]ImpliedQuote{}
+
+// ImpliedSubscribe register handler for changed implied-out quotes
+func ImpliedSubscribe(fn ImpliedHandler) {
+	impliedHandlers = append(impliedHandlers, fn)
+}
+
+func ImpliedUnsubscribeAll() {
+	impliedHandlers = nil
+}
+
+// ImpliedQuotes return last implied-out quotes of outright sym, one per
+// spread with leg sym
+func ImpliedQuotes(sym string) []ImpliedQuote {
+	var res []ImpliedQuote
+	for _, sp := range legSpreads(sym) {
+		if q, ok := impliedQuotes[[2]string{sym, sp.Symbol}]; ok {
+			res = append(res, q)
+		}
+	}
+	return res
+}
+
+// impliedOut return implied-out quotes of front and back leg of sp.
+// Buy spread and sell back imply front bid, sell spread and buy front
+// imply back bid
+func impliedOut(sp *Spread) (front, back ImpliedQuote) {
+	level := func(sym string, isBuy bool) (int, int) {
+		if orB, ok := simOrderBook[sym]; ok {
+			return orB.bestLevel(isBuy)
+		}
+		return 0, 0
+	}
+	minVol := func(a, b int) int {
+		if a < b {
+			return a
+		}
+		return b
+	}
+	sBid, sBidVol := level(sp.Symbol, true)
+	sAsk, sAskVol := level(sp.Symbol, false)
+	fBid, fBidVol := level(sp.Front, true)
+	fAsk, fAskVol := level(sp.Front, false)
+	bBid, bBidVol := level(sp.Back, true)
+	bAsk, bAskVol := level(sp.Back, false)
+	front = ImpliedQuote{Symbol: sp.Front, Spread: sp.Symbol}
+	if vol := minVol(sBidVol, bBidVol); vol > 0 {
+		front.BidPrice, front.BidVolume = sBid+bBid, vol
+	}
+	if vol := minVol(sAskVol, bAskVol); vol > 0 {
+		front.AskPrice, front.AskVolume = sAsk+bAsk, vol
+	}
+	back = ImpliedQuote{Symbol: sp.Back, Spread: sp.Symbol}
+	if vol := minVol(fBidVol, sAskVol); vol > 0 {
+		back.BidPrice, back.BidVolume = fBid-sAsk, vol
+	}
+	if vol := minVol(fAskVol, sBidVol); vol > 0 {
+		back.AskPrice, back.AskVolume = fAsk-sBid, vol
+	}
+	return
+}
+
+// impliedPublish publish changed implied-out quotes depending on orderBook
+// of sym, spread or leg
+func impliedPublish(sym string) {
+	sps := legSpreads(sym)
+	if sp, ok := spreads[sym]; ok {
+		sps = append(sps, sp)
+	}
+	for _, sp := range sps {
+		front, back := impliedOut(sp)
+		for _, q := range []ImpliedQuote{front, back} {
+			key := [2]string{q.Symbol, q.Spread}
+			old, ok := impliedQuotes[key]
+			impliedQuotes[key] = q
+			if old == q || (!ok && q.BidVolume == 0 && q.AskVolume == 0) {
+				continue
+			}
+			for _, fn := range impliedHandlers {
+				fn(&q)
+			}
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package auction
+
+import (
+	"testing"
+)
+
+func TestSpreadMatch(t *testing.T) {
+	front, back, instr := "cu2001", "cu2002", "cu2001-2002"
+	defer delete(spreads, instr)
+	defer MdUnsubscribeAll()
+	defer ImpliedUnsubscribeAll()
+	for _, sym := range []string{front, back, instr} {
+		cleanupOrderBook(sym)
+	}
+	MarketStart(false)
+	if err := DefineSpread(instr, front, front); err != errSpreadSymbol {
+		t.Error("spread of same legs", err)
+	}
+	if err := DefineSpread(instr, front, back); err != nil {
+		t.Fatal("DefineSpread", err)
+	}
+	if err := DefineSpread("cu2001-x", instr, back); err != errSpreadSymbol {
+		t.Error("spread leg", err)
+	}
+	if _, err := SendOrderOpts(nil, instr, true, 1, 0,
+		OrderOpts{Dark: true}); err != errSpreadOpts {
+		t.Error("dark spread order", err)
+	}
+	trades := map[string][]MdUpdate{}
+	MdSubscribe(func(md *MdUpdate) {
+		if md.Action == MdTrade {
+			trades[md.Symbol] = append(trades[md.Symbol], *md)
+		}
+	})
+	implied := map[string]ImpliedQuote{}
+	ImpliedSubscribe(func(q *ImpliedQuote) {
+		implied[q.Symbol] = *q
+	})
+
+	// zero and positive spread prices by price priority, leg prices from
+	// front bid
+	ref := SendOrder(front, true, 1, 49000)
+	z := SendOrder(instr, true, 1, 0)
+	p := SendOrder(instr, true, 1, 5)
+	SendOrder(instr, false, 1, 0)
+	if openVol(instr, p) != 0 || openVol(instr, z) != 1 {
+		t.Errorf("spread bids open %d/%d", openVol(instr, p), openVol(instr, z))
+	}
+	SendOrder(instr, false, 1, -5)
+	if bids, asks := OrderBookLen(instr); bids != 0 || asks != 0 {
+		t.Errorf("spread orderBook %d/%d", bids, asks)
+	}
+	CancelOrder(ref)
+
+	// implied ask of spread 50100-50200, back leg limit fill
+	f1 := SendOrder(front, false, 4, 50100)
+	b1 := SendOrder(back, true, 2, 50200)
+	trades = map[string][]MdUpdate{}
+	s1 := sendOwner(t, Owner{Account: "SPR1", ClOrdID: "s1"}, instr, true, 5, -90)
+	if openVol(instr, s1) != 3 || openVol(front, f1) != 2 || openVol(back, b1) != 0 {
+		t.Errorf("implied fill open %d/%d/%d", openVol(instr, s1), openVol(front, f1),
+			openVol(back, b1))
+	}
+	for _, sym := range []string{front, back, instr} {
+		if len(trades[sym]) != 1 || !trades[sym][0].Implied || trades[sym][0].Volume != 2 {
+			t.Errorf("%s trades %+v", sym, trades[sym])
+		}
+	}
+	if trades[instr][0].Price != -100 || trades[back][0].IsBuy {
+		t.Errorf("implied trades %+v/%+v", trades[instr], trades[back])
+	}
+	pf, _ := GetPosition("SPR1", front)
+	pb, _ := GetPosition("SPR1", back)
+	if pf.Net != 2 || pb.Net != -2 {
+		t.Errorf("leg positions %d/%d", pf.Net, pb.Net)
+	}
+	// sell back at front ask minus spread bid
+	if q := implied[back]; q.AskPrice != 50190 || q.AskVolume != 2 || q.BidVolume != 0 {
+		t.Errorf("implied-out %+v", q)
+	}
+	if qs := ImpliedQuotes(back); len(qs) != 1 || qs[0].Spread != instr {
+		t.Errorf("ImpliedQuotes %+v", qs)
+	}
+
+	// new back bid cross resting spread bid by implied price
+	SendOrder(back, true, 1, 50195)
+	if openVol(instr, s1) != 2 || openVol(front, f1) != 1 {
+		t.Errorf("resting implied open %d/%d", openVol(instr, s1), openVol(front, f1))
+	}
+	// back order is aggressor
+	if n := len(trades[instr]); n != 2 || trades[instr][1].Price != -95 ||
+		trades[instr][1].IsBuy || !trades[back][1].IsBuy {
+		t.Errorf("spread trades %+v", trades[instr])
+	}
+
+	// direct spread order first at same price
+	CancelOrder(s1)
+	SendOrder(back, true, 1, 50200)
+	s2 := SendOrder(instr, false, 1, -100)
+	sendOwner(t, Owner{Account: "SPR2", ClOrdID: "s1"}, instr, true, 2, -100)
+	if openVol(instr, s2) != 0 || openVol(front, f1) != 0 {
+		t.Errorf("direct/implied open %d/%d", openVol(instr, s2), openVol(front, f1))
+	}
+	MarketStop()
+}
+
+func TestSpreadUntradedBack(t *testing.T) {
+	front, back, instr := "cu2003", "cu2004", "cu2003-2004"
+	defer delete(spreads, instr)
+	defer ExecUnsubscribeAll()
+	for _, sym := range []string{front, back, instr} {
+		cleanupOrderBook(sym)
+	}
+	MarketStart(false)
+	if err := DefineSpread(instr, front, back); err != nil {
+		t.Fatal("DefineSpread", err)
+	}
+	var fills []ExecReport
+	ExecSubscribe(func(er *ExecReport) {
+		if er.ExecType == ExecFill && er.Symbol == instr {
+			fills = append(fills, *er)
+		}
+	})
+	// no reference of either leg, fill rejected
+	bid := sendOwner(t, Owner{Account: "SPU1", ClOrdID: "u1"}, instr, true, 2, 10)
+	ask := sendOwner(t, Owner{Account: "SPU2", ClOrdID: "u2"}, instr, false, 1, 10)
+	if len(fills) != 0 || openVol(instr, ask) != 0 || openVol(instr, bid) != 2 {
+		t.Errorf("spread fills without reference %+v", fills)
+	}
+
+	// back leg priced from front last price
+	SendOrder(front, true, 1, 50000)
+	SendOrder(front, false, 1, 50000)
+	sendOwner(t, Owner{Account: "SPU2", ClOrdID: "u3"}, instr, false, 1, 10)
+	if len(fills) != 2 || fills[0].LegPrices != [2]int{50000, 49990} ||
+		fills[1].LegPrices != fills[0].LegPrices {
+		t.Errorf("spread fills %+v", fills)
+	}
+	pf, _ := GetPosition("SPU1", front)
+	pb, _ := GetPosition("SPU1", back)
+	if pf.Net != 1 || pf.AvgPrice != 50000 || pb.Net != -1 || pb.AvgPrice != 49990 {
+		t.Errorf("leg positions %+v %+v", pf, pb)
+	}
+	MarketStop()
+}
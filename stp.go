@@ -0,0 +1,191 @@
+package auction
+
+// self-trade prevention modes, StpNone allow orders of same account match
+const (
+	StpNone = iota
+	StpCancelResting
+	StpCancelIncoming
+	StpCancelBoth
+	StpDecrement
+)
+
+var stpMode = StpCancelIncoming
+
+// SetStpMode set handling of incoming order cross resting order of same
+// account or StpGroup, StpDecrement reduce both orders by smaller open
+// volume and cancel order(s) left no volume
+func SetStpMode(mode int) {
+	stpMode = mode
+}
+
+// StpEvent is match prevented by self-trade prevention, Qty is smaller
+// open volume of both orders
+type StpEvent struct {
+	Symbol     string
+	Mode       int
+	Oid        int
+	RestingOid int
+	Price      int
+	Qty        int
+	Account    string
+	StpGroup   string
+}
+
+type StpHandler func(ev *StpEvent)
+
+var stpHandlers []StpHandler
+
+// StpSubscribe register handler for prevented self-trades
+func StpSubscribe(fn StpHandler) {
+	stpHandlers = append(stpHandlers, fn)
+}
+
+func StpUnsubscribeAll() {
+	stpHandlers = nil
+}
+
+// selfTrade check orders of same account or StpGroup, anonymous orders
+// never prevented
+func selfTrade(a, b *simOrderType) bool {
+	if stpMode == StpNone {
+		return false
+	}
+	return (a.Account != "" && a.Account == b.Account) ||
+		(a.StpGroup != "" && a.StpGroup == b.StpGroup)
+}
+
+// stpPublish report prevented match of incoming order and resting order v,
+// return volume prevented
+func stpPublish(order, v *simOrderType) int {
+	ev := StpEvent{Symbol: order.Symbol, Mode: stpMode, Oid: order.oid,
+		RestingOid: v.oid, Price: v.price, Qty: order.Qty - order.Filled,
+		Account: order.Account, StpGroup: order.StpGroup}
+	if vLeaves := v.Qty - v.Filled; vLeaves < ev.Qty {
+		ev.Qty = vLeaves
+	}
+	for _, fn := range stpHandlers {
+		fn(&ev)
+	}
+	return ev.Qty
+}
+
+// stpCancels return orders canceled by stpMode for prevented volume qty,
+// StpDecrement cancel order left no volume
+func stpCancels(order, v *simOrderType, qty int) (cancelResting, cancelIncoming bool) {
+	switch stpMode {
+	case StpCancelResting:
+		cancelResting = true
+	case StpCancelBoth:
+		cancelResting, cancelIncoming = true, true
+	case StpDecrement:
+		cancelResting = v.Qty-v.Filled == qty
+		cancelIncoming = order.Qty-order.Filled == qty
+	default:
+		cancelIncoming = true
+	}
+	return
+}
+
+// preventSelfTrade apply stpMode to incoming order and resting order v,
+// first of orderBook or inside level of pro-rata allocation, return true
+// if incoming order canceled
+func preventSelfTrade(orB *orderBook, order, v *simOrderType) bool {
+	qty := stpPublish(order, v)
+	cancelResting, cancelIncoming := stpCancels(order, v, qty)
+	if stpMode == StpDecrement {
+		if !cancelResting {
+			orB.reduce(v, v.Qty-qty)
+			simOrders[v.oid-1].Qty = v.Qty
+			execPublish(ExecReplaced, v, v.oid)
+		}
+		if !cancelIncoming {
+			order.Qty -= qty
+			execPublish(ExecReplaced, order, order.oid)
+		}
+	}
+	if cancelResting {
+		res := *v
+		if cur := orB.Get(v.bBuy); cur != nil && cur.oid == v.oid {
+			orB.RemoveFirst(v.bBuy)
+		} else {
+			orB.delete(v)
+		}
+		execPublish(ExecCanceled, &res, 0)
+	}
+	if cancelIncoming {
+		execPublish(ExecCanceled, order, 0)
+	}
+	return cancelIncoming
+}
+
+// crossedSelfTrade return first crossed bid and ask of orderBook of same
+// account or StpGroup, nil if none
+func crossedSelfTrade(orB *orderBook) (bid, ask *simOrderType) {
+	best, ok := 0, false
+	orB.walk(false, func(a *simOrderType) bool {
+		best, ok = a.price, true
+		return false
+	})
+	if !ok {
+		return
+	}
+	orB.walk(true, func(b *simOrderType) bool {
+		if b.price != 0 && best != 0 && b.price < best {
+			return false
+		}
+		if b.Account == "" && b.StpGroup == "" {
+			return true
+		}
+		orB.walk(false, func(a *simOrderType) bool {
+			if b.price != 0 && a.price > b.price {
+				return false
+			}
+			if selfTrade(b, a) {
+				bid, ask = b, a
+				return false
+			}
+			return true
+		})
+		return bid == nil
+	})
+	return
+}
+
+// uncrossSelfTrades apply stpMode to crossed orders of same account or
+// StpGroup before auction uncross, both orders rest in orderBook so later
+// entered one is incoming. Uncross fill sides without pairing orders, only
+// removing the crossed volume keeps the auction free of self-trades
+func uncrossSelfTrades(sym string) {
+	orB, ok := simOrderBook[sym]
+	if !ok || stpMode == StpNone {
+		return
+	}
+	for {
+		bid, ask := crossedSelfTrade(orB)
+		if bid == nil {
+			return
+		}
+		// copies, orderBook change may move orders
+		order, v := *bid, *ask
+		if v.seq > order.seq {
+			order, v = v, order
+		}
+		qty := stpPublish(&order, &v)
+		cancelResting, cancelIncoming := stpCancels(&order, &v, qty)
+		for _, c := range []struct {
+			or     *simOrderType
+			cancel bool
+		}{{&v, cancelResting}, {&order, cancelIncoming}} {
+			if c.cancel {
+				if res := orB.delete(c.or); res != nil {
+					execPublish(ExecCanceled, res, 0)
+				}
+			} else if stpMode == StpDecrement {
+				if rv := orB.reduce(c.or, c.or.Qty-qty); rv != nil {
+					simOrders[rv.oid-1].Qty = rv.Qty
+					execPublish(ExecReplaced, rv, rv.oid)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package auction
+
+import (
+	"testing"
+)
+
+// openVol return open volume of order in orderBook, zero if not in book
+func openVol(sym string, oid int) int {
+	orB, ok := simOrderBook[sym]
+	if !ok {
+		return 0
+	}
+	if v := orB.find(simOrders[oid-1]); v != nil {
+		return v.Qty - v.Filled
+	}
+	return 0
+}
+
+func sendOwner(t *testing.T, ow Owner, sym string, bBuy bool, qty, prc int) int {
+	t.Helper()
+	oid, err := SendOrderOwner(ow, sym, bBuy, qty, prc)
+	if err != nil || oid == 0 {
+		t.Fatal("SendOrderOwner", ow, oid, err)
+	}
+	return oid
+}
+
+func TestSelfTradePrevention(t *testing.T) {
+	instr := "cu1912"
+	defer ExecUnsubscribeAll()
+	defer StpUnsubscribeAll()
+	defer SetStpMode(StpCancelIncoming)
+	var evs []StpEvent
+	StpSubscribe(func(ev *StpEvent) {
+		evs = append(evs, *ev)
+	})
+	canceled := map[int]bool{}
+	ExecSubscribe(func(er *ExecReport) {
+		if er.ExecType == ExecCanceled {
+			canceled[er.Oid] = true
+		}
+	})
+	n := 0
+	owner := func(acc string) Owner {
+		n++
+		return Owner{Account: acc, ClOrdID: "stp" + string(rune('a'+n))}
+	}
+	tests := []struct {
+		mode         int
+		restQty      int
+		qty          int
+		restLeft     int
+		left         int
+		restCanceled bool
+		canceled     bool
+	}{
+		{StpCancelIncoming, 5, 3, 5, 0, false, true},
+		{StpCancelResting, 5, 3, 0, 3, true, false},
+		{StpCancelBoth, 5, 3, 0, 0, true, true},
+		{StpDecrement, 5, 3, 2, 0, false, true},
+		{StpDecrement, 3, 5, 0, 2, true, false},
+		{StpDecrement, 4, 4, 0, 0, true, true},
+	}
+	for i, tt := range tests {
+		cleanupOrderBook(instr)
+		MarketStart(false)
+		SetStpMode(tt.mode)
+		evs = nil
+		rest := sendOwner(t, owner("ACC1"), instr, false, tt.restQty, 42000)
+		oid := sendOwner(t, owner("ACC1"), instr, true, tt.qty, 42000)
+		if len(evs) != 1 || evs[0].Oid != oid || evs[0].RestingOid != rest ||
+			evs[0].Mode != tt.mode || evs[0].Account != "ACC1" {
+			t.Errorf("%d: stp events %+v", i, evs)
+		}
+		if v := openVol(instr, rest); v != tt.restLeft {
+			t.Errorf("%d: resting open volume %d, want %d", i, v, tt.restLeft)
+		}
+		if v := openVol(instr, oid); v != tt.left {
+			t.Errorf("%d: incoming open volume %d, want %d", i, v, tt.left)
+		}
+		if canceled[rest] != tt.restCanceled || canceled[oid] != tt.canceled {
+			t.Errorf("%d: canceled resting %v incoming %v", i, canceled[rest],
+				canceled[oid])
+		}
+		if DealCount() != 0 {
+			t.Errorf("%d: self-trade deals %d", i, DealCount())
+		}
+		if err := verifySimOrderBook(instr); err != nil {
+			t.Errorf("%d: verifySimOrderBook %v", i, err)
+		}
+	}
+
+	// resting order canceled, match continue with other account
+	cleanupOrderBook(instr)
+	MarketStart(false)
+	SetStpMode(StpCancelResting)
+	evs = nil
+	rest := sendOwner(t, owner("ACC1"), instr, false, 5, 42000)
+	other := sendOwner(t, owner("ACC2"), instr, false, 2, 42100)
+	oid := sendOwner(t, owner("ACC1"), instr, true, 4, 42100)
+	if len(evs) != 1 || openVol(instr, rest) != 0 || openVol(instr, other) != 0 ||
+		openVol(instr, oid) != 2 {
+		t.Errorf("cancel resting then match: events %+v, open %d/%d/%d", evs,
+			openVol(instr, rest), openVol(instr, other), openVol(instr, oid))
+	}
+
+	// StpGroup across accounts, anonymous orders never prevented
+	SetStpMode(StpCancelIncoming)
+	evs = nil
+	ow := owner("ACC3")
+	ow.StpGroup = "G1"
+	sendOwner(t, ow, instr, false, 1, 42200)
+	ow = owner("ACC4")
+	ow.StpGroup = "G1"
+	sendOwner(t, ow, instr, true, 1, 42200)
+	if len(evs) != 1 || evs[0].StpGroup != "G1" {
+		t.Errorf("StpGroup events %+v", evs)
+	}
+	SetStpMode(StpNone)
+	sendOwner(t, owner("ACC3"), instr, false, 1, 42300)
+	sendOwner(t, owner("ACC3"), instr, true, 1, 42300)
+	if len(evs) != 1 || DealCount() != 4 {
+		t.Errorf("StpNone events %+v, deals %d", evs, DealCount())
+	}
+	MarketStop()
+}
+
+// crossed orders of same account entered before open never trade in
+// Uncross, later entered order is incoming
+func TestSelfTradeUncross(t *testing.T) {
+	instr := "cu1912"
+	defer StpUnsubscribeAll()
+	defer SetStpMode(StpCancelIncoming)
+	cleanupOrderBook(instr)
+	MarketStart(false)
+	simState = StatePreAuction
+	var evs []StpEvent
+	StpSubscribe(func(ev *StpEvent) {
+		evs = append(evs, *ev)
+	})
+	buy := sendOwner(t, Owner{Account: "ACC1", ClOrdID: "u1"}, instr, true, 10, 43000)
+	sell := sendOwner(t, Owner{Account: "ACC1", ClOrdID: "u2"}, instr, false, 6, 42900)
+	sendOwner(t, Owner{Account: "ACC2", ClOrdID: "u3"}, instr, false, 4, 42950)
+	if _, vol, _ := Uncross(instr, 42000); vol != 4 {
+		t.Errorf("Uncross volume %d, want 4", vol)
+	}
+	if len(evs) != 1 || evs[0].Oid != sell || evs[0].RestingOid != buy ||
+		evs[0].Qty != 6 || openVol(instr, buy) != 6 || openVol(instr, sell) != 0 {
+		t.Errorf("uncross stp events %+v, open %d/%d", evs, openVol(instr, buy),
+			openVol(instr, sell))
+	}
+	cleanupOrderBook(instr)
+
+	// decrement both by smaller volume, rest of buy uncrossed with ACC2
+	SetStpMode(StpDecrement)
+	evs = nil
+	buy = sendOwner(t, Owner{Account: "ACC1", ClOrdID: "u6"}, instr, true, 10, 43000)
+	sell = sendOwner(t, Owner{Account: "ACC1", ClOrdID: "u7"}, instr, false, 6, 42900)
+	sendOwner(t, Owner{Account: "ACC2", ClOrdID: "u8"}, instr, false, 4, 42950)
+	if _, vol, _ := Uncross(instr, 42000); vol != 4 {
+		t.Errorf("decrement Uncross volume %d, want 4", vol)
+	}
+	if len(evs) != 1 || openVol(instr, buy) != 0 || openVol(instr, sell) != 0 {
+		t.Errorf("decrement stp events %+v, open %d/%d", evs, openVol(instr, buy),
+			openVol(instr, sell))
+	}
+	SetStpMode(StpCancelIncoming)
+	evs = nil
+
+	// continuous trading after uncross
+	MarketStart(false)
+	rest := sendOwner(t, Owner{Account: "ACC1", ClOrdID: "u4"}, instr, false, 3, 43000)
+	oid := sendOwner(t, Owner{Account: "ACC1", ClOrdID: "u5"}, instr, true, 2, 43000)
+	if len(evs) != 1 || openVol(instr, rest) != 3 || openVol(instr, oid) != 0 {
+		t.Errorf("stp events %+v after uncross, open %d/%d", evs,
+			openVol(instr, rest), openVol(instr, oid))
+	}
+	MarketStop()
+}
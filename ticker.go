@@ -0,0 +1,130 @@
+package auction
+
+// Ticker is top of book and last trade of a symbol
+type Ticker struct {
+	Symbol     string
+	BidPrice   int
+	BidVolume  int
+	AskPrice   int
+	AskVolume  int
+	LastPrice  int
+	LastVolume int
+	// cumulative volume and turnover
+	Volume   int
+	Turnover int
+}
+
+type TickerHandler func(tk *Ticker)
+
+var simTickers = map[string]*Ticker{}
+var tickerHandlers = map[string][]TickerHandler{}
+
+// SubscribeTicker register handler for Ticker of sym, called on value changed
+func SubscribeTicker(sym string, fn TickerHandler) {
+	tickerHandlers[sym] = append(tickerHandlers[sym], fn)
+}
+
+// SubscribeTickerChan deliver Ticker of sym to ch, never block matching,
+// Ticker dropped if ch is full
+func SubscribeTickerChan(sym string, ch chan<- Ticker) {
+	SubscribeTicker(sym, func(tk *Ticker) {
+		select {
+		case ch <- *tk:
+		default:
+		}
+	})
+}
+
+func UnsubscribeTicker(sym string) {
+	delete(tickerHandlers, sym)
+}
+
+// GetTicker return current Ticker of sym
+func GetTicker(sym string) (Ticker, bool) {
+	if tk, ok := simTickers[sym]; ok {
+		return *tk, true
+	}
+	return Ticker{Symbol: sym}, false
+}
+
+// priceBetter return true if price a better than b, zero bid price is market
+func priceBetter(isBuy bool, a, b int) bool {
+	if isBuy {
+		if a == 0 || b == 0 {
+			return a == 0 && b != 0
+		}
+		return a > b
+	}
+	return a < b
+}
+
+// walk visit orders of side in priority until fn return false, own
+// iterator used so bidIt/askIt of matching in progress not disturbed.
+// fn must not change orderBook
+func (orB *orderBook) walk(isBuy bool, fn func(v *simOrderType) bool) {
+	tree := orB.asks
+	if isBuy {
+		tree = orB.bids
+	}
+	it := tree.First()
+	for v := it.Get(); v != nil; v = it.Next() {
+		if !fn(v) {
+			return
+		}
+	}
+}
+
+// bestLevel return best price level with open volume
+func (orB *orderBook) bestLevel(isBuy bool) (price, vol int) {
+	levels := orB.askLevels
+	if isBuy {
+		levels = orB.bidLevels
+	}
+	orB.walk(isBuy, func(v *simOrderType) bool {
+		if vol = levels[v.price]; vol > 0 {
+			price = v.price
+			return false
+		}
+		return true
+	})
+	return price, vol
+}
+
+func tickerOnMd(md *MdUpdate) {
+	tk, ok := simTickers[md.Symbol]
+	if !ok {
+		tk = &Ticker{Symbol: md.Symbol}
+		simTickers[md.Symbol] = tk
+	}
+	old := *tk
+	switch md.Action {
+	case MdTrade:
+		if md.lastPrice() {
+			tk.LastPrice = md.Price
+			tk.LastVolume = md.Volume
+		}
+		tk.Volume += md.Volume
+		tk.Turnover += md.Price * md.Volume
+	default:
+		bestP, bestV := &tk.AskPrice, &tk.AskVolume
+		if md.IsBuy {
+			bestP, bestV = &tk.BidPrice, &tk.BidVolume
+		}
+		// level behind best don't change top of book
+		if *bestV != 0 && priceBetter(md.IsBuy, *bestP, md.Price) {
+			break
+		}
+		if orB, ok := simOrderBook[md.Symbol]; ok {
+			*bestP, *bestV = orB.bestLevel(md.IsBuy)
+		} else {
+			*bestP, *bestV = 0, 0
+		}
+	}
+	if *tk == old {
+		return
+	}
+	for _, fn := range tickerHandlers[md.Symbol] {
+		cp := *tk
+		fn(&cp)
+	}
+}
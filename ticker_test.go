@@ -0,0 +1,62 @@
+package auction
+
+import (
+	"testing"
+)
+
+func TestTicker(t *testing.T) {
+	instr := "cu1912"
+	defer UnsubscribeTicker(instr)
+	cleanupOrderBook(instr)
+	MarketStart(false)
+	base, _ := GetTicker(instr)
+	var cnt int
+	SubscribeTicker(instr, func(tk *Ticker) {
+		cnt++
+	})
+	ch := make(chan Ticker, 64)
+	SubscribeTickerChan(instr, ch)
+	SendOrder(instr, true, 10, 42000)
+	SendOrder(instr, true, 20, 42000)
+	SendOrder(instr, false, 5, 43000)
+	// behind best, no change
+	SendOrder(instr, true, 7, 41000)
+	SendOrder(instr, false, 7, 44000)
+	if cnt != 3 {
+		t.Errorf("ticker published %d, want 3", cnt)
+	}
+	tk, _ := GetTicker(instr)
+	want := Ticker{Symbol: instr, BidPrice: 42000, BidVolume: 30,
+		AskPrice: 43000, AskVolume: 5, LastPrice: base.LastPrice,
+		LastVolume: base.LastVolume, Volume: base.Volume, Turnover: base.Turnover}
+	if tk != want {
+		t.Errorf("ticker %+v, want %+v", tk, want)
+	}
+	// sweep bid level 42000
+	SendOrder(instr, false, 35, 42000)
+	tk, _ = GetTicker(instr)
+	want.BidPrice, want.BidVolume = 41000, 7
+	want.AskPrice, want.AskVolume = 42000, 5
+	want.LastPrice, want.LastVolume = 42000, 20
+	want.Volume += 30
+	want.Turnover += 42000 * 30
+	if tk != want {
+		t.Errorf("ticker %+v, want %+v", tk, want)
+	}
+	if len(ch) != cnt {
+		t.Errorf("channel got %d tickers, want %d", len(ch), cnt)
+	}
+	var last Ticker
+	for len(ch) > 0 {
+		last = <-ch
+	}
+	if last != want {
+		t.Errorf("channel ticker %+v, want %+v", last, want)
+	}
+	cleanupOrderBook(instr)
+	tk, _ = GetTicker(instr)
+	if tk.BidVolume != 0 || tk.AskVolume != 0 || tk.BidPrice != 0 || tk.AskPrice != 0 {
+		t.Errorf("ticker after cleanup %+v", tk)
+	}
+	MarketStop()
+}